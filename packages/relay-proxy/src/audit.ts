@@ -0,0 +1,49 @@
+import type { Env } from "./relay/models";
+import type { UploadAuthContext } from "./upload-token";
+import { parseBooleanFlag } from "./utils";
+
+// Who a presigned URL was handed to. Webhook deliveries have no caller, so they are attributed
+// to the webhook itself.
+export interface AuditIdentity {
+  authMode: UploadAuthContext["mode"] | "webhook";
+  eoaAddress: string | null;
+  tenant: string | null;
+}
+
+export interface PresignAuditRecord {
+  identity: AuditIdentity;
+  // Upload URLs create a new object (`POST`); private gateway access links read one (`GET`).
+  method: "POST" | "GET";
+  imageID: string | null;
+  cid: string | null;
+  expiresAt: string;
+}
+
+export function toAuditIdentity(auth: UploadAuthContext): AuditIdentity {
+  return { authMode: auth.mode, eoaAddress: auth.eoaAddress, tenant: auth.tenant };
+}
+
+// Audit records are one JSON line each on stdout, kept apart from request logs by their `log`
+// field so Workers Logs or a Logpush job can route them separately. Workers have no filesystem,
+// so stdout is the only destination. Records only ever carry the fields below: the signed URL
+// and its signature are never passed in.
+export function recordPresignAudit(env: Env, record: PresignAuditRecord): void {
+  if (!parseBooleanFlag(env.AUDIT_LOG_ENABLED, false)) {
+    return;
+  }
+
+  console.log(
+    JSON.stringify({
+      log: "audit",
+      event: "presigned_url_issued",
+      timestamp: new Date().toISOString(),
+      authMode: record.identity.authMode,
+      eoaAddress: record.identity.eoaAddress,
+      tenant: record.identity.tenant,
+      method: record.method,
+      imageID: record.imageID,
+      cid: record.cid,
+      expiresAt: record.expiresAt,
+    })
+  );
+}
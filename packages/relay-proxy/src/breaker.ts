@@ -0,0 +1,126 @@
+import { BadRequestError, ServiceUnavailableError } from "./errors";
+import type { Env } from "./relay/models";
+import { parseBoundedInteger } from "./utils";
+
+export type BreakerName = "pinata_api" | "pinata_gateway";
+export type BreakerState = "closed" | "open" | "half_open";
+
+interface BreakerConfig {
+  failureThreshold: number;
+  cooldownMs: number;
+  maxCooldownMs: number;
+}
+
+interface BreakerRecord {
+  consecutiveFailures: number;
+  openedAt: number | null;
+  cooldownMs: number;
+  probing: boolean;
+}
+
+export interface BreakerSnapshot {
+  state: BreakerState;
+  consecutiveFailures: number;
+  retryAt: string | null;
+}
+
+// Breakers live in isolate memory: each isolate trips on its own failures, which is enough to
+// stop one isolate from stacking slow upstream calls during an incident.
+const breakers = new Map<BreakerName, BreakerRecord>();
+
+// Call sites that translate upstream errors into BadRequestError rethrow this one untouched, so
+// a fast-failed call still surfaces as `503 upstream_unavailable`.
+export class CircuitOpenError extends ServiceUnavailableError {
+  constructor(name: BreakerName) {
+    super(`Upstream ${name} is unavailable; retry later.`, "upstream_unavailable");
+  }
+}
+
+// After `failureThreshold` consecutive failures the breaker opens and fails fast for the cooldown.
+// One probe is then let through (half-open): success closes the breaker, failure reopens it with
+// the cooldown doubled, up to `maxCooldownMs`. Errors that are the caller's fault (BadRequestError,
+// e.g. a missing object) never count as upstream failures.
+export async function withCircuitBreaker<T>(env: Env, name: BreakerName, call: () => Promise<T>): Promise<T> {
+  const config = resolveBreakerConfig(env);
+  const breaker = resolveBreaker(name, config);
+  const state = readBreakerState(breaker, Date.now());
+
+  if (state === "open" || (state === "half_open" && breaker.probing)) {
+    throw new CircuitOpenError(name);
+  }
+  if (state === "half_open") {
+    breaker.probing = true;
+  }
+
+  try {
+    const result = await call();
+    closeBreaker(breaker, config);
+    return result;
+  } catch (error) {
+    if (error instanceof BadRequestError) {
+      breaker.probing = false;
+    } else {
+      recordBreakerFailure(name, breaker, config, state === "half_open");
+    }
+    throw error;
+  }
+}
+
+export function describeBreakers(env: Env): Record<BreakerName, BreakerSnapshot> {
+  const config = resolveBreakerConfig(env);
+  const now = Date.now();
+  const describe = (name: BreakerName): BreakerSnapshot => {
+    const breaker = resolveBreaker(name, config);
+    return {
+      state: readBreakerState(breaker, now),
+      consecutiveFailures: breaker.consecutiveFailures,
+      retryAt: breaker.openedAt === null ? null : new Date(breaker.openedAt + breaker.cooldownMs).toISOString(),
+    };
+  };
+  return { pinata_api: describe("pinata_api"), pinata_gateway: describe("pinata_gateway") };
+}
+
+function resolveBreakerConfig(env: Env): BreakerConfig {
+  const cooldownSeconds = parseBoundedInteger(env.UPSTREAM_BREAKER_COOLDOWN_SECONDS ?? "30", 1, 600, 30);
+  const maxCooldownSeconds = parseBoundedInteger(env.UPSTREAM_BREAKER_MAX_COOLDOWN_SECONDS ?? "300", 1, 3600, 300);
+  return {
+    failureThreshold: parseBoundedInteger(env.UPSTREAM_BREAKER_FAILURE_THRESHOLD ?? "5", 1, 100, 5),
+    cooldownMs: cooldownSeconds * 1000,
+    maxCooldownMs: Math.max(cooldownSeconds, maxCooldownSeconds) * 1000,
+  };
+}
+
+function resolveBreaker(name: BreakerName, config: BreakerConfig): BreakerRecord {
+  let breaker = breakers.get(name);
+  if (!breaker) {
+    breaker = { consecutiveFailures: 0, openedAt: null, cooldownMs: config.cooldownMs, probing: false };
+    breakers.set(name, breaker);
+  }
+  return breaker;
+}
+
+function readBreakerState(breaker: BreakerRecord, now: number): BreakerState {
+  if (breaker.openedAt === null) {
+    return "closed";
+  }
+  return now - breaker.openedAt < breaker.cooldownMs ? "open" : "half_open";
+}
+
+function closeBreaker(breaker: BreakerRecord, config: BreakerConfig): void {
+  breaker.consecutiveFailures = 0;
+  breaker.openedAt = null;
+  breaker.cooldownMs = config.cooldownMs;
+  breaker.probing = false;
+}
+
+function recordBreakerFailure(name: BreakerName, breaker: BreakerRecord, config: BreakerConfig, probe: boolean): void {
+  breaker.consecutiveFailures += 1;
+  breaker.probing = false;
+  if (probe) {
+    breaker.cooldownMs = Math.min(breaker.cooldownMs * 2, config.maxCooldownMs);
+  } else if (breaker.consecutiveFailures < config.failureThreshold || breaker.openedAt !== null) {
+    return;
+  }
+  breaker.openedAt = Date.now();
+  console.warn(`circuit breaker ${name} opened for ${breaker.cooldownMs}ms`);
+}
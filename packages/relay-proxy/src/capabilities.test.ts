@@ -0,0 +1,57 @@
+import { describe, expect, it } from "bun:test";
+
+import type { Env } from "./relay/models";
+
+import { describeCapabilities, handleCapabilities } from "./capabilities";
+
+const PINATA: Partial<Env> = {
+  PINATA_JWT: "test-jwt",
+  PINATA_GROUP_ID: "group-avatars",
+  PINATA_GATEWAY_BASE_URL: "https://gateway.pinata.test/ipfs",
+};
+
+describe("describeCapabilities", () => {
+  it("reports nothing enabled on a bare deployment", () => {
+    const capabilities = describeCapabilities({} as Env);
+    expect(Object.values(capabilities.features).some(Boolean)).toBe(false);
+    expect(capabilities.faucet.chains).toEqual([]);
+  });
+
+  it("follows the bindings and flags that are configured", () => {
+    const env = {
+      ...PINATA,
+      PROXY_UPLOAD_ENABLED: "true",
+      REJECT_DOUBLE_EXTENSION: "true",
+      FAUCET_TRACKER_DO: {},
+      SERVER_KEY_STORE: {},
+    } as Env;
+    const { features, upload, faucet } = describeCapabilities(env);
+
+    expect(features).toMatchObject({
+      directUpload: true,
+      verify: true,
+      faucet: true,
+      relay: false,
+      proxyUpload: true,
+      list: true,
+      revoke: true,
+    });
+    expect(upload.rejectDoubleExtension).toBe(true);
+    expect(faucet.chains).toEqual([11155111, 84532, 421614]);
+  });
+
+  it("offers no variants when delivery is signed", () => {
+    const capabilities = describeCapabilities({ ...PINATA, DELIVERY_MODE: "signed" } as Env);
+    expect(capabilities.upload.deliveryMode).toBe("signed");
+    expect(capabilities.upload.variants).toEqual([]);
+  });
+});
+
+describe("handleCapabilities", () => {
+  it("serves the summary as JSON", async () => {
+    const env = { ...PINATA } as Env;
+    const response = handleCapabilities(env);
+    expect(response.status).toBe(200);
+    expect(await response.json()).toEqual({ ok: true, ...describeCapabilities(env) });
+  });
+});
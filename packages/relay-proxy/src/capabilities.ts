@@ -0,0 +1,62 @@
+import { resolveFaucetAntibotMode } from "./faucet";
+import { FAUCET_CHAINS } from "./faucet/config";
+import { resolveDeliveryTransform, resolveDeliveryVariants } from "./images/delivery";
+import { resolveDeliveryMode } from "./images/gateway";
+import type { Env } from "./relay/models";
+import {
+  resolveAllowedContentTypes,
+  resolveBatchUploadMaxItems,
+  resolveUploadLimits,
+  resolveUploadScopes,
+} from "./upload";
+import { jsonResponse, parseBooleanFlag } from "./utils";
+
+export function handleCapabilities(env: Env): Response {
+  return jsonResponse({ ok: true, ...describeCapabilities(env) });
+}
+
+// Public by design: the same summary is served to clients and logged by the startup config line.
+export function describeCapabilities(env: Env) {
+  const uploadEnabled = hasValue(env.PINATA_JWT) && hasValue(env.PINATA_GROUP_ID);
+  const gatewayEnabled = hasValue(env.PINATA_GATEWAY_BASE_URL);
+  const faucetEnabled = !!env.FAUCET_TRACKER_DO && !!env.SERVER_KEY_STORE;
+  const relayEnabled = hasValue(env.GELATO_MAINNET_API_KEY) || hasValue(env.GELATO_TESTNET_API_KEY);
+  const limits = resolveUploadLimits(env);
+  const deliveryMode = resolveDeliveryMode(env);
+
+  return {
+    features: {
+      directUpload: uploadEnabled && gatewayEnabled,
+      verify: gatewayEnabled,
+      validateDimensions: gatewayEnabled,
+      faucet: faucetEnabled,
+      relay: relayEnabled,
+      multipart: false,
+      proxyUpload: uploadEnabled && parseBooleanFlag(env.PROXY_UPLOAD_ENABLED, false),
+      list: uploadEnabled && gatewayEnabled,
+      delete: false,
+      revoke: uploadEnabled,
+    },
+    upload: {
+      contentTypes: resolveAllowedContentTypes(env),
+      scopes: resolveUploadScopes(env),
+      maxFileSizeBytes: limits.maxFileSize,
+      signExpiresSeconds: limits.expiresSeconds,
+      signExpiresRangeSeconds: [limits.minExpiresSeconds, limits.maxExpiresSeconds],
+      rejectDoubleExtension: parseBooleanFlag(env.REJECT_DOUBLE_EXTENSION, false),
+      maxBatchItems: resolveBatchUploadMaxItems(env),
+      deliveryMode,
+      deliveryTransform: resolveDeliveryTransform(env),
+      variants: deliveryMode === "signed" ? [] : Object.keys(resolveDeliveryVariants(env)),
+    },
+    faucet: {
+      supportModes: ["LIMITED_TESTNET"],
+      chains: faucetEnabled ? FAUCET_CHAINS.map((chain) => chain.id) : [],
+      antibot: resolveFaucetAntibotMode(env),
+    },
+  };
+}
+
+function hasValue(value: string | undefined): boolean {
+  return (value ?? "").trim() !== "";
+}
@@ -3,10 +3,18 @@ import type { Address } from "viem";
 export const SUPPORT_MODES: Set<string> = new Set(["LIMITED_TESTNET", "LIMITED_MAINNET", "FULL_MAINNET"]);
 export const ETH_DRIP_WEI = 10_000_000_000_000_000n; // 0.01 ETH
 export const USDC_DRIP_AMOUNT = 2_000_000n; // 2 USDC (6 decimals)
+export const ERC20_TRANSFER_GAS_FALLBACK = 65_000n;
+export const NATIVE_TRANSFER_GAS_FALLBACK = 21_000n;
 export const FAUCET_PENDING_TTL_SECONDS = 600;
 export const FAUCET_FUNDED_TTL_SECONDS = 31_536_000;
+export const FAUCET_JOB_STATUS_TTL_SECONDS = 86_400;
 export const DEFERRED_TX_TTL_SECONDS = 2_592_000;
 
+export const IMAGE_FILE_EXTENSIONS: Set<string> = new Set(["jpg", "jpeg", "png", "gif", "webp", "heic", "heif", "avif"]);
+
+export const UPLOAD_METADATA_MAX_ENTRIES = 8;
+export const RESERVED_METADATA_KEYS: Set<string> = new Set(["owner", "imageID", "source", "scope", "tenant"]);
+
 export const TESTNET_USDC_BY_CHAIN: Record<number, Address> = {
   11155111: "0x1c7D4B196Cb0C7B01d743Fbc6116a902379C7238", // Sepolia
   84532: "0x036CbD53842c5426634e7929541eC2318f3dCF7e", // Base Sepolia
@@ -26,6 +34,16 @@ export const ERC20_TRANSFER_ABI = [
   },
 ] as const;
 
+export const ERC20_BALANCE_OF_ABI = [
+  {
+    type: "function",
+    name: "balanceOf",
+    stateMutability: "view",
+    inputs: [{ name: "account", type: "address" }],
+    outputs: [{ name: "", type: "uint256" }],
+  },
+] as const;
+
 export const JSON_HEADERS = {
   "content-type": "application/json; charset=utf-8",
   "cache-control": "no-store",
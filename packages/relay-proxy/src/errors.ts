@@ -1,8 +1,70 @@
 import type { PaymentOptionModel, SupportMode } from "./relay/models";
 
-export class BadRequestError extends Error {}
+// `code` is the stable, machine-readable identifier returned in the error envelope;
+// messages are for humans and may change.
+export class BadRequestError extends Error {
+  readonly code: string;
 
-export class AuthError extends Error {}
+  constructor(message: string, code = "bad_request") {
+    super(message);
+    this.code = code;
+  }
+}
+
+export class AuthError extends Error {
+  readonly code: string;
+
+  constructor(message: string, code = "unauthorized") {
+    super(message);
+    this.code = code;
+  }
+}
+
+export class ForbiddenError extends Error {
+  readonly code: string;
+
+  constructor(message: string, code = "forbidden") {
+    super(message);
+    this.code = code;
+  }
+}
+
+export class ServiceUnavailableError extends Error {
+  readonly code: string;
+
+  constructor(message: string, code = "service_unavailable") {
+    super(message);
+    this.code = code;
+  }
+}
+
+export class PayloadTooLargeError extends Error {
+  readonly code = "payload_too_large";
+}
+
+export class HandlerTimeoutError extends Error {
+  readonly code = "handler_timeout";
+}
+
+export class RateLimitedError extends Error {
+  readonly code = "rate_limited";
+  readonly retryAfterSeconds: number;
+
+  constructor(message: string, retryAfterSeconds: number) {
+    super(message);
+    this.retryAfterSeconds = retryAfterSeconds;
+  }
+}
+
+export class RelaySubmissionError extends Error {
+  readonly code = "relay_submission_failed";
+  readonly details: Record<string, unknown>;
+
+  constructor(message: string, details: Record<string, unknown>) {
+    super(message);
+    this.details = details;
+  }
+}
 
 export class PaymentRequiredError extends Error {
   readonly account: string;
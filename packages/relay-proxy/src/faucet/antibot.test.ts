@@ -0,0 +1,118 @@
+import { describe, expect, it } from "bun:test";
+import { sha256, toBytes } from "viem";
+import { privateKeyToAccount } from "viem/accounts";
+
+import { bindDurableObject, createDurableObjectState } from "../../test/durable-object";
+import type { Env } from "../relay/models";
+
+import { assertFaucetAntibot, countLeadingZeroBits, handleFaucetChallenge } from "./antibot";
+import { FaucetTracker } from "./do";
+
+function trackerStub(env: Env): DurableObjectStub {
+  const trackers = bindDurableObject(new FaucetTracker(createDurableObjectState(), env));
+  return trackers.get(trackers.idFromName("global-faucet"));
+}
+
+describe("countLeadingZeroBits", () => {
+  it("counts whole zero bytes and the leading zeros of the first non-zero byte", () => {
+    expect(countLeadingZeroBits(new Uint8Array([0x00, 0x00, 0x0f, 0xff]))).toBe(20);
+    expect(countLeadingZeroBits(new Uint8Array([0x80]))).toBe(0);
+    expect(countLeadingZeroBits(new Uint8Array([0x01, 0x00]))).toBe(7);
+  });
+
+  it("counts every bit of an all-zero digest", () => {
+    expect(countLeadingZeroBits(new Uint8Array(32))).toBe(256);
+  });
+});
+
+describe("proof-of-work challenges", () => {
+  const env = { FAUCET_ANTIBOT: "pow", FAUCET_POW_SECRET: "test-pow-secret", FAUCET_POW_DIFFICULTY: "8" } as Env;
+  const eoaAddress = "0x90f79bf6eb2c4f870365e785982e1f101e93b906";
+  const otherAddress = "0x15d34aaf54267db7d7c367839aaf71a00a2c6a65";
+
+  async function issue(forAddress: string): Promise<string> {
+    const url = new URL(`https://relay.test/v1/faucet/challenge?eoa=${forAddress}`);
+    const response = await handleFaucetChallenge(url, env);
+    return ((await response.json()) as { challenge: string }).challenge;
+  }
+
+  function solve(challenge: string, forAddress: string): string {
+    for (let attempt = 0; ; attempt++) {
+      if (countLeadingZeroBits(sha256(toBytes(`${challenge}:${forAddress}:${attempt}`), "bytes")) >= 8) {
+        return String(attempt);
+      }
+    }
+  }
+
+  it("requires the EOA the challenge is for", async () => {
+    const failure = handleFaucetChallenge(new URL("https://relay.test/v1/faucet/challenge"), env);
+    await expect(failure).rejects.toMatchObject({ code: "invalid_eoa" });
+  });
+
+  it("accepts a solution for the EOA it was issued to", async () => {
+    const challenge = await issue(eoaAddress);
+    const proof = { challenge, solution: solve(challenge, eoaAddress) };
+    await expect(assertFaucetAntibot(env, trackerStub(env), eoaAddress, proof)).resolves.toBeUndefined();
+  });
+
+  it("rejects a challenge issued for another EOA even when solved for this one", async () => {
+    const challenge = await issue(otherAddress);
+    const proof = { challenge, solution: solve(challenge, eoaAddress) };
+    await expect(assertFaucetAntibot(env, trackerStub(env), eoaAddress, proof)).rejects.toMatchObject({
+      code: "antibot_failed",
+    });
+  });
+});
+
+describe("signature challenges", () => {
+  // Hardhat account 3 owns the faucet request; account 4 plays someone who does not.
+  const holder = privateKeyToAccount("0x7c852118294e51e653712a81e05800f419141751be58f605c371e15141b007a6");
+  const intruder = privateKeyToAccount("0x47e179ec197488593b187f80a00eb0da91f1b9d0b13f8733639f19c30a34926a");
+  const eoaAddress = holder.address.toLowerCase();
+  const env = { FAUCET_ANTIBOT: "signature", FAUCET_SIGNATURE_SECRET: "test-signature-secret" } as Env;
+
+  async function issue(forAddress = eoaAddress): Promise<{ challenge: string; message: string }> {
+    const url = new URL(`https://relay.test/v1/faucet/challenge?eoa=${forAddress}`);
+    const response = await handleFaucetChallenge(url, env);
+    return (await response.json()) as { challenge: string; message: string };
+  }
+
+  it("accepts the holder's signature once", async () => {
+    const tracker = trackerStub(env);
+    const { challenge, message } = await issue();
+    const signature = await holder.signMessage({ message });
+
+    await expect(assertFaucetAntibot(env, tracker, eoaAddress, { challenge, signature })).resolves.toBeUndefined();
+    await expect(assertFaucetAntibot(env, tracker, eoaAddress, { challenge, signature })).rejects.toMatchObject({
+      code: "antibot_failed",
+    });
+  });
+
+  it("spends a challenge for only one of two concurrent requests", async () => {
+    const tracker = trackerStub(env);
+    const { challenge, message } = await issue();
+    const signature = await holder.signMessage({ message });
+    const outcomes = await Promise.allSettled([
+      assertFaucetAntibot(env, tracker, eoaAddress, { challenge, signature }),
+      assertFaucetAntibot(env, tracker, eoaAddress, { challenge, signature }),
+    ]);
+    expect(outcomes.filter((outcome) => outcome.status === "fulfilled").length).toBe(1);
+  });
+
+  it("rejects a signature by another key", async () => {
+    const { challenge, message } = await issue();
+    const signature = await intruder.signMessage({ message });
+    await expect(
+      assertFaucetAntibot(env, trackerStub(env), eoaAddress, { challenge, signature })
+    ).rejects.toMatchObject({ code: "antibot_failed" });
+  });
+
+  it("rejects a challenge issued for another EOA", async () => {
+    const { challenge } = await issue(intruder.address.toLowerCase());
+    const message = `knot faucet: I control ${eoaAddress}\nChallenge: ${challenge}`;
+    const signature = await holder.signMessage({ message });
+    await expect(
+      assertFaucetAntibot(env, trackerStub(env), eoaAddress, { challenge, signature })
+    ).rejects.toMatchObject({ code: "antibot_failed" });
+  });
+});
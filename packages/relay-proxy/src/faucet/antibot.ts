@@ -0,0 +1,220 @@
+import { isHex, recoverMessageAddress, sha256, toBytes } from "viem";
+
+import { BadRequestError, ForbiddenError } from "../errors";
+import { consumeNonce } from "../nonce-store";
+import type { Env, FaucetAntibotProofModel } from "../relay/models";
+import {
+  hmacHex,
+  jsonResponse,
+  normalizeAddress,
+  parseBoundedInteger,
+  randomHex,
+  resolveRequiredEnvValue,
+  timingSafeEqual,
+} from "../utils";
+
+export type FaucetAntibotMode = "turnstile" | "pow" | "signature" | "none";
+
+const TURNSTILE_VERIFY_URL = "https://challenges.cloudflare.com/turnstile/v0/siteverify";
+const CHALLENGE_TTL_SECONDS = 300;
+
+export function resolveFaucetAntibotMode(env: Env): FaucetAntibotMode {
+  const mode = (env.FAUCET_ANTIBOT ?? "").trim().toLowerCase();
+  if (mode === "turnstile" || mode === "pow" || mode === "signature") {
+    return mode;
+  }
+  return "none";
+}
+
+// Challenges are stateless: `<issuedAt>.<nonce>.<hmac>`. Each one is accepted once (tracked in the
+// faucet Durable Object until it expires). The HMAC covers the `eoa` the challenge was issued to,
+// so it is only valid for that address.
+// - pow: signed with FAUCET_POW_SECRET. Solving means finding a `solution` where
+//   sha256("<challenge>:<eoaAddress>:<solution>") starts with `difficulty` zero bits.
+// - signature: signed with FAUCET_SIGNATURE_SECRET. The EOA personal_signs (EIP-191) the returned
+//   `message`.
+export async function handleFaucetChallenge(url: URL, env: Env): Promise<Response> {
+  switch (resolveFaucetAntibotMode(env)) {
+    case "pow": {
+      const eoaAddress = parseChallengeEOA(url.searchParams.get("eoa"));
+      const secret = resolveRequiredEnvValue(env.FAUCET_POW_SECRET, "FAUCET_POW_SECRET");
+      const { challenge, expiresAt } = await issueChallenge(secret, eoaAddress);
+      return jsonResponse({ ok: true, challenge, difficulty: resolvePowDifficulty(env), expiresAt });
+    }
+    case "signature": {
+      const eoaAddress = parseChallengeEOA(url.searchParams.get("eoa"));
+      const secret = resolveRequiredEnvValue(env.FAUCET_SIGNATURE_SECRET, "FAUCET_SIGNATURE_SECRET");
+      const { challenge, expiresAt } = await issueChallenge(secret, eoaAddress);
+      return jsonResponse({
+        ok: true,
+        challenge,
+        message: buildChallengeMessage(eoaAddress, challenge),
+        expiresAt,
+      });
+    }
+    default:
+      throw new BadRequestError("Faucet challenges are not enabled.", "antibot_not_enabled");
+  }
+}
+
+export async function assertFaucetAntibot(
+  env: Env,
+  tracker: DurableObjectStub,
+  eoaAddress: string,
+  proof: FaucetAntibotProofModel | undefined
+): Promise<void> {
+  switch (resolveFaucetAntibotMode(env)) {
+    case "turnstile":
+      await verifyTurnstileToken(env, proof?.token);
+      return;
+    case "pow":
+      await verifyPowSolution(env, tracker, eoaAddress, proof?.challenge, proof?.solution);
+      return;
+    case "signature":
+      await verifyChallengeSignature(env, tracker, eoaAddress, proof?.challenge, proof?.signature);
+      return;
+    case "none":
+      return;
+  }
+}
+
+async function verifyTurnstileToken(env: Env, token: string | undefined): Promise<void> {
+  if (!token) {
+    throw new ForbiddenError("antibot.token is required.", "antibot_required");
+  }
+
+  const secret = resolveRequiredEnvValue(env.TURNSTILE_SECRET_KEY, "TURNSTILE_SECRET_KEY");
+  const form = new FormData();
+  form.append("secret", secret);
+  form.append("response", token);
+
+  const response = await fetch(TURNSTILE_VERIFY_URL, { method: "POST", body: form });
+  if (!response.ok) {
+    throw new Error(`Turnstile verification failed with status ${response.status}.`);
+  }
+
+  const outcome = (await response.json()) as { success?: boolean; "error-codes"?: string[] };
+  if (!outcome.success) {
+    const codes = outcome["error-codes"]?.join(",") || "unknown";
+    throw new ForbiddenError(`Turnstile verification failed: ${codes}`, "antibot_failed");
+  }
+}
+
+async function verifyPowSolution(
+  env: Env,
+  tracker: DurableObjectStub,
+  eoaAddress: string,
+  challenge: string | undefined,
+  solution: string | undefined
+): Promise<void> {
+  if (!challenge || !solution) {
+    throw new ForbiddenError("antibot.challenge and antibot.solution are required.", "antibot_required");
+  }
+
+  const secret = resolveRequiredEnvValue(env.FAUCET_POW_SECRET, "FAUCET_POW_SECRET");
+  const nonce = await checkChallenge(secret, challenge, eoaAddress, "Proof-of-work");
+
+  const digest = sha256(toBytes(`${challenge}:${eoaAddress}:${solution}`), "bytes");
+  if (countLeadingZeroBits(digest) < resolvePowDifficulty(env)) {
+    throw new ForbiddenError("Proof-of-work solution does not meet the difficulty.", "antibot_failed");
+  }
+
+  await consumeChallenge(tracker, `faucet-pow:${nonce}`, "Proof-of-work");
+}
+
+async function verifyChallengeSignature(
+  env: Env,
+  tracker: DurableObjectStub,
+  eoaAddress: string,
+  challenge: string | undefined,
+  signature: string | undefined
+): Promise<void> {
+  if (!challenge || !signature) {
+    throw new ForbiddenError("antibot.challenge and antibot.signature are required.", "antibot_required");
+  }
+
+  const secret = resolveRequiredEnvValue(env.FAUCET_SIGNATURE_SECRET, "FAUCET_SIGNATURE_SECRET");
+  const nonce = await checkChallenge(secret, challenge, eoaAddress, "Signature");
+
+  let signer: string;
+  try {
+    if (!isHex(signature)) {
+      throw new Error("signature is not hex");
+    }
+    signer = await recoverMessageAddress({ message: buildChallengeMessage(eoaAddress, challenge), signature });
+  } catch {
+    throw new ForbiddenError("Invalid challenge signature.", "antibot_failed");
+  }
+  if (signer.toLowerCase() !== eoaAddress) {
+    throw new ForbiddenError("Challenge was not signed by eoaAddress.", "antibot_failed");
+  }
+
+  await consumeChallenge(tracker, `faucet-signature:${nonce}`, "Signature");
+}
+
+// The EOA is mixed into the HMAC so a challenge issued for one EOA fails for any other.
+async function issueChallenge(secret: string, eoaAddress: string): Promise<{ challenge: string; expiresAt: string }> {
+  const issuedAt = Math.floor(Date.now() / 1000);
+  const payload = `${issuedAt}.${randomHex(16)}`;
+  return {
+    challenge: `${payload}.${await hmacHex(secret, buildChallengeMAC(payload, eoaAddress))}`,
+    expiresAt: new Date((issuedAt + CHALLENGE_TTL_SECONDS) * 1000).toISOString(),
+  };
+}
+
+// Returns the challenge nonce once the MAC and age check out.
+async function checkChallenge(secret: string, challenge: string, eoaAddress: string, kind: string): Promise<string> {
+  const [issuedAtRaw, nonce, mac] = challenge.split(".");
+  if (!issuedAtRaw || !nonce || !mac) {
+    throw new ForbiddenError(`Malformed ${kind.toLowerCase()} challenge.`, "antibot_failed");
+  }
+  if (!timingSafeEqual(mac, await hmacHex(secret, buildChallengeMAC(`${issuedAtRaw}.${nonce}`, eoaAddress)))) {
+    throw new ForbiddenError(`Invalid ${kind.toLowerCase()} challenge.`, "antibot_failed");
+  }
+
+  const age = Math.floor(Date.now() / 1000) - Number(issuedAtRaw);
+  if (!Number.isFinite(age) || age < 0 || age > CHALLENGE_TTL_SECONDS) {
+    throw new ForbiddenError(`${kind} challenge expired.`, "antibot_failed");
+  }
+  return nonce;
+}
+
+// The faucet Durable Object checks and records the nonce in one SQLite transaction, so two
+// concurrent requests cannot both spend the same challenge.
+async function consumeChallenge(tracker: DurableObjectStub, usedKey: string, kind: string): Promise<void> {
+  if (!(await consumeNonce(tracker, usedKey, CHALLENGE_TTL_SECONDS * 1000))) {
+    throw new ForbiddenError(`${kind} challenge was already used.`, "antibot_failed");
+  }
+}
+
+function buildChallengeMAC(payload: string, eoaAddress: string): string {
+  return `${payload}:${eoaAddress}`;
+}
+
+function buildChallengeMessage(eoaAddress: string, challenge: string): string {
+  return `knot faucet: I control ${eoaAddress}\nChallenge: ${challenge}`;
+}
+
+function parseChallengeEOA(value: string | null): string {
+  try {
+    return normalizeAddress(value ?? "");
+  } catch {
+    throw new BadRequestError("Invalid eoa.", "invalid_eoa");
+  }
+}
+
+function resolvePowDifficulty(env: Env): number {
+  return parseBoundedInteger(env.FAUCET_POW_DIFFICULTY ?? "20", 8, 32, 20);
+}
+
+export function countLeadingZeroBits(bytes: Uint8Array): number {
+  let bits = 0;
+  for (const byte of bytes) {
+    if (byte === 0) {
+      bits += 8;
+      continue;
+    }
+    return bits + Math.clz32(byte) - 24;
+  }
+  return bits;
+}
@@ -0,0 +1,44 @@
+import { describe, expect, it } from "bun:test";
+
+import { ServiceUnavailableError } from "../errors";
+import type { Env } from "../relay/models";
+
+import { resolveFaucetTokens } from "./config";
+
+const DAI = "0x68194a729C2450ad26072b3D33ADaCbcef39D574";
+const REWARD = "0x5FbDB2315678afecb367f032d93F642f64180aa3";
+
+const withTokens = (tokens: object) => ({ FAUCET_TOKENS: JSON.stringify(tokens) }) as Env;
+
+describe("resolveFaucetTokens", () => {
+  it("drips testnet USDC first, then the configured tokens", () => {
+    const env = withTokens({ 84532: [{ symbol: "DAI", address: DAI, decimals: 18, amount: "10" }] });
+    expect(resolveFaucetTokens(env, 84532).map((token) => token.symbol)).toEqual(["USDC", "DAI"]);
+    expect(resolveFaucetTokens(env, 11155111).map((token) => token.symbol)).toEqual(["USDC"]);
+  });
+
+  it("scales human amounts by each token's decimals", () => {
+    const env = withTokens({
+      84532: [
+        { symbol: "DAI", address: DAI, decimals: 18, amount: "2.5" },
+        { symbol: "RWD", address: REWARD, decimals: 6, amount: "2.5" },
+      ],
+    });
+    const [usdc, dai, reward] = resolveFaucetTokens(env, 84532);
+    expect(usdc.amountUnits).toBe(2_000_000n);
+    expect(dai.amountUnits).toBe(2_500_000_000_000_000_000n);
+    expect(reward.amountUnits).toBe(2_500_000n);
+  });
+
+  it("rejects entries it cannot drip", () => {
+    const entries = [
+      { symbol: "DAI", address: "0x1234", decimals: 18, amount: "10" },
+      { symbol: "DAI", address: DAI, decimals: 40, amount: "10" },
+      { symbol: "DAI", address: DAI, decimals: 18, amount: "0" },
+      { symbol: "DAI", address: DAI, decimals: 18, amount: "ten" },
+    ];
+    for (const entry of entries) {
+      expect(() => resolveFaucetTokens(withTokens({ 84532: [entry] }), 84532)).toThrow(ServiceUnavailableError);
+    }
+  });
+});
@@ -0,0 +1,350 @@
+import { type Address, type Chain, type Hex, getAddress, isAddress, parseUnits } from "viem";
+import { arbitrumSepolia, baseSepolia, sepolia } from "viem/chains";
+
+import { TESTNET_USDC_BY_CHAIN, USDC_DRIP_AMOUNT } from "../constants";
+import { ServiceUnavailableError } from "../errors";
+import type { Env } from "../relay/models";
+
+export const FAUCET_CHAINS: readonly Chain[] = [sepolia, baseSepolia, arbitrumSepolia];
+
+export interface FaucetToken {
+  symbol: string;
+  address: Address;
+  decimals: number;
+  amountUnits: bigint;
+}
+
+// ERC-20 drips for a chain: testnet USDC where known, then any FAUCET_TOKENS entries for the chain.
+// FAUCET_TOKENS is a JSON object of chain ID -> [{ symbol, address, decimals, amount }], where
+// `amount` is human-readable and scaled by `decimals` (e.g. "10" DAI -> 10 * 10^18).
+export function resolveFaucetTokens(env: Env, chainId: number): FaucetToken[] {
+  const tokens: FaucetToken[] = [];
+  const usdcAddress = resolveFaucetUsdcAddress(env, chainId);
+  if (usdcAddress) {
+    tokens.push({ symbol: "USDC", address: usdcAddress, decimals: 6, amountUnits: USDC_DRIP_AMOUNT });
+  }
+  return [...tokens, ...(parseFaucetTokenConfig(env).get(chainId) ?? [])];
+}
+
+// FAUCET_USDC_ADDRESSES is an optional JSON object of chain ID -> USDC address, for forks and
+// devnets that deploy their own mock USDC. Chains without an override keep Circle's testnet USDC.
+export function resolveFaucetUsdcAddress(env: Env, chainId: number): Address | undefined {
+  return parseFaucetUsdcOverrides(env).get(chainId) ?? TESTNET_USDC_BY_CHAIN[chainId];
+}
+
+function parseFaucetUsdcOverrides(env: Env): Map<number, Address> {
+  const raw = (env.FAUCET_USDC_ADDRESSES ?? "").trim();
+  const overrides = new Map<number, Address>();
+  if (!raw) {
+    return overrides;
+  }
+
+  let parsed: unknown;
+  try {
+    parsed = JSON.parse(raw);
+  } catch {
+    throw new ServiceUnavailableError("Invalid FAUCET_USDC_ADDRESSES: expected a JSON object.", "invalid_config");
+  }
+  if (!parsed || typeof parsed !== "object" || Array.isArray(parsed)) {
+    throw new ServiceUnavailableError("Invalid FAUCET_USDC_ADDRESSES: expected a JSON object.", "invalid_config");
+  }
+
+  for (const [key, value] of Object.entries(parsed)) {
+    const chainId = Number(key);
+    if (!Number.isSafeInteger(chainId) || chainId <= 0) {
+      throw new ServiceUnavailableError(`Invalid FAUCET_USDC_ADDRESSES chain id: ${key}`, "invalid_config");
+    }
+    if (typeof value !== "string" || !isAddress(value.trim(), { strict: false })) {
+      throw new ServiceUnavailableError(
+        `Invalid FAUCET_USDC_ADDRESSES address for chain ${chainId}.`,
+        "invalid_config"
+      );
+    }
+    overrides.set(chainId, getAddress(value.trim()));
+  }
+  return overrides;
+}
+
+function parseFaucetTokenConfig(env: Env): Map<number, FaucetToken[]> {
+  const raw = (env.FAUCET_TOKENS ?? "").trim();
+  const tokensByChain = new Map<number, FaucetToken[]>();
+  if (!raw) {
+    return tokensByChain;
+  }
+
+  let parsed: unknown;
+  try {
+    parsed = JSON.parse(raw);
+  } catch {
+    throw new ServiceUnavailableError("Invalid FAUCET_TOKENS: expected a JSON object.", "invalid_config");
+  }
+  if (!parsed || typeof parsed !== "object" || Array.isArray(parsed)) {
+    throw new ServiceUnavailableError("Invalid FAUCET_TOKENS: expected a JSON object.", "invalid_config");
+  }
+
+  for (const [key, entries] of Object.entries(parsed)) {
+    const chainId = Number(key);
+    if (!Number.isSafeInteger(chainId) || chainId <= 0 || !Array.isArray(entries)) {
+      throw new ServiceUnavailableError(`Invalid FAUCET_TOKENS entry for chain ${key}.`, "invalid_config");
+    }
+    tokensByChain.set(chainId, entries.map((entry) => parseFaucetToken(entry, chainId)));
+  }
+  return tokensByChain;
+}
+
+function parseFaucetToken(value: unknown, chainId: number): FaucetToken {
+  const entry = (value ?? {}) as { symbol?: unknown; address?: unknown; decimals?: unknown; amount?: unknown };
+  const symbol = typeof entry.symbol === "string" ? entry.symbol.trim() : "";
+  const address = typeof entry.address === "string" ? entry.address.trim() : "";
+  const decimals = entry.decimals;
+  const amount = typeof entry.amount === "string" ? entry.amount.trim() : "";
+
+  if (!/^[A-Za-z0-9]{1,16}$/.test(symbol) || !isAddress(address, { strict: false })) {
+    throw new ServiceUnavailableError(`Invalid FAUCET_TOKENS token for chain ${chainId}.`, "invalid_config");
+  }
+  if (typeof decimals !== "number" || !Number.isInteger(decimals) || decimals < 0 || decimals > 36) {
+    throw new ServiceUnavailableError(
+      `Invalid FAUCET_TOKENS decimals for ${symbol} on chain ${chainId}.`,
+      "invalid_config"
+    );
+  }
+
+  let amountUnits: bigint;
+  try {
+    amountUnits = parseUnits(amount, decimals);
+  } catch {
+    throw new ServiceUnavailableError(
+      `Invalid FAUCET_TOKENS amount for ${symbol} on chain ${chainId}.`,
+      "invalid_config"
+    );
+  }
+  if (amountUnits <= 0n) {
+    throw new ServiceUnavailableError(
+      `Invalid FAUCET_TOKENS amount for ${symbol} on chain ${chainId}.`,
+      "invalid_config"
+    );
+  }
+
+  return { symbol, address: getAddress(address), decimals, amountUnits };
+}
+
+export async function readFaucetPrivateKey(env: Env): Promise<Hex | null> {
+  const SERVER_KEY = await env.SERVER_KEY_STORE?.get();
+  if (!SERVER_KEY) {
+    return null;
+  }
+  return normalizeFaucetPrivateKey(SERVER_KEY);
+}
+
+export function normalizeFaucetPrivateKey(value: string): Hex {
+  const trimmed = value.trim().toLowerCase();
+  if (!trimmed) {
+    throw new ServiceUnavailableError("Faucet private key is not configured.", "faucet_not_configured");
+  }
+
+  const normalized = trimmed.startsWith("0x") ? trimmed : `0x${trimmed}`;
+  if (!/^0x[0-9a-f]{64}$/.test(normalized)) {
+    throw new ServiceUnavailableError("Invalid faucet private key.", "faucet_not_configured");
+  }
+  return normalized as Hex;
+}
+
+// FAUCET_RPC_URLS is an optional JSON object of chain ID -> http(s) RPC URL.
+// Chains without an override use viem's default public RPC.
+export function resolveFaucetRpcUrls(env: Env): Map<number, string> {
+  const raw = (env.FAUCET_RPC_URLS ?? "").trim();
+  const urls = new Map<number, string>();
+  if (!raw) {
+    return urls;
+  }
+
+  let parsed: unknown;
+  try {
+    parsed = JSON.parse(raw);
+  } catch {
+    throw new ServiceUnavailableError("Invalid FAUCET_RPC_URLS: expected a JSON object.", "invalid_config");
+  }
+  if (!parsed || typeof parsed !== "object" || Array.isArray(parsed)) {
+    throw new ServiceUnavailableError("Invalid FAUCET_RPC_URLS: expected a JSON object.", "invalid_config");
+  }
+
+  for (const [key, value] of Object.entries(parsed)) {
+    const chainId = Number(key);
+    if (!Number.isSafeInteger(chainId) || chainId <= 0) {
+      throw new ServiceUnavailableError(`Invalid FAUCET_RPC_URLS chain id: ${key}`, "invalid_config");
+    }
+    urls.set(chainId, parseRpcUrl(value, chainId));
+  }
+
+  return urls;
+}
+
+// FAUCET_DISABLED_CHAINS lists chain IDs (comma-separated) that start disabled, e.g. while an RPC
+// is broken. The admin toggle overrides this at runtime without a redeploy.
+export function resolveDisabledFaucetChains(env: Env): Set<number> {
+  const disabled = new Set<number>();
+  for (const entry of (env.FAUCET_DISABLED_CHAINS ?? "").split(",")) {
+    const trimmed = entry.trim();
+    if (!trimmed) {
+      continue;
+    }
+    const chainId = Number(trimmed);
+    if (!FAUCET_CHAINS.some((chain) => chain.id === chainId)) {
+      throw new ServiceUnavailableError(`Invalid FAUCET_DISABLED_CHAINS entry: ${trimmed}`, "invalid_config");
+    }
+    disabled.add(chainId);
+  }
+  return disabled;
+}
+
+// FAUCET_ALLOWED_EOAS (comma-separated) restricts funding to known addresses, e.g. the team on a
+// private testnet. Null when unset, which leaves the faucet open.
+export function resolveAllowedFaucetEOAs(env: Env): Set<string> | null {
+  const entries = (env.FAUCET_ALLOWED_EOAS ?? "")
+    .split(",")
+    .map((entry) => entry.trim())
+    .filter((entry) => entry !== "");
+  if (entries.length === 0) {
+    return null;
+  }
+
+  const allowed = new Set<string>();
+  for (const entry of entries) {
+    if (!isAddress(entry, { strict: false })) {
+      throw new ServiceUnavailableError(`Invalid FAUCET_ALLOWED_EOAS entry: ${entry}`, "invalid_config");
+    }
+    allowed.add(entry.toLowerCase());
+  }
+  return allowed;
+}
+
+// FAUCET_TOPUP_TARGETS switches drips to top-up mode: a JSON object of chain ID -> { symbol: target
+// balance }, human-readable like FAUCET_TOKENS amounts, e.g. {"84532":{"ETH":"0.02","USDC":"5"}}.
+// A listed token only sends what the recipient is short of its target; unlisted ones keep the
+// fixed drip.
+export function resolveFaucetTopUpTargets(env: Env): Map<number, Map<string, string>> {
+  const raw = (env.FAUCET_TOPUP_TARGETS ?? "").trim();
+  const targetsByChain = new Map<number, Map<string, string>>();
+  if (!raw) {
+    return targetsByChain;
+  }
+
+  let parsed: unknown;
+  try {
+    parsed = JSON.parse(raw);
+  } catch {
+    throw new ServiceUnavailableError("Invalid FAUCET_TOPUP_TARGETS: expected a JSON object.", "invalid_config");
+  }
+  if (!parsed || typeof parsed !== "object" || Array.isArray(parsed)) {
+    throw new ServiceUnavailableError("Invalid FAUCET_TOPUP_TARGETS: expected a JSON object.", "invalid_config");
+  }
+
+  for (const [key, entries] of Object.entries(parsed)) {
+    const chainId = Number(key);
+    if (!Number.isSafeInteger(chainId) || chainId <= 0 || !entries || typeof entries !== "object") {
+      throw new ServiceUnavailableError(`Invalid FAUCET_TOPUP_TARGETS entry for chain ${key}.`, "invalid_config");
+    }
+    const targets = new Map<string, string>();
+    for (const [symbol, target] of Object.entries(entries)) {
+      if (!/^[A-Za-z0-9]{1,16}$/.test(symbol) || typeof target !== "string" || !/^\d+(\.\d+)?$/.test(target.trim())) {
+        throw new ServiceUnavailableError(
+          `Invalid FAUCET_TOPUP_TARGETS target for ${symbol} on chain ${chainId}.`,
+          "invalid_config"
+        );
+      }
+      targets.set(symbol, target.trim());
+    }
+    targetsByChain.set(chainId, targets);
+  }
+  return targetsByChain;
+}
+
+export interface FaucetGasPriceBounds {
+  minWei: bigint | null;
+  maxWei: bigint | null;
+}
+
+// FAUCET_MIN_GAS_PRICE_WEI and FAUCET_MAX_GAS_PRICE_WEI are optional JSON objects of chain ID ->
+// wei, as decimal strings, e.g. {"84532":"1000000000"}. The floor keeps drips from stalling when
+// an RPC suggests a near-zero price; the cap bounds what a fee spike can cost.
+export function resolveFaucetGasPriceBounds(env: Env): Map<number, FaucetGasPriceBounds> {
+  const floors = parseChainWeiConfig(env.FAUCET_MIN_GAS_PRICE_WEI, "FAUCET_MIN_GAS_PRICE_WEI");
+  const caps = parseChainWeiConfig(env.FAUCET_MAX_GAS_PRICE_WEI, "FAUCET_MAX_GAS_PRICE_WEI");
+  const bounds = new Map<number, FaucetGasPriceBounds>();
+  for (const chainId of new Set([...floors.keys(), ...caps.keys()])) {
+    const minWei = floors.get(chainId) ?? null;
+    const maxWei = caps.get(chainId) ?? null;
+    if (minWei !== null && maxWei !== null && minWei > maxWei) {
+      throw new ServiceUnavailableError(
+        `FAUCET_MIN_GAS_PRICE_WEI exceeds FAUCET_MAX_GAS_PRICE_WEI for chain ${chainId}.`,
+        "invalid_config"
+      );
+    }
+    bounds.set(chainId, { minWei, maxWei });
+  }
+  return bounds;
+}
+
+function parseChainWeiConfig(value: string | undefined, name: string): Map<number, bigint> {
+  const raw = (value ?? "").trim();
+  const amounts = new Map<number, bigint>();
+  if (!raw) {
+    return amounts;
+  }
+
+  let parsed: unknown;
+  try {
+    parsed = JSON.parse(raw);
+  } catch {
+    throw new ServiceUnavailableError(`Invalid ${name}: expected a JSON object.`, "invalid_config");
+  }
+  if (!parsed || typeof parsed !== "object" || Array.isArray(parsed)) {
+    throw new ServiceUnavailableError(`Invalid ${name}: expected a JSON object.`, "invalid_config");
+  }
+
+  for (const [key, amount] of Object.entries(parsed)) {
+    const chainId = Number(key);
+    if (!Number.isSafeInteger(chainId) || chainId <= 0) {
+      throw new ServiceUnavailableError(`Invalid ${name} chain id: ${key}`, "invalid_config");
+    }
+    if (typeof amount !== "string" || !/^[1-9][0-9]{0,30}$/.test(amount.trim())) {
+      throw new ServiceUnavailableError(`Invalid ${name} entry for chain ${chainId}: expected wei.`, "invalid_config");
+    }
+    amounts.set(chainId, BigInt(amount.trim()));
+  }
+  return amounts;
+}
+
+export async function assertFaucetConfigured(env: Env): Promise<void> {
+  if (!env.SERVER_KEY_STORE) {
+    throw new ServiceUnavailableError("Missing required binding: SERVER_KEY_STORE", "faucet_not_configured");
+  }
+  if (!(await readFaucetPrivateKey(env))) {
+    throw new ServiceUnavailableError("Faucet private key is not configured.", "faucet_not_configured");
+  }
+  resolveFaucetRpcUrls(env);
+  parseFaucetTokenConfig(env);
+  parseFaucetUsdcOverrides(env);
+  resolveDisabledFaucetChains(env);
+  resolveFaucetGasPriceBounds(env);
+  resolveFaucetTopUpTargets(env);
+}
+
+function parseRpcUrl(value: unknown, chainId: number): string {
+  if (typeof value !== "string") {
+    throw new ServiceUnavailableError(`Invalid FAUCET_RPC_URLS entry for chain ${chainId}.`, "invalid_config");
+  }
+
+  try {
+    const url = new URL(value.trim());
+    if (url.protocol !== "https:" && url.protocol !== "http:") {
+      throw new Error("unsupported protocol");
+    }
+    return url.toString();
+  } catch {
+    throw new ServiceUnavailableError(
+      `Invalid FAUCET_RPC_URLS entry for chain ${chainId}: expected an http(s) URL.`,
+      "invalid_config"
+    );
+  }
+}
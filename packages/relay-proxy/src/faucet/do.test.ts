@@ -0,0 +1,252 @@
+import { describe, expect, it } from "bun:test";
+
+import { createDurableObjectState } from "../../test/durable-object";
+import { ScriptedFaucetTracker } from "../../test/faucet-tracker";
+import { createKVNamespace } from "../../test/kv";
+import type { Env } from "../relay/models";
+
+import { buildFaucetFundingKey, markFaucetPending, readFaucetFundingState } from "./marker";
+
+const RECIPIENT = "0x9965507d1a55bcc2695c58ba16fb37d819b0a4dc";
+const FUNDING_KEY = buildFaucetFundingKey(RECIPIENT, "LIMITED_TESTNET");
+
+function trackerEnv(vars: Partial<Env> = {}): Env {
+  return {
+    FAUCET_FUNDING_KV: createKVNamespace(),
+    // Hardhat account 7.
+    SERVER_KEY_STORE: { get: async () => "0x4bbbf85ce3377467afe5d46f804f221813b2bb87f24d81f60f1fcdbf7cbf4356" },
+    ...vars,
+  } as Env;
+}
+
+interface TransferAnswer {
+  status: string;
+  nonceCorrected?: boolean;
+  confirmations?: number;
+}
+
+// The fields these tests read from /fund and /jobs/:id answers.
+interface TrackerAnswer {
+  status?: string;
+  jobID?: string;
+  state?: string;
+  chains?: { status: string; reason?: string; transfers: TransferAnswer[] }[];
+}
+
+async function call(tracker: ScriptedFaucetTracker, path: string, body?: object): Promise<TrackerAnswer> {
+  const init = body ? { method: "POST", body: JSON.stringify(body) } : { method: "GET" };
+  const response = await tracker.fetch(new Request(`http://do${path}`, init));
+  return (await response.json()) as TrackerAnswer;
+}
+
+// Queues a job the way the worker does (pending marker first), then runs it.
+async function fundOnce(tracker: ScriptedFaucetTracker, env: Env) {
+  await markFaucetPending(env.FAUCET_FUNDING_KV!, FUNDING_KEY);
+  const queued = await call(tracker, "/fund", { recipientAddress: RECIPIENT, fundingKey: FUNDING_KEY });
+  await tracker.alarm();
+  return await call(tracker, `/jobs/${queued.jobID}`);
+}
+
+describe("FaucetTracker dry run", () => {
+  it("signs every transfer without broadcasting and leaves the EOA unfunded", async () => {
+    const env = trackerEnv({ FAUCET_DRY_RUN: "true" });
+    const tracker = new ScriptedFaucetTracker(createDurableObjectState(), env);
+
+    const job = await fundOnce(tracker, env);
+    expect(job.state).toBe("funded");
+    const transfers = job.chains?.flatMap((chain) => chain.transfers) ?? [];
+    expect(transfers.map((transfer) => transfer.status)).toEqual(Array(6).fill("simulated"));
+    expect(tracker.rpc.sent.length).toBe(0);
+    expect(tracker.rpc.signed.length).toBe(6);
+
+    await expect(readFaucetFundingState(env.FAUCET_FUNDING_KV!, FUNDING_KEY)).resolves.toBe(null);
+    const again = await call(tracker, "/fund", { recipientAddress: RECIPIENT, fundingKey: FUNDING_KEY });
+    expect(again.status).toBe("queued");
+  });
+
+  it("marks a real run as funded so the next request is vetoed", async () => {
+    const env = trackerEnv();
+    const tracker = new ScriptedFaucetTracker(createDurableObjectState(), env);
+
+    await fundOnce(tracker, env);
+    expect(tracker.rpc.sent.length).toBe(6);
+    const marker = await readFaucetFundingState(env.FAUCET_FUNDING_KV!, FUNDING_KEY);
+    expect(marker?.state).toBe("funded");
+    const again = await call(tracker, "/fund", { recipientAddress: RECIPIENT, fundingKey: FUNDING_KEY });
+    expect(again.status).toBe("already_funded");
+  });
+});
+
+describe("FaucetTracker duplicate submissions", () => {
+  it("runs one funding job for two concurrent requests for the same EOA", async () => {
+    const env = trackerEnv();
+    const tracker = new ScriptedFaucetTracker(createDurableObjectState(), env);
+    const request = { recipientAddress: RECIPIENT, fundingKey: FUNDING_KEY };
+
+    const [first, second] = await Promise.all([call(tracker, "/fund", request), call(tracker, "/fund", request)]);
+    expect([first.status, second.status].sort()).toEqual(["in_progress", "queued"]);
+    expect(second.jobID).toBe(first.jobID);
+
+    await tracker.alarm();
+    await tracker.alarm();
+    expect(tracker.rpc.sent.length).toBe(6);
+  });
+
+  it("points a request that arrives mid-run at the running job", async () => {
+    const env = trackerEnv();
+    const tracker = new ScriptedFaucetTracker(createDurableObjectState(), env);
+    const request = { recipientAddress: RECIPIENT, fundingKey: FUNDING_KEY };
+    const queued = await call(tracker, "/fund", request);
+
+    const run = tracker.alarm();
+    const duplicate = (await call(tracker, "/fund", request)) as TrackerAnswer & { running?: boolean };
+    await run;
+    expect(duplicate).toMatchObject({ status: "in_progress", jobID: queued.jobID, running: true });
+  });
+});
+
+describe("FaucetTracker funding report", () => {
+  it("separates succeeded, failed and skipped chains", async () => {
+    const env = trackerEnv({ FAUCET_DISABLED_CHAINS: "421614" });
+    const tracker = new ScriptedFaucetTracker(createDurableObjectState(), env);
+    tracker.rpc.rejections.set(84532, ["insufficient funds for gas"]);
+
+    await fundOnce(tracker, env);
+    const marker = await readFaucetFundingState(env.FAUCET_FUNDING_KV!, FUNDING_KEY);
+    expect(marker?.report).toMatchObject({
+      configured: [11155111, 84532, 421614],
+      attempted: [11155111, 84532],
+      succeeded: [11155111],
+      failed: [{ chainId: 84532, reason: "USDC transfer failed: insufficient funds for gas" }],
+      skipped: [{ chainId: 421614, reason: "disabled" }],
+    });
+    expect(marker?.report?.chains.map((chain) => chain.status)).toEqual(["succeeded", "failed", "skipped"]);
+  });
+});
+
+describe("FaucetTracker chain toggles", () => {
+  it("skips a chain disabled at runtime while the others are funded", async () => {
+    const env = trackerEnv();
+    const tracker = new ScriptedFaucetTracker(createDurableObjectState(), env);
+    await call(tracker, "/chains/toggle", { chainId: 84532, enabled: false });
+
+    const job = await fundOnce(tracker, env);
+    expect(job.state).toBe("funded");
+    expect(job.chains?.map((chain) => [chain.status, chain.reason])).toEqual([
+      ["succeeded", undefined],
+      ["skipped", "disabled"],
+      ["succeeded", undefined],
+    ]);
+    expect(tracker.rpc.calls.includes(84532)).toBe(false);
+  });
+
+  it("lets a runtime toggle re-enable a chain FAUCET_DISABLED_CHAINS turned off", async () => {
+    const env = trackerEnv({ FAUCET_DISABLED_CHAINS: "84532" });
+    const tracker = new ScriptedFaucetTracker(createDurableObjectState(), env);
+    const toggled = (await call(tracker, "/chains/toggle", { chainId: 84532 })) as { enabled?: boolean };
+    expect(toggled.enabled).toBe(true);
+
+    const job = await fundOnce(tracker, env);
+    expect(job.chains?.every((chain) => chain.status === "succeeded")).toBe(true);
+  });
+});
+
+describe("FaucetTracker nonce recovery", () => {
+  it("retries a nonce-too-low send once with the pending nonce", async () => {
+    const env = trackerEnv();
+    const tracker = new ScriptedFaucetTracker(createDurableObjectState(), env);
+    tracker.rpc.rejections.set(11155111, ["nonce too low: next nonce 3, tx nonce 2"]);
+
+    const job = await fundOnce(tracker, env);
+    expect(job.state).toBe("funded");
+    const [usdc, eth] = job.chains?.[0].transfers ?? [];
+    expect(usdc).toMatchObject({ status: "sent", nonceCorrected: true });
+    expect(eth.nonceCorrected).toBe(undefined);
+    expect(tracker.rpc.sent.filter((tx) => tx.chainId === 11155111).map((tx) => tx.nonce)).toEqual([0, undefined]);
+  });
+
+  it("reports the transfer as failed when the retry conflicts too", async () => {
+    const env = trackerEnv();
+    const tracker = new ScriptedFaucetTracker(createDurableObjectState(), env);
+    tracker.rpc.rejections.set(11155111, ["nonce too low", "replacement transaction underpriced"]);
+
+    const job = await fundOnce(tracker, env);
+    expect(job.chains?.[0]).toMatchObject({
+      status: "failed",
+      reason: "USDC transfer failed: replacement transaction underpriced",
+    });
+  });
+});
+
+describe("FaucetTracker metrics snapshot", () => {
+  it("counts every chain of every job when requests arrive together", async () => {
+    const env = trackerEnv();
+    const tracker = new ScriptedFaucetTracker(createDurableObjectState(), env);
+    // The first job's USDC transfer on Base Sepolia is refused; every other transfer goes through.
+    tracker.rpc.rejections.set(84532, ["insufficient funds for gas"]);
+
+    const recipients = [1, 2, 3, 4].map((n) => `0x${n.toString(16).padStart(40, "0")}`);
+    await Promise.all(
+      recipients.map((recipientAddress) =>
+        call(tracker, "/fund", {
+          recipientAddress,
+          fundingKey: buildFaucetFundingKey(recipientAddress, "LIMITED_TESTNET"),
+        })
+      )
+    );
+    for (const _ of recipients) {
+      await tracker.alarm();
+    }
+
+    const response = await tracker.fetch(new Request("http://do/metrics"));
+    const { chains } = (await response.json()) as {
+      chains: { chainId: number; succeeded: number; failed: number; lastError: string | null }[];
+    };
+    expect(chains.map(({ chainId, succeeded, failed }) => [chainId, succeeded, failed])).toEqual([
+      [11155111, 4, 0],
+      [84532, 3, 1],
+      [421614, 4, 0],
+    ]);
+    expect(chains[1].lastError).toBe("USDC transfer failed: insufficient funds for gas");
+  });
+});
+
+describe("FaucetTracker confirmations", () => {
+  it("waits until every sent transfer is buried under FAUCET_CONFIRMATIONS blocks", async () => {
+    const env = trackerEnv({ FAUCET_CONFIRMATIONS: "3" });
+    const tracker = new ScriptedFaucetTracker(createDurableObjectState(), env);
+
+    const job = await fundOnce(tracker, env);
+    expect(job.state).toBe("funded");
+    const transfers = job.chains?.flatMap((chain) => chain.transfers) ?? [];
+    expect(transfers.length).toBe(6);
+    expect(transfers.every((transfer) => (transfer.confirmations ?? 0) >= 3)).toBe(true);
+    expect([...tracker.rpc.heads.values()].every((head) => head >= 4n)).toBe(true);
+  });
+
+  it("reports no depth when confirmations are off", async () => {
+    const env = trackerEnv();
+    const tracker = new ScriptedFaucetTracker(createDurableObjectState(), env);
+
+    const job = await fundOnce(tracker, env);
+    const transfers = job.chains?.flatMap((chain) => chain.transfers) ?? [];
+    expect(transfers.some((transfer) => transfer.confirmations !== undefined)).toBe(false);
+  });
+});
+
+describe("FaucetTracker job deadline", () => {
+  it("fails every chain still waiting when the job runs out of time", async () => {
+    const env = trackerEnv({ FAUCET_JOB_TIMEOUT_SECONDS: "1" });
+    const tracker = new ScriptedFaucetTracker(createDurableObjectState(), env);
+    tracker.rpc.stalled.add(11155111);
+
+    const job = await fundOnce(tracker, env);
+    expect(job.state).toBe("failed");
+    expect(job.chains?.map((chain) => chain.reason)).toEqual(
+      Array(3).fill("chain funding aborted: job deadline exceeded")
+    );
+    // Only the stalled chain reached the RPC; the others were cancelled before their first call.
+    expect(new Set(tracker.rpc.calls)).toEqual(new Set([11155111]));
+    await expect(readFaucetFundingState(env.FAUCET_FUNDING_KV!, FUNDING_KEY)).resolves.toBe(null);
+  });
+});
@@ -2,138 +2,1083 @@ import { DurableObject } from "cloudflare:workers";
 import {
   createWalletClient,
   encodeFunctionData,
+  formatEther,
+  formatUnits,
   getAddress,
   http,
+  keccak256,
+  parseUnits,
   publicActions,
   type Address,
   type Chain,
   type Hex,
 } from "viem";
 import { privateKeyToAccount } from "viem/accounts";
-import { arbitrumSepolia, baseSepolia, sepolia } from "viem/chains";
 
 import {
+  ERC20_BALANCE_OF_ABI,
   ERC20_TRANSFER_ABI,
+  ERC20_TRANSFER_GAS_FALLBACK,
   ETH_DRIP_WEI,
-  TESTNET_USDC_BY_CHAIN,
-  USDC_DRIP_AMOUNT,
+  FAUCET_FUNDED_TTL_SECONDS,
+  FAUCET_JOB_STATUS_TTL_SECONDS,
+  NATIVE_TRANSFER_GAS_FALLBACK,
 } from "../constants";
-import { BadRequestError } from "../errors";
-import type { Env } from "../relay/models";
-import { jsonResponse } from "../utils";
+import { sleep } from "../http";
+import { recordMetric } from "../metrics";
+import { SqliteUsedNonceStore, type UsedNonceStore, handleConsumeNonce } from "../nonce-store";
+import type {
+  Env,
+  FaucetChainResultModel,
+  FaucetFundingReportModel,
+  FaucetTransferResultModel,
+} from "../relay/models";
+import { type Span, Tracer } from "../tracing";
+import { formatNativeToken, jsonResponse, parseBooleanFlag, parseBoundedInteger, parseUsdToWei } from "../utils";
 
-const FAUCET_CHAINS: readonly Chain[] = [sepolia, baseSepolia, arbitrumSepolia];
+import {
+  FAUCET_CHAINS,
+  type FaucetToken,
+  readFaucetPrivateKey,
+  resolveDisabledFaucetChains,
+  resolveFaucetGasPriceBounds,
+  resolveFaucetRpcUrls,
+  resolveFaucetTokens,
+  resolveFaucetTopUpTargets,
+  resolveFaucetUsdcAddress,
+} from "./config";
+import { clampFees, resolveTopUpShortfall } from "./fees";
+import { markFaucetFunded, resolveFaucetFundingKV } from "./marker";
+import {
+  type FaucetFundingStore,
+  type FaucetJob,
+  type FaucetJobQueue,
+  type FaucetJobStatus,
+  type FaucetJobStatusStore,
+  SqliteFaucetFundingStore,
+  SqliteFaucetJobQueue,
+  SqliteFaucetJobStatusStore,
+} from "./store";
+
+const USDC_DECIMALS = 6;
+const CHAIN_TOGGLES_KEY = "chain-toggles";
+const MAINTENANCE_KEY = "maintenance-mode";
+
+type FaucetAccount = ReturnType<typeof privateKeyToAccount>;
+type FaucetClient = ReturnType<typeof createFaucetClient>;
+
+interface FaucetTransferRequest {
+  to: Address;
+  data?: Hex;
+  value?: bigint;
+  maxFeePerGas?: bigint;
+  maxPriorityFeePerGas?: bigint;
+}
+
+type FaucetFeeOverrides = Pick<FaucetTransferRequest, "maxFeePerGas" | "maxPriorityFeePerGas">;
+
+interface FaucetBalanceSnapshot {
+  nativeWei: bigint;
+  usdcUnits: bigint | null;
+  fetchedAt: number;
+}
+
+interface FaucetChainStats {
+  succeeded: number;
+  failed: number;
+  skipped: number;
+  lastSuccessAt: number | null;
+  lastErrorAt: number | null;
+  lastError: string | null;
+}
+
+interface FaucetBalanceFloors {
+  nativeWei: bigint;
+  usdcUnits: bigint;
+}
+
+function createFaucetClient(chain: Chain, account: FaucetAccount, rpcUrl?: string, signal?: AbortSignal) {
+  return createWalletClient({
+    account,
+    chain,
+    transport: http(rpcUrl, signal ? { fetchOptions: { signal } } : undefined),
+  }).extend(publicActions);
+}
 
 export class FaucetTracker extends DurableObject<Env> {
+  private readonly balanceCache = new Map<number, FaucetBalanceSnapshot>();
+  private readonly verifiedRpcChains = new Set<number>();
+  // In-memory only: a restart or eviction resets the counters, which is fine for an at-a-glance view.
+  private readonly chainStats = new Map<number, FaucetChainStats>();
+  private readonly statsSince = Date.now();
+  private runningJobID: number | null = null;
+  private readonly fundingStore: FaucetFundingStore;
+  private readonly jobQueue: FaucetJobQueue;
+  private readonly jobStatuses: FaucetJobStatusStore;
+  private readonly usedChallenges: UsedNonceStore;
+  private cachedAccount?: { privateKey: Hex; account: FaucetAccount };
+
+  constructor(ctx: DurableObjectState, env: Env) {
+    super(ctx, env);
+    this.fundingStore = new SqliteFaucetFundingStore(ctx.storage.sql);
+    this.jobQueue = new SqliteFaucetJobQueue(ctx.storage.sql);
+    this.jobStatuses = new SqliteFaucetJobStatusStore(ctx.storage.sql);
+    this.usedChallenges = new SqliteUsedNonceStore(ctx.storage);
+  }
+
   async fetch(request: Request): Promise<Response> {
     const url = new URL(request.url);
 
+    if (request.method === "GET" && url.pathname === "/status") {
+      return await this.handleStatus();
+    }
+
+    if (request.method === "GET" && url.pathname === "/metrics") {
+      return this.handleMetrics();
+    }
+
+    if (request.method === "POST" && url.pathname === "/chains/toggle") {
+      return await this.handleChainToggle(request);
+    }
+
+    // Antibot challenges are single-use; see consumeChallenge.
+    if (request.method === "POST" && url.pathname === "/nonces/consume") {
+      return await handleConsumeNonce(request, this.usedChallenges);
+    }
+
+    if (url.pathname === "/maintenance") {
+      return await this.handleMaintenance(request);
+    }
+
+    if (request.method === "GET" && url.pathname.startsWith("/jobs/")) {
+      return await this.handleJobStatus(decodeURIComponent(url.pathname.slice("/jobs/".length)));
+    }
+
     if (request.method !== "POST" || url.pathname !== "/fund") {
       return jsonResponse({ ok: false, error: "not_found" }, 404);
     }
 
-    let payload: { recipientAddress: string };
+    let payload: { recipientAddress: string; fundingKey: string };
     try {
-      payload = (await request.json()) as { recipientAddress: string };
+      payload = (await request.json()) as { recipientAddress: string; fundingKey: string };
     } catch {
       return jsonResponse({ ok: false, error: "invalid_json" }, 400);
     }
 
-    if (!payload.recipientAddress) {
+    if (!payload.recipientAddress || !payload.fundingKey) {
       return jsonResponse({ ok: false, error: "missing_recipient" }, 400);
     }
 
-    const SERVER_KEY = await this.env.SERVER_KEY_STORE?.get()
-    if (!SERVER_KEY) {
+    const faucetAccount = await this.resolveFaucetAccount();
+    if (!faucetAccount) {
       return jsonResponse({ ok: false, error: "server_key_not_configured" }, 503);
     }
 
-    const faucetPrivateKey = this.normalizePrivateKey(SERVER_KEY);
-    const faucetAccount = privateKeyToAccount(faucetPrivateKey);
+    const lastFundedAt = await this.fundingStore.lastFunded(payload.recipientAddress);
+    if (lastFundedAt !== null && Date.now() - lastFundedAt < resolveFundingCooldownMs(this.env)) {
+      return jsonResponse({ ok: true, status: "already_funded", fundedAt: new Date(lastFundedAt).toISOString() });
+    }
+
+    // A duplicate submission (e.g. a client retry racing the first request past the KV marker)
+    // joins the job that already exists instead of starting a second funding run.
+    const inFlight = await this.jobQueue.find(payload.recipientAddress);
+    if (inFlight) {
+      return this.inProgressResponse(inFlight);
+    }
+
+    const chains = await this.resolveFundableChains();
+    if (chains.length === 0) {
+      return jsonResponse({ ok: false, error: "faucet_depleted" }, 503);
+    }
+
+    // Admission is decided here, synchronously, so the worker can turn a full queue into a 503
+    // instead of accepting work it cannot start.
+    const depth = await this.jobQueue.depth();
+    if (depth >= resolveQueueMaxDepth(this.env)) {
+      recordMetric(this.env, "faucet_queue_depth", { result: "full" }, depth);
+      return jsonResponse({ ok: false, error: "faucet_queue_full", queueDepth: depth }, 503);
+    }
+
+    const enqueuedAt = Date.now();
+    const jobID = crypto.randomUUID();
+    const queued = await this.jobQueue.enqueue({
+      jobID,
+      recipientAddress: payload.recipientAddress,
+      fundingKey: payload.fundingKey,
+      traceparent: request.headers.get("traceparent"),
+      enqueuedAt,
+    });
+    // The checks above wait on the key store and RPC reads, which let a concurrent duplicate in;
+    // the queue keeps one job per recipient, so the later request joins the earlier one.
+    if (queued.jobID !== jobID) {
+      return this.inProgressResponse(queued);
+    }
+    await this.saveJobStatus({
+      jobID,
+      recipientAddress: payload.recipientAddress,
+      state: "queued",
+      chains: [],
+      error: null,
+      createdAt: enqueuedAt,
+      updatedAt: enqueuedAt,
+    });
+    if ((await this.ctx.storage.getAlarm()) === null) {
+      await this.ctx.storage.setAlarm(Date.now());
+    }
+
+    const queueDepth = await this.jobQueue.depth();
+    recordMetric(this.env, "faucet_queue_depth", { result: "enqueued" }, queueDepth);
+    return jsonResponse({ ok: true, status: "queued", jobID, queueDepth, chains }, 202);
+  }
+
+  private inProgressResponse(job: FaucetJob): Response {
+    return jsonResponse({
+      ok: true,
+      status: "in_progress",
+      jobID: job.jobID,
+      running: this.runningJobID === job.id,
+      enqueuedAt: new Date(job.enqueuedAt).toISOString(),
+    });
+  }
+
+  // Drains the queue one job per alarm. All jobs sign from the same faucet account, so a single
+  // worker is what keeps nonces from colliding. Jobs live in SQLite: a deploy or eviction only
+  // delays them, and the next alarm picks up where the last one stopped.
+  async alarm(): Promise<void> {
+    const job = await this.jobQueue.next();
+    if (!job) {
+      return;
+    }
+
+    try {
+      this.runningJobID = job.id;
+      await this.runFundingJob(job);
+    } finally {
+      this.runningJobID = null;
+      await this.jobQueue.remove(job.id);
+      const depth = await this.jobQueue.depth();
+      recordMetric(this.env, "faucet_queue_depth", { result: "drained" }, depth);
+      if (depth > 0) {
+        await this.ctx.storage.setAlarm(Date.now());
+      }
+    }
+  }
+
+  private async runFundingJob(job: FaucetJob): Promise<void> {
+    const kv = resolveFaucetFundingKV(this.env);
+    // The worker's span context is stored with the job so per-chain spans join the request's trace.
+    const tracer = new Tracer(this.env, job.traceparent);
+    const span = tracer.startSpan("faucet.tracker.fund", {
+      "faucet.recipient": job.recipientAddress,
+      "faucet.queue_wait_ms": Date.now() - job.enqueuedAt,
+    });
+
+    // A job that waited longer than the status TTL starts a fresh entry under the same ID.
+    const status = (await this.jobStatuses.get(job.jobID)) ?? {
+      jobID: job.jobID,
+      recipientAddress: job.recipientAddress,
+      state: "queued",
+      chains: [],
+      error: null,
+      createdAt: job.enqueuedAt,
+      updatedAt: job.enqueuedAt,
+    };
+    const updateStatus = async (update: Partial<Pick<FaucetJobStatus, "state" | "chains" | "error">>) => {
+      Object.assign(status, update);
+      await this.saveJobStatus({ ...status, updatedAt: Date.now() });
+    };
+
+    const jobDeadline = new AbortController();
+    const jobTimer = setTimeout(
+      () => jobDeadline.abort(new Error("job deadline exceeded")),
+      resolveJobTimeoutMs(this.env)
+    );
+
+    try {
+      await updateStatus({ state: "running" });
+      const faucetAccount = await this.resolveFaucetAccount();
+      if (!faucetAccount) {
+        throw new Error("Faucet key is not configured.");
+      }
+
+      // Re-checked at run time: an earlier job for the same EOA may have funded it meanwhile.
+      const lastFundedAt = await this.fundingStore.lastFunded(job.recipientAddress);
+      if (lastFundedAt !== null && Date.now() - lastFundedAt < resolveFundingCooldownMs(this.env)) {
+        await markFaucetFunded(kv, job.fundingKey, undefined);
+        await updateStatus({ state: "already_funded" });
+        span.setAttribute("faucet.result", "already_funded");
+        span.end();
+        return;
+      }
+
+      // Process all chains sequentially to avoid nonce collisions. The job deadline caps the whole
+      // run so a string of slow chains cannot hold the queue for chains x FAUCET_CHAIN_TIMEOUT_SECONDS.
+      const report = await this.fundAccount(
+        job.recipientAddress,
+        faucetAccount,
+        span,
+        (chains) => updateStatus({ chains }),
+        jobDeadline.signal
+      );
+      if (report.succeeded.length === 0) {
+        throw new Error(`No chain was funded (failed: ${report.failed.length}, skipped: ${report.skipped.length}).`);
+      }
+      if (parseBooleanFlag(this.env.FAUCET_DRY_RUN, false)) {
+        // Nothing was broadcast, so nothing is recorded as funded; clearing the pending marker lets
+        // the same EOA be simulated again.
+        await kv.delete(job.fundingKey);
+      } else {
+        await this.fundingStore.recordFunding(job.recipientAddress, Date.now());
+        await markFaucetFunded(kv, job.fundingKey, report);
+      }
+      await updateStatus({ state: "funded" });
+      span.setAttribute("faucet.result", "funded");
+      span.setAttribute("faucet.chains_succeeded", report.succeeded.length);
+      span.end();
+    } catch (error) {
+      // Clearing the pending marker lets the user retry.
+      const reason = error instanceof Error ? error.message : "unknown faucet error";
+      console.error("faucet funding failed", reason);
+      await kv.delete(job.fundingKey);
+      await updateStatus({ state: "failed", error: reason });
+      span.setAttribute("faucet.result", "failed");
+      span.end(error);
+    } finally {
+      clearTimeout(jobTimer);
+      await tracer.flush();
+    }
+  }
+
+  private async handleJobStatus(jobID: string): Promise<Response> {
+    const status = await this.jobStatuses.get(jobID);
+    if (!status) {
+      return jsonResponse({ ok: false, error: "job_not_found" }, 404);
+    }
+
+    return jsonResponse({
+      ok: true,
+      jobID: status.jobID,
+      eoaAddress: getAddress(status.recipientAddress),
+      state: status.state,
+      progress: {
+        total: FAUCET_CHAINS.length,
+        completed: status.chains.length,
+        succeeded: status.chains.filter((chain) => chain.status === "succeeded").length,
+      },
+      chains: status.chains,
+      error: status.error,
+      createdAt: new Date(status.createdAt).toISOString(),
+      updatedAt: new Date(status.updatedAt).toISOString(),
+    });
+  }
+
+  private async saveJobStatus(status: FaucetJobStatus): Promise<void> {
+    await this.jobStatuses.save(status, FAUCET_JOB_STATUS_TTL_SECONDS * 1000);
+  }
+
+  // Toggles live in Durable Object storage: every worker isolate talks to this one instance, and
+  // its input gate makes the read-modify-write below atomic without extra locking.
+  private async handleChainToggle(request: Request): Promise<Response> {
+    let payload: { chainId?: number; enabled?: boolean };
+    try {
+      payload = (await request.json()) as { chainId?: number; enabled?: boolean };
+    } catch {
+      return jsonResponse({ ok: false, error: "invalid_json" }, 400);
+    }
+
+    const chainId = Number(payload.chainId);
+    if (!FAUCET_CHAINS.some((chain) => chain.id === chainId)) {
+      return jsonResponse({ ok: false, error: "unknown_chain" }, 404);
+    }
+
+    const enabled = payload.enabled ?? !(await this.isChainEnabled(chainId));
+    const toggles = (await this.ctx.storage.get<Record<string, boolean>>(CHAIN_TOGGLES_KEY)) ?? {};
+    await this.ctx.storage.put(CHAIN_TOGGLES_KEY, { ...toggles, [chainId]: enabled });
+    console.warn(`faucet chain ${chainId} ${enabled ? "enabled" : "disabled"} by admin`);
+    return jsonResponse({ ok: true, chainId, enabled });
+  }
+
+  // The maintenance flag lives here for the same reason as chain toggles: this instance is the
+  // one strongly consistent store every isolate shares.
+  private async handleMaintenance(request: Request): Promise<Response> {
+    if (request.method === "GET") {
+      return jsonResponse({ enabled: (await this.ctx.storage.get<boolean>(MAINTENANCE_KEY)) ?? false });
+    }
+
+    let payload: { enabled?: boolean };
+    try {
+      payload = (await request.json()) as { enabled?: boolean };
+    } catch {
+      return jsonResponse({ ok: false, error: "invalid_json" }, 400);
+    }
+
+    const enabled = payload.enabled ?? !((await this.ctx.storage.get<boolean>(MAINTENANCE_KEY)) ?? false);
+    await this.ctx.storage.put(MAINTENANCE_KEY, enabled);
+    console.warn(`maintenance mode ${enabled ? "enabled" : "disabled"} by admin`);
+    return jsonResponse({ ok: true, enabled });
+  }
+
+  // Chains a new job is expected to fund: enabled, and not known to be below the balance floor.
+  // Only cached balances are consulted so admission never waits on an RPC; the job re-checks
+  // live balances when it runs.
+  private async resolveFundableChains(): Promise<number[]> {
+    const floors = resolveBalanceFloors(this.env);
+    const chains: number[] = [];
+    for (const chain of FAUCET_CHAINS) {
+      const cached = this.balanceCache.get(chain.id);
+      if ((await this.isChainEnabled(chain.id)) && !(cached && isBelowBalanceFloor(cached, floors))) {
+        chains.push(chain.id);
+      }
+    }
+    return chains;
+  }
+
+  // A runtime toggle wins over FAUCET_DISABLED_CHAINS, so an admin can re-enable a chain the
+  // config disabled and vice versa.
+  private async isChainEnabled(chainId: number): Promise<boolean> {
+    const toggles = await this.ctx.storage.get<Record<string, boolean>>(CHAIN_TOGGLES_KEY);
+    const toggled = toggles?.[chainId];
+    return toggled ?? !resolveDisabledFaucetChains(this.env).has(chainId);
+  }
+
+  private handleMetrics(): Response {
+    const chains = FAUCET_CHAINS.map((chain) => {
+      const stats = this.chainStats.get(chain.id);
+      return {
+        chainId: chain.id,
+        succeeded: stats?.succeeded ?? 0,
+        failed: stats?.failed ?? 0,
+        skipped: stats?.skipped ?? 0,
+        lastSuccessAt: formatTimestamp(stats?.lastSuccessAt),
+        lastErrorAt: formatTimestamp(stats?.lastErrorAt),
+        lastError: stats?.lastError ?? null,
+      };
+    });
+    return jsonResponse({ ok: true, since: new Date(this.statsSince).toISOString(), chains });
+  }
+
+  // The object handles one event at a time, so these read-modify-write updates never interleave.
+  private recordChainResult(result: FaucetChainResultModel): void {
+    const stats = this.chainStats.get(result.chainId) ?? {
+      succeeded: 0,
+      failed: 0,
+      skipped: 0,
+      lastSuccessAt: null,
+      lastErrorAt: null,
+      lastError: null,
+    };
+    switch (result.status) {
+      case "succeeded":
+        stats.succeeded += 1;
+        stats.lastSuccessAt = Date.now();
+        break;
+      case "failed":
+        stats.failed += 1;
+        stats.lastErrorAt = Date.now();
+        stats.lastError = result.reason ?? "unknown";
+        break;
+      case "skipped":
+        stats.skipped += 1;
+        break;
+    }
+    this.chainStats.set(result.chainId, stats);
+  }
+
+  private async handleStatus(): Promise<Response> {
+    const faucetAccount = await this.resolveFaucetAccount();
+    if (!faucetAccount) {
+      return jsonResponse({ ok: false, error: "server_key_not_configured" }, 503);
+    }
+
+    const floors = resolveBalanceFloors(this.env);
+    const chains = await Promise.all(
+      FAUCET_CHAINS.map(async (chain) => {
+        const enabled = await this.isChainEnabled(chain.id);
+        try {
+          const snapshot = await this.readFaucetBalances(chain, faucetAccount);
+          return {
+            chainId: chain.id,
+            enabled,
+            nativeBalance: formatNativeToken(snapshot.nativeWei),
+            usdcBalance: snapshot.usdcUnits === null ? undefined : formatUnits(snapshot.usdcUnits, USDC_DECIMALS),
+            depleted: isBelowBalanceFloor(snapshot, floors),
+            checkedAt: new Date(snapshot.fetchedAt).toISOString(),
+          };
+        } catch (error) {
+          const reason = error instanceof Error ? error.message : "unknown balance lookup error";
+          return { chainId: chain.id, enabled, error: reason };
+        }
+      })
+    );
+
+    return jsonResponse({
+      ok: true,
+      faucetAddress: faucetAccount.address,
+      floors: {
+        nativeBalance: formatNativeToken(floors.nativeWei),
+        usdcBalance: formatUnits(floors.usdcUnits, USDC_DECIMALS),
+      },
+      chains,
+    });
+  }
+
+  private async resolveFaucetAccount(): Promise<FaucetAccount | null> {
+    const faucetPrivateKey = await readFaucetPrivateKey(this.env);
+    if (!faucetPrivateKey) {
+      return null;
+    }
+
+    // Parse the key once per instance; a rotated secret produces a different key and re-parses.
+    if (this.cachedAccount?.privateKey !== faucetPrivateKey) {
+      this.cachedAccount = { privateKey: faucetPrivateKey, account: privateKeyToAccount(faucetPrivateKey) };
+    }
+    return this.cachedAccount.account;
+  }
+
+  // Protected so tests can substitute a scripted client for the RPC.
+  protected async createClient(chain: Chain, account: FaucetAccount, signal?: AbortSignal): Promise<FaucetClient> {
+    const rpcUrl = resolveFaucetRpcUrls(this.env).get(chain.id);
+    const client = createFaucetClient(chain, account, rpcUrl, signal);
 
-    // Process all chains sequentially to avoid nonce collisions
-    await this.fundAccount(payload.recipientAddress, faucetAccount);
+    if (rpcUrl && !this.verifiedRpcChains.has(chain.id)) {
+      this.verifiedRpcChains.add(chain.id);
+      const reportedChainId = await client.getChainId();
+      if (reportedChainId !== chain.id) {
+        console.warn(`faucet chain ${chain.id} rpc override reports chain id ${reportedChainId}`);
+      }
+    }
 
-    return jsonResponse({ ok: true, status: "funded" });
+    return client;
   }
 
   private async fundAccount(
     recipientAddress: string,
-    faucetAccount: ReturnType<typeof privateKeyToAccount>
-  ): Promise<void> {
+    faucetAccount: FaucetAccount,
+    span: Span,
+    onChainResult: (results: FaucetChainResultModel[]) => Promise<void>,
+    signal: AbortSignal
+  ): Promise<FaucetFundingReportModel> {
     const recipient = getAddress(recipientAddress);
+    const results: FaucetChainResultModel[] = [];
+    const chainTimeoutMs = resolveChainTimeoutMs(this.env);
 
     for (const chain of FAUCET_CHAINS) {
-      await this.fundOnChainSafe(chain, faucetAccount, recipient);
+      if (!(await this.isChainEnabled(chain.id))) {
+        console.warn(`faucet chain ${chain.id} skipped: disabled`);
+        results.push({ chainId: chain.id, status: "skipped", reason: "disabled", transfers: [] });
+        await onChainResult([...results]);
+        continue;
+      }
+
+      // Each chain gets its own deadline under the job's signal: a slow RPC only costs that chain,
+      // while an aborted job stops every chain that has not finished yet.
+      const chainSignal = AbortSignal.any([signal, AbortSignal.timeout(chainTimeoutMs)]);
+      results.push(
+        await span.run("faucet.fund_on_chain", { "chain.id": chain.id }, async (chainSpan) => {
+          const result = await this.fundOnChainSafe(chain, faucetAccount, recipient, chainSignal);
+          chainSpan.setAttribute("faucet.result", result.status);
+          chainSpan.setAttribute("faucet.transfers", result.transfers.length);
+          return result;
+        })
+      );
+      // Reported per chain so a polling client sees "2 of 3 chains funded" while the job runs.
+      await onChainResult([...results]);
+    }
+
+    for (const result of results) {
+      this.recordChainResult(result);
     }
+    return buildFundingReport(results);
   }
 
   private async fundOnChainSafe(
     chain: Chain,
-    account: ReturnType<typeof privateKeyToAccount>,
-    recipient: Address
-  ): Promise<void> {
+    account: FaucetAccount,
+    recipient: Address,
+    signal: AbortSignal
+  ): Promise<FaucetChainResultModel> {
     try {
-      await this.fundOnChain(chain, account, recipient);
+      signal.throwIfAborted();
+      return await this.fundOnChain(chain, account, recipient, signal);
     } catch (error) {
-      const reason = error instanceof Error ? error.message : "unknown chain funding error";
+      const reason = signal.aborted
+        ? describeAbortReason(signal)
+        : error instanceof Error
+          ? error.message
+          : "unknown chain funding error";
       console.error(`faucet chain ${chain.id} failed`, reason);
+      return { chainId: chain.id, status: "failed", reason, transfers: [] };
     }
   }
 
   private async fundOnChain(
     chain: Chain,
-    account: ReturnType<typeof privateKeyToAccount>,
-    recipient: Address
-  ): Promise<void> {
-    const client = createWalletClient({
-      account,
-      chain,
-      transport: http(),
-    }).extend(publicActions);
-
-    const usdcAddress = TESTNET_USDC_BY_CHAIN[chain.id];
-
-    if (usdcAddress) {
-      try {
-        const usdcCalldata = encodeFunctionData({
-          abi: ERC20_TRANSFER_ABI,
-          functionName: "transfer",
-          args: [recipient, USDC_DRIP_AMOUNT],
-        });
-        const usdcHash = await client.sendTransaction({
-          to: usdcAddress,
-          data: usdcCalldata,
-        });
-        console.log(`faucet chain ${chain.id} usdc tx ${usdcHash}`);
-      } catch (error) {
-        const reason = error instanceof Error ? error.message : "unknown usdc transfer error";
-        console.error(`faucet chain ${chain.id} usdc transfer failed`, reason);
+    account: FaucetAccount,
+    recipient: Address,
+    signal: AbortSignal
+  ): Promise<FaucetChainResultModel> {
+    const client = await this.createClient(chain, account, signal);
+    const transfers: FaucetTransferResultModel[] = [];
+
+    const snapshot = await this.readFaucetBalances(chain, account, signal);
+    if (isBelowBalanceFloor(snapshot, resolveBalanceFloors(this.env))) {
+      console.warn(`faucet chain ${chain.id} skipped: faucet wallet below balance floor`);
+      return { chainId: chain.id, status: "skipped", reason: "faucet_depleted", transfers };
+    }
+
+    // A heuristic, not a funding record: an EOA that has already sent a transaction on this chain
+    // had gas from somewhere, most likely an earlier drip. Fresh accounts are still funded.
+    if (parseBooleanFlag(this.env.FAUCET_SKIP_ACTIVE_ACCOUNTS, false)) {
+      const recipientNonce = await client.getTransactionCount({ address: recipient });
+      if (recipientNonce > 0) {
+        console.log(
+          `faucet chain ${chain.id} skipped: recipient ${recipient} has nonce ${recipientNonce} ` +
+            "(FAUCET_SKIP_ACTIVE_ACCOUNTS heuristic)"
+        );
+        return { chainId: chain.id, status: "skipped", reason: "recipient_active", transfers };
       }
     }
 
-    try {
-      const ethHash = await client.sendTransaction({
+    const fees = await this.resolveFeeOverrides(client, chain);
+    const topUpTargets = resolveFaucetTopUpTargets(this.env).get(chain.id);
+
+    for (const token of resolveFaucetTokens(this.env, chain.id)) {
+      const drip = await this.resolveDripAmount(client, chain, recipient, token, topUpTargets);
+      if (drip.amount === 0n) {
+        transfers.push({ token: token.symbol, status: "skipped", amount: "0", reason: "at_target" });
+        continue;
+      }
+      const calldata = encodeFunctionData({
+        abi: ERC20_TRANSFER_ABI,
+        functionName: "transfer",
+        args: [recipient, drip.amount],
+      });
+      const transfer = await this.sendTransfer(client, chain, token.symbol, {
+        to: token.address,
+        data: calldata,
+        ...fees,
+      });
+      transfers.push(drip.topUp ? { ...transfer, amount: drip.amount.toString() } : transfer);
+    }
+
+    const nativeDrip = await this.resolveDripAmount(
+      client,
+      chain,
+      recipient,
+      { symbol: "ETH", decimals: 18, amountUnits: ETH_DRIP_WEI },
+      topUpTargets
+    );
+    if (nativeDrip.amount === 0n) {
+      transfers.push({ token: "ETH", status: "skipped", amount: "0", reason: "at_target" });
+    } else {
+      const transfer = await this.sendTransfer(client, chain, "ETH", {
         to: recipient,
-        value: ETH_DRIP_WEI,
+        value: nativeDrip.amount,
+        ...fees,
       });
-      console.log(`faucet chain ${chain.id} eth tx ${ethHash}`);
+      transfers.push(nativeDrip.topUp ? { ...transfer, amount: nativeDrip.amount.toString() } : transfer);
+    }
+    if (transfers.every((transfer) => transfer.status === "skipped")) {
+      console.log(`faucet chain ${chain.id} skipped: recipient ${recipient} is at every top-up target`);
+      return { chainId: chain.id, status: "skipped", reason: "at_target", transfers };
+    }
+
+    this.balanceCache.delete(chain.id);
+    const confirmations = resolveConfirmations(this.env);
+    if (confirmations > 0) {
+      await this.awaitConfirmations(client, chain, transfers, confirmations);
+    }
+    const gasCost = resolveGasCostReporting(this.env) ? await this.attachGasCosts(client, chain, transfers) : {};
+
+    const failedTransfer = transfers.find((transfer) => transfer.status === "failed");
+    if (failedTransfer) {
+      return {
+        chainId: chain.id,
+        status: "failed",
+        reason: `${failedTransfer.token} transfer failed: ${failedTransfer.error ?? "unknown error"}`,
+        transfers,
+        ...gasCost,
+      };
+    }
+    return { chainId: chain.id, status: "succeeded", transfers, ...gasCost };
+  }
+
+  // Top-up mode sends the recipient's shortfall against the token's target, or nothing once it is
+  // there. Tokens without a target keep their fixed drip and skip the balance read.
+  private async resolveDripAmount(
+    client: FaucetClient,
+    chain: Chain,
+    recipient: Address,
+    token: Pick<FaucetToken, "symbol" | "decimals" | "amountUnits"> & { address?: Address },
+    targets: Map<string, string> | undefined
+  ): Promise<{ amount: bigint; topUp: boolean }> {
+    const target = targets?.get(token.symbol);
+    if (target === undefined) {
+      return { amount: token.amountUnits, topUp: false };
+    }
+
+    const targetUnits = parseUnits(target, token.decimals);
+    const balance = token.address
+      ? await client.readContract({
+          address: token.address,
+          abi: ERC20_BALANCE_OF_ABI,
+          functionName: "balanceOf",
+          args: [recipient],
+        })
+      : await client.getBalance({ address: recipient });
+    const amount = resolveTopUpShortfall(balance, targetUnits);
+    console.log(
+      `faucet chain ${chain.id} ${token.symbol.toLowerCase()} top-up: balance ${balance}, target ${targetUnits}, ` +
+        `sending ${amount}`
+    );
+    return { amount, topUp: true };
+  }
+
+  // Chains without a configured floor or cap keep viem's own fee resolution. Otherwise the
+  // suggested EIP-1559 fees are fetched once per chain and clamped (see clampFees).
+  private async resolveFeeOverrides(client: FaucetClient, chain: Chain): Promise<FaucetFeeOverrides> {
+    const bounds = resolveFaucetGasPriceBounds(this.env).get(chain.id);
+    if (!bounds) {
+      return {};
+    }
+
+    const suggested = await client.estimateFeesPerGas();
+    return clampFees(chain.id, suggested, bounds);
+  }
+
+  // Polls the block number until each sent transfer's block has `required` blocks on top of it, so
+  // a reorg-prone testnet cannot undo a drip the report already counts. The wait shares the chain's
+  // deadline: when it runs out, the depth reached so far is recorded and the chain is still
+  // reported, since the transfers were broadcast either way.
+  private async awaitConfirmations(
+    client: FaucetClient,
+    chain: Chain,
+    transfers: FaucetTransferResultModel[],
+    required: number
+  ): Promise<void> {
+    await Promise.all(
+      transfers.map(async (transfer) => {
+        if (transfer.status !== "sent" || !transfer.txHash) {
+          return;
+        }
+        try {
+          const receipt = await client.waitForTransactionReceipt({ hash: transfer.txHash as Hex });
+          transfer.confirmations = 0;
+          for (;;) {
+            transfer.confirmations = Number((await client.getBlockNumber({ cacheTime: 0 })) - receipt.blockNumber);
+            if (transfer.confirmations >= required) {
+              return;
+            }
+            await sleep(client.pollingInterval);
+          }
+        } catch (error) {
+          const reason = error instanceof Error ? error.message : "unknown confirmation error";
+          console.warn(
+            `faucet chain ${chain.id} ${transfer.token} reached ${transfer.confirmations ?? 0} of ${required} ` +
+              "confirmations",
+            reason
+          );
+        }
+      })
+    );
+  }
+
+  // Waits for each sent transfer's receipt (within the chain's deadline) and records
+  // gasUsed x effectiveGasPrice on it. A missing receipt leaves that transfer without a cost, so
+  // the chain total only covers the receipts that arrived.
+  private async attachGasCosts(
+    client: FaucetClient,
+    chain: Chain,
+    transfers: FaucetTransferResultModel[]
+  ): Promise<Pick<FaucetChainResultModel, "gasCostNative" | "gasCostUsd">> {
+    let totalWei = 0n;
+    await Promise.all(
+      transfers.map(async (transfer) => {
+        if (transfer.status !== "sent" || !transfer.txHash) {
+          return;
+        }
+        try {
+          const receipt = await client.waitForTransactionReceipt({ hash: transfer.txHash as Hex });
+          const costWei = receipt.gasUsed * receipt.effectiveGasPrice;
+          transfer.gasUsed = receipt.gasUsed.toString();
+          transfer.gasCostWei = costWei.toString();
+          totalWei += costWei;
+          recordMetric(
+            this.env,
+            "faucet_tx_gas_used",
+            { chain: String(chain.id), token: transfer.token },
+            Number(receipt.gasUsed)
+          );
+        } catch (error) {
+          const reason = error instanceof Error ? error.message : "unknown receipt error";
+          console.warn(`faucet chain ${chain.id} ${transfer.token} receipt lookup failed`, reason);
+        }
+      })
+    );
+
+    const gasCostNative = formatEther(totalWei);
+    const usdPrice = resolveNativeUsdPrice(this.env);
+    return usdPrice === null
+      ? { gasCostNative }
+      : { gasCostNative, gasCostUsd: Number((Number(gasCostNative) * usdPrice).toFixed(6)) };
+  }
+
+  private async sendTransfer(
+    client: FaucetClient,
+    chain: Chain,
+    token: string,
+    transfer: FaucetTransferRequest
+  ): Promise<FaucetTransferResultModel> {
+    const chainLabel = String(chain.id);
+    try {
+      const gas = await this.estimateTransferGas(client, chain, token, transfer);
+      const tx = { ...transfer, gas };
+
+      if (parseBooleanFlag(this.env.FAUCET_DRY_RUN, false)) {
+        return await this.signTransferWithoutSending(client, chain, token, tx);
+      }
+
+      const { hash, nonceCorrected } = await this.sendWithNonceRecovery(client, chain, token, tx);
+      console.log(`faucet chain ${chain.id} ${token.toLowerCase()} tx ${hash}`);
+      recordMetric(this.env, "faucet_funding_total", { chain: chainLabel, token, result: "sent" });
+      // With gas cost reporting on, fundOnChain waits for the receipt itself and records the metric.
+      if (!resolveGasCostReporting(this.env)) {
+        this.ctx.waitUntil(this.recordGasUsed(chain, client.account, token, hash));
+      }
+      return {
+        token,
+        status: "sent",
+        txHash: hash,
+        gasLimit: gas.toString(),
+        ...(nonceCorrected ? { nonceCorrected } : {}),
+      };
     } catch (error) {
-      const reason = error instanceof Error ? error.message : "unknown eth transfer error";
-      console.error(`faucet chain ${chain.id} eth transfer failed`, reason);
+      const reason = error instanceof Error ? error.message : `unknown ${token.toLowerCase()} transfer error`;
+      console.error(`faucet chain ${chain.id} ${token.toLowerCase()} transfer failed`, reason);
+      recordMetric(this.env, "faucet_funding_total", { chain: chainLabel, token, result: "failed" });
+      return { token, status: "failed", error: reason };
     }
   }
 
-  private normalizePrivateKey(value: string): Hex {
-    const trimmed = value.trim().toLowerCase();
-    if (!trimmed) {
-      throw new BadRequestError("Faucet private key is not configured.");
+  // A stale nonce (e.g. a drip that was broadcast but not recorded before an eviction) surfaces as
+  // "nonce too low" or "replacement transaction underpriced". Retry exactly once with the chain's
+  // pending nonce; any further failure is reported as-is.
+  private async sendWithNonceRecovery(
+    client: FaucetClient,
+    chain: Chain,
+    token: string,
+    tx: FaucetTransferRequest & { gas: bigint }
+  ): Promise<{ hash: Hex; nonceCorrected: boolean }> {
+    try {
+      return { hash: await client.sendTransaction(tx), nonceCorrected: false };
+    } catch (error) {
+      if (!isNonceConflictError(error)) {
+        throw error;
+      }
+
+      const nonce = await client.getTransactionCount({ address: client.account.address, blockTag: "pending" });
+      console.warn(`faucet chain ${chain.id} ${token.toLowerCase()} nonce conflict, retrying with nonce ${nonce}`);
+      return { hash: await client.sendTransaction({ ...tx, nonce }), nonceCorrected: true };
     }
+  }
+
+  // Dry run: nonce, gas and fee resolution still hit the RPC, but the signed tx is never broadcast.
+  private async signTransferWithoutSending(
+    client: FaucetClient,
+    chain: Chain,
+    token: string,
+    tx: FaucetTransferRequest & { gas: bigint }
+  ): Promise<FaucetTransferResultModel> {
+    const request = await client.prepareTransactionRequest(tx);
+    const serialized = await client.signTransaction(request);
+    const hash = keccak256(serialized);
+    console.log(`faucet DRY RUN chain ${chain.id} ${token.toLowerCase()} tx ${hash} (not broadcast)`);
+    return {
+      token,
+      status: "simulated",
+      txHash: hash,
+      calldata: tx.data,
+      nonce: request.nonce,
+      gasLimit: tx.gas.toString(),
+    };
+  }
+
+  // Estimate + safety margin, capped so a misbehaving RPC cannot inflate the limit and drain the wallet.
+  private async estimateTransferGas(
+    client: FaucetClient,
+    chain: Chain,
+    token: string,
+    transfer: FaucetTransferRequest
+  ): Promise<bigint> {
+    const fallback = transfer.data ? ERC20_TRANSFER_GAS_FALLBACK : NATIVE_TRANSFER_GAS_FALLBACK;
+    const marginPercent = BigInt(parseBoundedInteger(this.env.FAUCET_GAS_MARGIN_PERCENT ?? "20", 0, 200, 20));
+    const maxGas = BigInt(parseBoundedInteger(this.env.FAUCET_MAX_GAS_LIMIT ?? "500000", 21_000, 10_000_000, 500_000));
+
+    let estimate: bigint;
+    try {
+      estimate = await client.estimateGas(transfer);
+    } catch (error) {
+      const reason = error instanceof Error ? error.message : "unknown gas estimation error";
+      console.warn(`faucet chain ${chain.id} ${token.toLowerCase()} gas estimation failed, using ${fallback}`, reason);
+      return fallback;
+    }
+
+    const withMargin = (estimate * (100n + marginPercent)) / 100n;
+    if (withMargin > maxGas) {
+      console.warn(`faucet chain ${chain.id} ${token.toLowerCase()} gas ${withMargin} capped at ${maxGas}`);
+      return maxGas;
+    }
+    return withMargin;
+  }
+
+  private async readFaucetBalances(
+    chain: Chain,
+    account: FaucetAccount,
+    signal?: AbortSignal
+  ): Promise<FaucetBalanceSnapshot> {
+    const cached = this.balanceCache.get(chain.id);
+    const ttlMs = parseBoundedInteger(this.env.FAUCET_BALANCE_CACHE_SECONDS ?? "30", 0, 3600, 30) * 1000;
+    if (cached && Date.now() - cached.fetchedAt < ttlMs) {
+      return cached;
+    }
+
+    const client = await this.createClient(chain, account, signal);
+    const usdcAddress = resolveFaucetUsdcAddress(this.env, chain.id);
+    const [nativeWei, usdcUnits] = await Promise.all([
+      client.getBalance({ address: account.address }),
+      usdcAddress
+        ? client.readContract({
+            address: usdcAddress,
+            abi: ERC20_BALANCE_OF_ABI,
+            functionName: "balanceOf",
+            args: [account.address],
+          })
+        : Promise.resolve(null),
+    ]);
+
+    const snapshot: FaucetBalanceSnapshot = { nativeWei, usdcUnits, fetchedAt: Date.now() };
+    this.balanceCache.set(chain.id, snapshot);
+    return snapshot;
+  }
+
+  // Best-effort: receipts are awaited off the funding path so metrics never slow down drips. The
+  // receipt outlives the chain's funding deadline, so it uses a client without that abort signal.
+  private async recordGasUsed(chain: Chain, account: FaucetAccount, token: string, hash: Hex): Promise<void> {
+    const chainLabel = String(chain.id);
+    try {
+      const client = await this.createClient(chain, account);
+      const receipt = await client.waitForTransactionReceipt({ hash });
+      recordMetric(this.env, "faucet_tx_gas_used", { chain: chainLabel, token }, Number(receipt.gasUsed));
+    } catch (error) {
+      const reason = error instanceof Error ? error.message : "unknown receipt error";
+      console.warn(`faucet chain ${chainLabel} ${token} receipt lookup failed`, reason);
+    }
+  }
+}
+
+function isNonceConflictError(error: unknown): boolean {
+  const message = error instanceof Error ? error.message.toLowerCase() : "";
+  return message.includes("nonce too low") || message.includes("replacement transaction underpriced");
+}
+
+function resolveQueueMaxDepth(env: Env): number {
+  return parseBoundedInteger(env.FAUCET_QUEUE_MAX_DEPTH ?? "50", 1, 1000, 50);
+}
+
+function resolveGasCostReporting(env: Env): boolean {
+  return parseBooleanFlag(env.FAUCET_REPORT_GAS_COST, false);
+}
+
+// FAUCET_NATIVE_USD_PRICE is a rough, manually maintained price used only for the spend estimate.
+function resolveNativeUsdPrice(env: Env): number | null {
+  const raw = (env.FAUCET_NATIVE_USD_PRICE ?? "").trim();
+  const price = Number(raw);
+  return raw && Number.isFinite(price) && price >= 0 ? price : null;
+}
+
+// FAUCET_CONFIRMATIONS is how many blocks must be mined on top of a drip before its chain is
+// reported; 0 (the default) settles as soon as the transfers are broadcast.
+function resolveConfirmations(env: Env): number {
+  return parseBoundedInteger(env.FAUCET_CONFIRMATIONS ?? "0", 0, 64, 0);
+}
+
+function resolveChainTimeoutMs(env: Env): number {
+  return parseBoundedInteger(env.FAUCET_CHAIN_TIMEOUT_SECONDS ?? "30", 5, 120, 30) * 1000;
+}
+
+function resolveJobTimeoutMs(env: Env): number {
+  return parseBoundedInteger(env.FAUCET_JOB_TIMEOUT_SECONDS ?? "120", 1, 600, 120) * 1000;
+}
+
+function describeAbortReason(signal: AbortSignal): string {
+  const reason = signal.reason;
+  if (reason instanceof Error && reason.name === "TimeoutError") {
+    return "chain funding timed out";
+  }
+  return `chain funding aborted: ${reason instanceof Error ? reason.message : "cancelled"}`;
+}
 
-    const normalized = trimmed.startsWith("0x") ? trimmed : `0x${trimmed}`;
-    if (!/^0x[0-9a-f]{64}$/.test(normalized)) {
-      throw new BadRequestError("Invalid faucet private key.");
+function resolveFundingCooldownMs(env: Env): number {
+  const seconds = parseBoundedInteger(
+    env.FAUCET_COOLDOWN_SECONDS ?? String(FAUCET_FUNDED_TTL_SECONDS),
+    0,
+    FAUCET_FUNDED_TTL_SECONDS,
+    FAUCET_FUNDED_TTL_SECONDS
+  );
+  return seconds * 1000;
+}
+
+function buildFundingReport(results: readonly FaucetChainResultModel[]): FaucetFundingReportModel {
+  const report: FaucetFundingReportModel = {
+    configured: results.map((result) => result.chainId),
+    attempted: [],
+    succeeded: [],
+    failed: [],
+    skipped: [],
+    chains: [...results],
+  };
+
+  for (const result of results) {
+    switch (result.status) {
+      case "succeeded":
+        report.attempted.push(result.chainId);
+        report.succeeded.push(result.chainId);
+        break;
+      case "failed":
+        report.attempted.push(result.chainId);
+        report.failed.push({ chainId: result.chainId, reason: result.reason ?? "unknown" });
+        break;
+      case "skipped":
+        report.skipped.push({ chainId: result.chainId, reason: result.reason ?? "unknown" });
+        break;
     }
-    return normalized as Hex;
+  }
+
+  return report;
+}
+
+function formatTimestamp(value: number | null | undefined): string | null {
+  return value === null || value === undefined ? null : new Date(value).toISOString();
+}
+
+function resolveBalanceFloors(env: Env): FaucetBalanceFloors {
+  return {
+    nativeWei: parseUsdToWei(env.FAUCET_MIN_NATIVE_BALANCE ?? "0.02"),
+    usdcUnits: parseTokenUnits(env.FAUCET_MIN_USDC_BALANCE ?? "2", USDC_DECIMALS),
+  };
+}
+
+function isBelowBalanceFloor(snapshot: FaucetBalanceSnapshot, floors: FaucetBalanceFloors): boolean {
+  if (snapshot.nativeWei < floors.nativeWei) {
+    return true;
+  }
+  return snapshot.usdcUnits !== null && snapshot.usdcUnits < floors.usdcUnits;
+}
+
+function parseTokenUnits(value: string, decimals: number): bigint {
+  try {
+    return parseUnits(value.trim() || "0", decimals);
+  } catch {
+    return 0n;
   }
 }
@@ -0,0 +1,35 @@
+import { describe, expect, it } from "bun:test";
+
+import { clampFees, resolveTopUpShortfall } from "./fees";
+
+const GWEI = 1_000_000_000n;
+
+describe("clampFees", () => {
+  it("keeps suggested fees inside the bounds", () => {
+    const bounds = { minWei: GWEI, maxWei: 10n * GWEI };
+    const fees = clampFees(84532, { maxFeePerGas: 5n * GWEI, maxPriorityFeePerGas: GWEI }, bounds);
+    expect(fees).toEqual({ maxFeePerGas: 5n * GWEI, maxPriorityFeePerGas: GWEI });
+  });
+
+  it("raises both the max fee and the tip to the floor", () => {
+    const fees = clampFees(84532, { maxFeePerGas: 10n, maxPriorityFeePerGas: 1n }, { minWei: GWEI, maxWei: null });
+    expect(fees).toEqual({ maxFeePerGas: GWEI, maxPriorityFeePerGas: GWEI });
+  });
+
+  it("caps the max fee and keeps the tip below it", () => {
+    const bounds = { minWei: null, maxWei: 10n * GWEI };
+    const fees = clampFees(84532, { maxFeePerGas: 50n * GWEI, maxPriorityFeePerGas: 20n * GWEI }, bounds);
+    expect(fees).toEqual({ maxFeePerGas: 10n * GWEI, maxPriorityFeePerGas: 10n * GWEI });
+  });
+});
+
+describe("resolveTopUpShortfall", () => {
+  it("sends the gap to the target", () => {
+    expect(resolveTopUpShortfall(3n, 10n)).toBe(7n);
+  });
+
+  it("sends nothing at or above the target", () => {
+    expect(resolveTopUpShortfall(10n, 10n)).toBe(0n);
+    expect(resolveTopUpShortfall(12n, 10n)).toBe(0n);
+  });
+});
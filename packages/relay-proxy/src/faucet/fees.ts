@@ -0,0 +1,31 @@
+import type { FaucetGasPriceBounds } from "./config";
+
+export interface FaucetFees {
+  maxFeePerGas: bigint;
+  maxPriorityFeePerGas: bigint;
+}
+
+// Below the floor, both the max fee and the tip are raised to it (on near-zero testnets the tip is
+// what gets a drip mined); above the cap, the max fee is lowered to it. The tip never exceeds the
+// max fee.
+export function clampFees(chainId: number, suggested: FaucetFees, bounds: FaucetGasPriceBounds): FaucetFees {
+  let { maxFeePerGas, maxPriorityFeePerGas } = suggested;
+  if (bounds.minWei !== null && maxFeePerGas < bounds.minWei) {
+    console.warn(`faucet chain ${chainId} gas price ${maxFeePerGas} raised to floor ${bounds.minWei}`);
+    maxFeePerGas = bounds.minWei;
+    maxPriorityFeePerGas = bounds.minWei;
+  }
+  if (bounds.maxWei !== null && maxFeePerGas > bounds.maxWei) {
+    console.warn(`faucet chain ${chainId} gas price ${maxFeePerGas} capped at ${bounds.maxWei}`);
+    maxFeePerGas = bounds.maxWei;
+  }
+  if (maxPriorityFeePerGas > maxFeePerGas) {
+    maxPriorityFeePerGas = maxFeePerGas;
+  }
+  return { maxFeePerGas, maxPriorityFeePerGas };
+}
+
+// What a top-up sends: the gap to the target, or nothing once the balance has reached it.
+export function resolveTopUpShortfall(balance: bigint, target: bigint): bigint {
+  return balance < target ? target - balance : 0n;
+}
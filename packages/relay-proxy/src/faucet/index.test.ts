@@ -0,0 +1,116 @@
+import { describe, expect, it } from "bun:test";
+import { privateKeyToAccount } from "viem/accounts";
+
+import { bindDurableObject, createDurableObjectState } from "../../test/durable-object";
+import { createKVNamespace } from "../../test/kv";
+import { BadRequestError, ForbiddenError, ServiceUnavailableError } from "../errors";
+import type { Env } from "../relay/models";
+import { Tracer } from "../tracing";
+
+import { FaucetTracker } from "./do";
+import { handleFaucetChainToggle, handleFaucetFund } from "./index";
+
+// Hardhat account 5 signs for the faucet; account 6 asks to be funded.
+const FAUCET_KEY = "0x8b3a350cf5c34c9194ca85829a2df0ec3153be0318b5e2d3348e872092edffba";
+const RECIPIENT = privateKeyToAccount("0x92db14e403b83dfe3df233f83dfa3a0d7096f21ca9b0d6d6b8d88b2b4ec1564e").address;
+
+function faucetEnv(vars: Partial<Env> = {}): Env {
+  const env = {
+    FAUCET_FUNDING_KV: createKVNamespace(),
+    SERVER_KEY_STORE: { get: async () => FAUCET_KEY },
+    ...vars,
+  } as Env;
+  env.FAUCET_TRACKER_DO = bindDurableObject(new FaucetTracker(createDurableObjectState(), env));
+  return env;
+}
+
+async function fund(env: Env, eoaAddress: string = RECIPIENT) {
+  const span = new Tracer(env, null).startSpan("test");
+  const body = JSON.stringify({ eoaAddress, supportMode: "LIMITED_TESTNET" });
+  const response = await handleFaucetFund(body, env, span);
+  return { status: response.status, body: (await response.json()) as Record<string, unknown> };
+}
+
+describe("handleFaucetFund error codes", () => {
+  it("rejects a malformed address with invalid_eoa", async () => {
+    const failure = fund(faucetEnv(), "0x1234");
+    await expect(failure).rejects.toBeInstanceOf(BadRequestError);
+    await expect(failure).rejects.toMatchObject({ code: "invalid_eoa" });
+  });
+
+  it("reports a missing or unusable key as 503 faucet_not_configured", async () => {
+    const unbound = fund(faucetEnv({ SERVER_KEY_STORE: undefined }));
+    await expect(unbound).rejects.toBeInstanceOf(ServiceUnavailableError);
+    await expect(unbound).rejects.toMatchObject({ code: "faucet_not_configured" });
+
+    const malformed = fund(faucetEnv({ SERVER_KEY_STORE: { get: async () => "not-a-key" } as never }));
+    await expect(malformed).rejects.toBeInstanceOf(ServiceUnavailableError);
+    await expect(malformed).rejects.toMatchObject({ code: "faucet_not_configured" });
+  });
+
+  it("reports invalid faucet config as 503 invalid_config", async () => {
+    const failure = fund(faucetEnv({ FAUCET_RPC_URLS: "[]" }));
+    await expect(failure).rejects.toBeInstanceOf(ServiceUnavailableError);
+    await expect(failure).rejects.toMatchObject({ code: "invalid_config" });
+  });
+
+  it("rejects addresses outside FAUCET_ALLOWED_EOAS with eoa_not_allowed", async () => {
+    const env = faucetEnv({ FAUCET_ALLOWED_EOAS: "0x000000000000000000000000000000000000dEaD" });
+    const failure = fund(env);
+    await expect(failure).rejects.toBeInstanceOf(ForbiddenError);
+    await expect(failure).rejects.toMatchObject({ code: "eoa_not_allowed" });
+  });
+
+  it("reports faucet_depleted when no chain can be funded", async () => {
+    const failure = fund(faucetEnv({ FAUCET_DISABLED_CHAINS: "11155111,84532,421614" }));
+    await expect(failure).rejects.toBeInstanceOf(ServiceUnavailableError);
+    await expect(failure).rejects.toMatchObject({ code: "faucet_depleted" });
+  });
+
+  it("reports faucet_queue_full once the queue is at its limit", async () => {
+    const env = faucetEnv({ FAUCET_QUEUE_MAX_DEPTH: "1" });
+    expect((await fund(env)).status).toBe(202);
+    const failure = fund(env, "0x000000000000000000000000000000000000bEEF");
+    await expect(failure).rejects.toBeInstanceOf(ServiceUnavailableError);
+    await expect(failure).rejects.toMatchObject({ code: "faucet_queue_full" });
+  });
+
+  it("lists the chains it expects to fund when it accepts a request", async () => {
+    const { status, body } = await fund(faucetEnv({ FAUCET_DISABLED_CHAINS: "421614" }));
+    expect(status).toBe(202);
+    expect(body.status).toBe("funding_initiated");
+    expect(body.chains).toEqual([11155111, 84532]);
+  });
+});
+
+describe("FAUCET_ALLOWED_EOAS", () => {
+  it("funds a listed address regardless of case or spacing", async () => {
+    const listed = ` 0x000000000000000000000000000000000000dEaD , 0x${RECIPIENT.slice(2).toUpperCase()}`;
+    const env = faucetEnv({ FAUCET_ALLOWED_EOAS: listed });
+    expect((await fund(env, RECIPIENT.toLowerCase())).status).toBe(202);
+  });
+
+  it("leaves the faucet open when unset or empty", async () => {
+    expect((await fund(faucetEnv())).status).toBe(202);
+    expect((await fund(faucetEnv({ FAUCET_ALLOWED_EOAS: " , " }))).status).toBe(202);
+  });
+
+  it("reports a malformed entry as 503 invalid_config", async () => {
+    const failure = fund(faucetEnv({ FAUCET_ALLOWED_EOAS: "team-lead" }));
+    await expect(failure).rejects.toMatchObject({ code: "invalid_config" });
+  });
+});
+
+describe("handleFaucetChainToggle", () => {
+  it("flips a chain and reports its new state", async () => {
+    const env = faucetEnv();
+    const toggled = await handleFaucetChainToggle("84532", JSON.stringify({ enabled: false }), env);
+    expect(await toggled.json()).toEqual({ ok: true, chainId: 84532, enabled: false });
+    const flipped = await handleFaucetChainToggle("84532", "", env);
+    expect(await flipped.json()).toEqual({ ok: true, chainId: 84532, enabled: true });
+  });
+
+  it("rejects a chain the faucet does not serve with invalid_chain", async () => {
+    await expect(handleFaucetChainToggle("1", "", faucetEnv())).rejects.toMatchObject({ code: "invalid_chain" });
+  });
+});
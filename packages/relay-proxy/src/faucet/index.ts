@@ -1,120 +1,289 @@
+import { SUPPORT_MODES } from "../constants";
+import { BadRequestError, ForbiddenError, ServiceUnavailableError } from "../errors";
+import { recordMetric } from "../metrics";
+import type {
+  Env,
+  FaucetAntibotProofModel,
+  FaucetChainToggleRequestModel,
+  FaucetFundRequestModel,
+  SupportMode,
+} from "../relay/models";
+import type { Span } from "../tracing";
+import { jsonResponse, normalizeAddress, parseJsonObject } from "../utils";
+
+import { assertFaucetAntibot } from "./antibot";
+import { assertFaucetConfigured, resolveAllowedFaucetEOAs } from "./config";
 import {
-  FAUCET_FUNDED_TTL_SECONDS,
-  FAUCET_PENDING_TTL_SECONDS,
-  SUPPORT_MODES,
-} from "../constants";
-import { BadRequestError } from "../errors";
-import type { Env, FaucetFundRequestModel, SupportMode } from "../relay/models";
-import { jsonResponse, normalizeAddress } from "../utils";
-
-export async function handleFaucetFund(rawBody: string, env: Env, ctx: ExecutionContext): Promise<Response> {
+  buildFaucetFundingKey,
+  markFaucetFunded,
+  markFaucetPending,
+  readFaucetFundingState,
+  resolveFaucetFundingKV,
+} from "./marker";
+
+export { handleFaucetChallenge, resolveFaucetAntibotMode } from "./antibot";
+
+export async function handleFaucetFund(rawBody: string, env: Env, span: Span): Promise<Response> {
   const request = parseFaucetFundRequest(rawBody);
+  span.setAttribute("faucet.support_mode", request.supportMode);
 
   if (request.supportMode !== "LIMITED_TESTNET") {
+    span.setAttribute("faucet.result", "skipped_non_testnet");
+    recordMetric(env, "faucet_requests_total", { result: "skipped_non_testnet" });
     return jsonResponse({ ok: true, status: "skipped_non_testnet", supportMode: request.supportMode }, 200);
   }
 
+  const allowed = resolveAllowedFaucetEOAs(env);
+  if (allowed && !allowed.has(request.eoaAddress)) {
+    span.setAttribute("faucet.result", "eoa_not_allowed");
+    recordMetric(env, "faucet_requests_total", { result: "eoa_not_allowed" });
+    throw new ForbiddenError("eoaAddress is not on the faucet allowlist.", "eoa_not_allowed");
+  }
+
+  await assertFaucetConfigured(env);
+
   const faucetKV = resolveFaucetFundingKV(env);
   const fundingKey = buildFaucetFundingKey(request.eoaAddress, request.supportMode);
   const existing = await readFaucetFundingState(faucetKV, fundingKey);
 
-  if (existing === "funded") {
-    return jsonResponse({ ok: true, status: "already_funded" }, 200);
+  if (existing?.state === "funded") {
+    span.setAttribute("faucet.result", "already_funded");
+    recordMetric(env, "faucet_requests_total", { result: "already_funded" });
+    return jsonResponse({ ok: true, status: "already_funded", report: existing.report }, 200);
   }
-  if (existing === "pending") {
+  if (existing?.state === "pending") {
+    span.setAttribute("faucet.result", "funding_pending");
+    recordMetric(env, "faucet_requests_total", { result: "funding_pending" });
     return jsonResponse({ ok: true, status: "funding_pending" }, 202);
   }
 
-  await faucetKV.put(
-    fundingKey,
-    JSON.stringify({ state: "pending", updatedAt: Date.now() }),
-    { expirationTtl: FAUCET_PENDING_TTL_SECONDS }
-  );
+  try {
+    await assertFaucetAntibot(env, resolveFaucetTracker(env), request.eoaAddress, request.antibot);
+  } catch (error) {
+    span.setAttribute("faucet.result", "antibot_rejected");
+    recordMetric(env, "faucet_requests_total", { result: "antibot_rejected" });
+    throw error;
+  }
+
+  // Pending goes in before the job is queued so the tracker's funded marker can never be
+  // overwritten by a late pending one.
+  await markFaucetPending(faucetKV, fundingKey);
 
-  ctx.waitUntil(
-    (async () => {
-      try {
-        if (!env.FAUCET_TRACKER_DO) {
-          throw new Error("FAUCET_TRACKER_DO binding is not configured.");
-        }
-
-        const id = env.FAUCET_TRACKER_DO.idFromName("global-faucet");
-        const stub = env.FAUCET_TRACKER_DO.get(id);
-
-        const doRequest = new Request("http://do/fund", {
-          method: "POST",
-          headers: { "Content-Type": "application/json" },
-          body: JSON.stringify({ recipientAddress: request.eoaAddress })
-        });
-
-        const doRes = await stub.fetch(doRequest);
-        
-        if (!doRes.ok) {
-          throw new Error(`Durable Object returned status: ${doRes.status}`);
-        }
-
-        await faucetKV.put(
-          fundingKey,
-          JSON.stringify({ state: "funded", updatedAt: Date.now() }),
-          { expirationTtl: FAUCET_FUNDED_TTL_SECONDS }
-        );
-      } catch (error) {
-        const reason = error instanceof Error ? error.message : "unknown faucet error";
-        console.error("faucet funding failed", reason);
-        await faucetKV.delete(fundingKey);
-      }
-    })()
+  let doRes: Response;
+  try {
+    doRes = await resolveFaucetTracker(env).fetch(
+      new Request("http://do/fund", {
+        method: "POST",
+        headers: { "Content-Type": "application/json", traceparent: span.traceparent },
+        body: JSON.stringify({ recipientAddress: request.eoaAddress, fundingKey }),
+      })
+    );
+  } catch (error) {
+    await faucetKV.delete(fundingKey);
+    throw error;
+  }
+
+  const payload = (await doRes.json()) as FaucetTrackerFundResponse;
+  if (!doRes.ok) {
+    await faucetKV.delete(fundingKey);
+    if (doRes.status === 503) {
+      const rejection = describeFaucetRejection(payload.error);
+      span.setAttribute("faucet.result", rejection.result);
+      recordMetric(env, "faucet_requests_total", { result: rejection.result });
+      throw new ServiceUnavailableError(rejection.message, rejection.code);
+    }
+    throw new Error(`Durable Object returned status: ${doRes.status}`);
+  }
+
+  // Another request for this EOA already has a job queued or running; report that job rather than
+  // starting a second one. Its pending marker stays in place.
+  if (payload.status === "in_progress") {
+    span.setAttribute("faucet.result", "funding_pending");
+    recordMetric(env, "faucet_requests_total", { result: "funding_pending" });
+    return jsonResponse(
+      {
+        ok: true,
+        status: "funding_pending",
+        jobID: payload.jobID,
+        running: payload.running,
+        enqueuedAt: payload.enqueuedAt,
+      },
+      202
+    );
+  }
+
+  // The tracker's own funding history vetoed the drip even though KV had no marker.
+  if (payload.status === "already_funded") {
+    await markFaucetFunded(faucetKV, fundingKey, undefined);
+    span.setAttribute("faucet.result", "already_funded");
+    recordMetric(env, "faucet_requests_total", { result: "already_funded" });
+    return jsonResponse({ ok: true, status: "already_funded", fundedAt: payload.fundedAt }, 200);
+  }
+
+  span.setAttribute("faucet.result", "funding_initiated");
+  recordMetric(env, "faucet_requests_total", { result: "funding_initiated" });
+  return jsonResponse(
+    {
+      ok: true,
+      status: "funding_initiated",
+      jobID: payload.jobID,
+      queueDepth: payload.queueDepth,
+      chains: payload.chains ?? [],
+    },
+    202
   );
+}
 
-  return jsonResponse({ ok: true, status: "funding_initiated" }, 202);
+interface FaucetTrackerFundResponse {
+  status?: string;
+  error?: string;
+  jobID?: string;
+  queueDepth?: number;
+  chains?: number[];
+  fundedAt?: string;
+  running?: boolean;
+  enqueuedAt?: string;
 }
 
-function parseFaucetFundRequest(rawBody: string): FaucetFundRequestModel {
-  let payload: unknown;
-  try {
-    payload = JSON.parse(rawBody);
-  } catch {
-    throw new BadRequestError("Invalid JSON body.");
+// The tracker answers 503 for every reason it cannot take a job; each maps to its own error code.
+function describeFaucetRejection(error: string | undefined): { result: string; code: string; message: string } {
+  switch (error) {
+    case "faucet_queue_full":
+      return { result: "queue_full", code: "faucet_queue_full", message: "Faucet is busy; try again later." };
+    case "faucet_depleted":
+      return {
+        result: "depleted",
+        code: "faucet_depleted",
+        message: "No faucet chain can be funded right now; try again later.",
+      };
+    default:
+      return { result: "not_configured", code: "faucet_not_configured", message: "Faucet key is not configured." };
   }
+}
 
-  if (!payload || typeof payload !== "object") {
-    throw new BadRequestError("Invalid faucet payload.");
+export async function handleFaucetStatus(env: Env): Promise<Response> {
+  const stub = resolveFaucetTracker(env);
+  const doRes = await stub.fetch(new Request("http://do/status", { method: "GET" }));
+  const payload = (await doRes.json()) as { error?: string };
+  if (doRes.status === 503) {
+    throw new ServiceUnavailableError("Faucet key is not configured.", payload.error ?? "faucet_not_configured");
+  }
+  if (!doRes.ok) {
+    throw new Error(`Faucet status lookup failed with status ${doRes.status}.`);
   }
+  return jsonResponse(payload);
+}
 
-  const request = payload as Partial<FaucetFundRequestModel>;
-  const eoaAddress = normalizeAddress(String(request.eoaAddress ?? ""));
-  const supportMode = String(request.supportMode ?? "").trim();
-  if (!SUPPORT_MODES.has(supportMode)) {
-    throw new BadRequestError("Invalid supportMode.");
+const FAUCET_JOB_ID_PATTERN = /^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$/;
+
+// Job IDs come from `/v1/faucet/fund`; their status is kept for a day after the last update.
+export async function handleFaucetJobStatus(rawJobID: string, env: Env): Promise<Response> {
+  const jobID = rawJobID.toLowerCase();
+  if (!FAUCET_JOB_ID_PATTERN.test(jobID)) {
+    throw new BadRequestError("Invalid faucet job ID.", "invalid_job_id");
+  }
+
+  const doRes = await resolveFaucetTracker(env).fetch(
+    new Request(`http://do/jobs/${encodeURIComponent(jobID)}`, { method: "GET" })
+  );
+  if (doRes.status === 404) {
+    throw new BadRequestError(`Unknown or expired faucet job: ${jobID}`, "job_not_found");
   }
-  return { eoaAddress, supportMode: supportMode as SupportMode };
+  if (!doRes.ok) {
+    throw new Error(`Faucet job lookup failed with status ${doRes.status}.`);
+  }
+  return jsonResponse(await doRes.json());
 }
 
-function resolveFaucetFundingKV(env: Env): KVNamespace {
-  return env.FAUCET_FUNDING_KV ?? env.GAS_TANK_KV;
+// Flips the chain when `enabled` is omitted; an explicit value makes retries idempotent.
+export async function handleFaucetChainToggle(rawChainId: string, rawBody: string, env: Env): Promise<Response> {
+  const chainId = Number(rawChainId);
+  const request = rawBody.trim() === "" ? {} : parseFaucetChainToggleRequest(rawBody);
+
+  const doRes = await resolveFaucetTracker(env).fetch(
+    new Request("http://do/chains/toggle", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ chainId, enabled: request.enabled }),
+    })
+  );
+  const payload = (await doRes.json()) as { chainId?: number; enabled?: boolean; error?: string };
+  if (doRes.status === 404) {
+    throw new BadRequestError(`Unknown faucet chain: ${rawChainId}`, "invalid_chain");
+  }
+  if (!doRes.ok) {
+    throw new Error(`Faucet chain toggle failed with status ${doRes.status}.`);
+  }
+  return jsonResponse({ ok: true, chainId: payload.chainId, enabled: payload.enabled });
 }
 
-function buildFaucetFundingKey(eoaAddress: string, supportMode: SupportMode): string {
-  return `faucet-funded:${supportMode}:${eoaAddress.toLowerCase()}`;
+// Counters live in the tracker's memory, so they need neither the faucet key nor an RPC.
+export async function handleFaucetMetrics(env: Env): Promise<Response> {
+  const doRes = await resolveFaucetTracker(env).fetch(new Request("http://do/metrics", { method: "GET" }));
+  if (!doRes.ok) {
+    throw new Error(`Faucet metrics lookup failed with status ${doRes.status}.`);
+  }
+  return jsonResponse(await doRes.json());
 }
 
-async function readFaucetFundingState(kv: KVNamespace, key: string): Promise<"pending" | "funded" | null> {
-  const raw = await kv.get(key);
-  if (!raw) {
-    return null;
+export function resolveFaucetTracker(env: Env): DurableObjectStub {
+  if (!env.FAUCET_TRACKER_DO) {
+    throw new Error("FAUCET_TRACKER_DO binding is not configured.");
   }
 
+  const id = env.FAUCET_TRACKER_DO.idFromName("global-faucet");
+  return env.FAUCET_TRACKER_DO.get(id);
+}
+
+const FAUCET_FUND_FIELDS = [
+  "eoaAddress",
+  "supportMode",
+  "antibot",
+] as const satisfies readonly (keyof FaucetFundRequestModel)[];
+
+function parseFaucetFundRequest(rawBody: string): FaucetFundRequestModel {
+  const request = parseJsonObject(rawBody, FAUCET_FUND_FIELDS, "faucet") as Partial<FaucetFundRequestModel>;
+  const eoaAddress = parseFaucetEOA(request.eoaAddress);
+  const supportMode = String(request.supportMode ?? "").trim();
+  if (!SUPPORT_MODES.has(supportMode)) {
+    throw new BadRequestError("Invalid supportMode.", "invalid_support_mode");
+  }
+  return { eoaAddress, supportMode: supportMode as SupportMode, antibot: parseFaucetAntibotProof(request.antibot) };
+}
+
+// Reported as `invalid_eoa` rather than the shared `invalid_address` so faucet clients can name the field.
+function parseFaucetEOA(value: unknown): string {
   try {
-    const parsed = JSON.parse(raw) as { state?: string };
-    if (parsed.state === "pending") {
-      return "pending";
-    }
-    if (parsed.state === "funded") {
-      return "funded";
-    }
+    return normalizeAddress(String(value ?? ""));
   } catch {
-    // Ignore malformed state and treat as not funded.
+    throw new BadRequestError("Invalid eoaAddress.", "invalid_eoa");
+  }
+}
+
+const FAUCET_CHAIN_TOGGLE_FIELDS = ["enabled"] as const satisfies readonly (keyof FaucetChainToggleRequestModel)[];
+
+function parseFaucetChainToggleRequest(rawBody: string): FaucetChainToggleRequestModel {
+  const request = parseJsonObject(rawBody, FAUCET_CHAIN_TOGGLE_FIELDS, "faucet chain toggle");
+  if (request.enabled !== undefined && typeof request.enabled !== "boolean") {
+    throw new BadRequestError("enabled must be a boolean.", "invalid_payload");
+  }
+  return { enabled: request.enabled };
+}
+
+function parseFaucetAntibotProof(value: unknown): FaucetAntibotProofModel | undefined {
+  if (value === undefined || value === null) {
+    return undefined;
+  }
+  if (typeof value !== "object" || Array.isArray(value)) {
+    throw new BadRequestError("Invalid antibot payload.", "invalid_payload");
   }
 
-  return null;
+  const proof = value as Record<string, unknown>;
+  const readString = (key: string) => (typeof proof[key] === "string" ? (proof[key] as string).trim() : undefined);
+  return {
+    token: readString("token"),
+    challenge: readString("challenge"),
+    solution: readString("solution"),
+    signature: readString("signature"),
+  };
 }
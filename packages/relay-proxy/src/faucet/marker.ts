@@ -0,0 +1,67 @@
+import { FAUCET_FUNDED_TTL_SECONDS, FAUCET_PENDING_TTL_SECONDS } from "../constants";
+import { ServiceUnavailableError } from "../errors";
+import type { Env, FaucetFundingReportModel, SupportMode } from "../relay/models";
+import { parseBooleanFlag } from "../utils";
+
+// KV markers are the worker's fast path for "already funded" / "funding pending". The worker
+// writes `pending` when it accepts a request; the faucet Durable Object settles it once the
+// queued job has run.
+export type FaucetFundingState = { state: "pending" | "funded"; report?: FaucetFundingReportModel };
+
+export function resolveFaucetFundingKV(env: Env): KVNamespace {
+  if (env.FAUCET_FUNDING_KV) {
+    return env.FAUCET_FUNDING_KV;
+  }
+
+  if (parseBooleanFlag(env.STRICT_CONFIG, false)) {
+    throw new ServiceUnavailableError(
+      "Missing required binding: FAUCET_FUNDING_KV (STRICT_CONFIG is enabled).",
+      "missing_config"
+    );
+  }
+
+  console.warn("FAUCET_FUNDING_KV is not bound; falling back to GAS_TANK_KV.");
+  return env.GAS_TANK_KV;
+}
+
+export function buildFaucetFundingKey(eoaAddress: string, supportMode: SupportMode): string {
+  return `faucet-funded:${supportMode}:${eoaAddress.toLowerCase()}`;
+}
+
+export async function readFaucetFundingState(kv: KVNamespace, key: string): Promise<FaucetFundingState | null> {
+  const raw = await kv.get(key);
+  if (!raw) {
+    return null;
+  }
+
+  try {
+    const parsed = JSON.parse(raw) as { state?: string; report?: FaucetFundingReportModel };
+    if (parsed.state === "pending") {
+      return { state: "pending" };
+    }
+    if (parsed.state === "funded") {
+      return { state: "funded", report: parsed.report };
+    }
+  } catch {
+    // Ignore malformed state and treat as not funded.
+  }
+
+  return null;
+}
+
+export async function markFaucetPending(kv: KVNamespace, key: string): Promise<void> {
+  await kv.put(key, JSON.stringify({ state: "pending", updatedAt: Date.now() }), {
+    expirationTtl: FAUCET_PENDING_TTL_SECONDS,
+  });
+}
+
+// `report` is absent when the Durable Object's own funding history vetoed the drip.
+export async function markFaucetFunded(
+  kv: KVNamespace,
+  key: string,
+  report: FaucetFundingReportModel | undefined
+): Promise<void> {
+  await kv.put(key, JSON.stringify({ state: "funded", updatedAt: Date.now(), report }), {
+    expirationTtl: FAUCET_FUNDED_TTL_SECONDS,
+  });
+}
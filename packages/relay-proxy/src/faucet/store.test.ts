@@ -0,0 +1,99 @@
+import { describe, expect, it } from "bun:test";
+
+import { createDurableObjectState } from "../../test/durable-object";
+import { sleep } from "../http";
+
+import {
+  type FaucetJobStatus,
+  SqliteFaucetFundingStore,
+  SqliteFaucetJobQueue,
+  SqliteFaucetJobStatusStore,
+} from "./store";
+
+const ALICE = "0x70997970C51812dc3A010C7d01b50e0d17dc79C8";
+const BOB = "0x3C44CdDdB6a900fa2b585dd299e03d12FA4293BC";
+
+describe("SqliteFaucetFundingStore", () => {
+  it("keeps the latest funding time per EOA, case-insensitively", async () => {
+    const store = new SqliteFaucetFundingStore(createDurableObjectState().storage.sql);
+    expect(await store.lastFunded(ALICE)).toBe(null);
+
+    await store.recordFunding(ALICE, 1_000);
+    await store.recordFunding(ALICE.toLowerCase(), 2_000);
+    expect(await store.lastFunded(ALICE)).toBe(2_000);
+    expect(await store.lastFunded(BOB)).toBe(null);
+  });
+
+  it("survives a restart of the object", async () => {
+    const { sql } = createDurableObjectState().storage;
+    await new SqliteFaucetFundingStore(sql).recordFunding(ALICE, 1_000);
+    expect(await new SqliteFaucetFundingStore(sql).lastFunded(ALICE)).toBe(1_000);
+  });
+});
+
+describe("SqliteFaucetJobQueue", () => {
+  const job = (jobID: string, recipientAddress: string) => ({
+    jobID,
+    recipientAddress,
+    fundingKey: `faucet-funded:LIMITED_TESTNET:${recipientAddress.toLowerCase()}`,
+    traceparent: null,
+    enqueuedAt: Date.now(),
+  });
+
+  it("hands out jobs in arrival order and forgets removed ones", async () => {
+    const queue = new SqliteFaucetJobQueue(createDurableObjectState().storage.sql);
+    await queue.enqueue(job("job-a", ALICE));
+    await queue.enqueue(job("job-b", BOB));
+    expect(await queue.depth()).toBe(2);
+
+    const first = await queue.next();
+    expect(first?.jobID).toBe("job-a");
+    await queue.remove(first!.id);
+    expect((await queue.next())?.jobID).toBe("job-b");
+    expect(await queue.depth()).toBe(1);
+  });
+
+  it("keeps one job per recipient", async () => {
+    const queue = new SqliteFaucetJobQueue(createDurableObjectState().storage.sql);
+    expect((await queue.enqueue(job("job-a", ALICE))).jobID).toBe("job-a");
+    expect((await queue.enqueue(job("job-again", ALICE.toLowerCase()))).jobID).toBe("job-a");
+    expect(await queue.depth()).toBe(1);
+    expect((await queue.find(ALICE))?.jobID).toBe("job-a");
+    expect(await queue.find(BOB)).toBe(null);
+  });
+});
+
+describe("SqliteFaucetJobStatusStore", () => {
+  const status: FaucetJobStatus = {
+    jobID: "job-a",
+    recipientAddress: ALICE,
+    state: "queued",
+    chains: [],
+    error: null,
+    createdAt: 1_000,
+    updatedAt: 1_000,
+  };
+
+  it("updates an entry in place and keeps its creation time", async () => {
+    const store = new SqliteFaucetJobStatusStore(createDurableObjectState().storage.sql);
+    await store.save(status, 60_000);
+    const chains = [{ chainId: 84532, status: "succeeded" as const, transfers: [] }];
+    await store.save({ ...status, state: "funded", chains, createdAt: 5_000, updatedAt: 2_000 }, 60_000);
+
+    expect(await store.get("job-a")).toEqual({
+      ...status,
+      recipientAddress: ALICE.toLowerCase(),
+      state: "funded",
+      chains,
+      updatedAt: 2_000,
+    });
+    expect(await store.get("job-b")).toBe(null);
+  });
+
+  it("stops returning entries once they expire", async () => {
+    const store = new SqliteFaucetJobStatusStore(createDurableObjectState().storage.sql);
+    await store.save(status, 1);
+    await sleep(5);
+    expect(await store.get("job-a")).toBe(null);
+  });
+});
@@ -0,0 +1,219 @@
+import type { FaucetChainResultModel } from "../relay/models";
+
+// Durable record of when each EOA was last funded. The KV marker read by the worker is the
+// fast path, but KV is eventually consistent and shared with other state; this store is the
+// faucet Durable Object's own source of truth for the cooldown.
+export interface FaucetFundingStore {
+  lastFunded(eoaAddress: string): Promise<number | null>;
+  recordFunding(eoaAddress: string, fundedAt: number): Promise<void>;
+}
+
+// Backed by the Durable Object's SQLite storage, so history survives deploys and evictions.
+export class SqliteFaucetFundingStore implements FaucetFundingStore {
+  private readonly sql: SqlStorage;
+
+  constructor(sql: SqlStorage) {
+    this.sql = sql;
+    this.sql.exec(
+      "CREATE TABLE IF NOT EXISTS faucet_funding (eoa TEXT PRIMARY KEY, funded_at INTEGER NOT NULL)"
+    );
+  }
+
+  async lastFunded(eoaAddress: string): Promise<number | null> {
+    const rows = this.sql
+      .exec<{ funded_at: number }>("SELECT funded_at FROM faucet_funding WHERE eoa = ?", eoaAddress.toLowerCase())
+      .toArray();
+    return rows.length > 0 ? rows[0].funded_at : null;
+  }
+
+  async recordFunding(eoaAddress: string, fundedAt: number): Promise<void> {
+    this.sql.exec(
+      "INSERT INTO faucet_funding (eoa, funded_at) VALUES (?, ?) ON CONFLICT(eoa) DO UPDATE SET funded_at = excluded.funded_at",
+      eoaAddress.toLowerCase(),
+      fundedAt
+    );
+  }
+}
+
+export interface FaucetJob {
+  id: number;
+  // Keys the job's FaucetJobStatus.
+  jobID: string;
+  recipientAddress: string;
+  fundingKey: string;
+  traceparent: string | null;
+  enqueuedAt: number;
+}
+
+// Funding jobs waiting for the faucet Durable Object's alarm. One row per recipient, so a
+// retried request while the first is still queued does not drip twice. A job stays queued
+// until its run finishes, so `find` also covers the job that is running.
+export interface FaucetJobQueue {
+  depth(): Promise<number>;
+  find(recipientAddress: string): Promise<FaucetJob | null>;
+  // Returns the recipient's job in the queue: `job` itself, or the one that was already there.
+  enqueue(job: Omit<FaucetJob, "id">): Promise<FaucetJob>;
+  next(): Promise<FaucetJob | null>;
+  remove(id: number): Promise<void>;
+}
+
+type FaucetQueueRow = {
+  id: number;
+  job_id: string;
+  recipient: string;
+  funding_key: string;
+  traceparent: string | null;
+  enqueued_at: number;
+};
+
+const QUEUE_COLUMNS = "id, job_id, recipient, funding_key, traceparent, enqueued_at";
+
+export class SqliteFaucetJobQueue implements FaucetJobQueue {
+  private readonly sql: SqlStorage;
+
+  constructor(sql: SqlStorage) {
+    this.sql = sql;
+    this.sql.exec(
+      "CREATE TABLE IF NOT EXISTS faucet_queue (id INTEGER PRIMARY KEY AUTOINCREMENT, job_id TEXT NOT NULL, " +
+        "recipient TEXT NOT NULL UNIQUE, funding_key TEXT NOT NULL, traceparent TEXT, enqueued_at INTEGER NOT NULL)"
+    );
+  }
+
+  async depth(): Promise<number> {
+    return this.sql.exec<{ depth: number }>("SELECT COUNT(*) AS depth FROM faucet_queue").one().depth;
+  }
+
+  async find(recipientAddress: string): Promise<FaucetJob | null> {
+    const rows = this.sql
+      .exec<FaucetQueueRow>(
+        `SELECT ${QUEUE_COLUMNS} FROM faucet_queue WHERE recipient = ?`,
+        recipientAddress.toLowerCase()
+      )
+      .toArray();
+    return rows.length === 0 ? null : toFaucetJob(rows[0]);
+  }
+
+  async enqueue(job: Omit<FaucetJob, "id">): Promise<FaucetJob> {
+    this.sql.exec(
+      "INSERT INTO faucet_queue (job_id, recipient, funding_key, traceparent, enqueued_at) VALUES (?, ?, ?, ?, ?) " +
+        "ON CONFLICT(recipient) DO NOTHING",
+      job.jobID,
+      job.recipientAddress.toLowerCase(),
+      job.fundingKey,
+      job.traceparent,
+      job.enqueuedAt
+    );
+    return (await this.find(job.recipientAddress))!;
+  }
+
+  async next(): Promise<FaucetJob | null> {
+    const rows = this.sql
+      .exec<FaucetQueueRow>(
+        `SELECT ${QUEUE_COLUMNS} FROM faucet_queue ORDER BY id LIMIT 1`
+      )
+      .toArray();
+    return rows.length === 0 ? null : toFaucetJob(rows[0]);
+  }
+
+  async remove(id: number): Promise<void> {
+    this.sql.exec("DELETE FROM faucet_queue WHERE id = ?", id);
+  }
+}
+
+function toFaucetJob(row: FaucetQueueRow): FaucetJob {
+  return {
+    id: row.id,
+    jobID: row.job_id,
+    recipientAddress: row.recipient,
+    fundingKey: row.funding_key,
+    traceparent: row.traceparent,
+    enqueuedAt: row.enqueued_at,
+  };
+}
+
+export type FaucetJobState = "queued" | "running" | "funded" | "already_funded" | "failed";
+
+export interface FaucetJobStatus {
+  jobID: string;
+  recipientAddress: string;
+  state: FaucetJobState;
+  // One entry per chain as it finishes, in funding order.
+  chains: FaucetChainResultModel[];
+  error: string | null;
+  createdAt: number;
+  updatedAt: number;
+}
+
+// Progress of each funding job, kept after the job leaves the queue so a dashboard can poll it
+// by ID. Entries expire `ttlMs` after their last update; expired rows are dropped on write.
+export interface FaucetJobStatusStore {
+  get(jobID: string): Promise<FaucetJobStatus | null>;
+  save(status: FaucetJobStatus, ttlMs: number): Promise<void>;
+}
+
+type FaucetJobStatusRow = {
+  job_id: string;
+  recipient: string;
+  state: string;
+  chains: string;
+  error: string | null;
+  created_at: number;
+  updated_at: number;
+};
+
+const JOB_STATUS_COLUMNS = "job_id, recipient, state, chains, error, created_at, updated_at";
+
+export class SqliteFaucetJobStatusStore implements FaucetJobStatusStore {
+  private readonly sql: SqlStorage;
+
+  constructor(sql: SqlStorage) {
+    this.sql = sql;
+    this.sql.exec(
+      "CREATE TABLE IF NOT EXISTS faucet_job_status (job_id TEXT PRIMARY KEY, recipient TEXT NOT NULL, " +
+        "state TEXT NOT NULL, chains TEXT NOT NULL, error TEXT, created_at INTEGER NOT NULL, " +
+        "updated_at INTEGER NOT NULL, expires_at INTEGER NOT NULL)"
+    );
+  }
+
+  async get(jobID: string): Promise<FaucetJobStatus | null> {
+    const rows = this.sql
+      .exec<FaucetJobStatusRow>(
+        `SELECT ${JOB_STATUS_COLUMNS} FROM faucet_job_status WHERE job_id = ? AND expires_at > ?`,
+        jobID,
+        Date.now()
+      )
+      .toArray();
+    return rows.length === 0 ? null : toFaucetJobStatus(rows[0]);
+  }
+
+  async save(status: FaucetJobStatus, ttlMs: number): Promise<void> {
+    const now = Date.now();
+    this.sql.exec("DELETE FROM faucet_job_status WHERE expires_at <= ?", now);
+    this.sql.exec(
+      "INSERT INTO faucet_job_status (job_id, recipient, state, chains, error, created_at, updated_at, expires_at) " +
+        "VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT(job_id) DO UPDATE SET state = excluded.state, " +
+        "chains = excluded.chains, error = excluded.error, updated_at = excluded.updated_at, " +
+        "expires_at = excluded.expires_at",
+      status.jobID,
+      status.recipientAddress.toLowerCase(),
+      status.state,
+      JSON.stringify(status.chains),
+      status.error,
+      status.createdAt,
+      status.updatedAt,
+      now + ttlMs
+    );
+  }
+}
+
+function toFaucetJobStatus(row: FaucetJobStatusRow): FaucetJobStatus {
+  return {
+    jobID: row.job_id,
+    recipientAddress: row.recipient,
+    state: row.state as FaucetJobState,
+    chains: JSON.parse(row.chains) as FaucetChainResultModel[],
+    error: row.error,
+    createdAt: row.created_at,
+    updatedAt: row.updated_at,
+  };
+}
@@ -0,0 +1,39 @@
+import { describeBreakers } from "./breaker";
+import type { Env } from "./relay/models";
+import { jsonResponse } from "./utils";
+
+// Set by the first request this isolate serves. Workers freeze the clock while module globals are
+// evaluated, so the start cannot be captured at import time.
+let isolateStartedAt: number | undefined;
+
+// True only for the first request, so per-isolate startup work runs once.
+export function recordIsolateStart(): boolean {
+  if (isolateStartedAt !== undefined) {
+    return false;
+  }
+  isolateStartedAt = Date.now();
+  return true;
+}
+
+// Liveness stays unconditional: every field is informational and missing build metadata only
+// leaves it null. BUILD_VERSION and BUILD_COMMIT are injected by `npm run deploy`.
+export function handleHealth(env: Env): Response {
+  const deployment = env.CF_VERSION_METADATA;
+  return jsonResponse({
+    ok: true,
+    service: "relay-proxy",
+    version: (env.BUILD_VERSION ?? "").trim() || null,
+    commit: (env.BUILD_COMMIT ?? "").trim() || null,
+    deploymentID: deployment?.id ?? null,
+    deployedAt: deployment?.timestamp ?? null,
+    uptimeSeconds: isolateStartedAt === undefined ? 0 : Math.floor((Date.now() - isolateStartedAt) / 1000),
+  });
+}
+
+// Readiness follows the upstream circuit breakers of the isolate that answers: `503` while any
+// of them is open, so a probe sees an upstream incident without waiting on the upstream itself.
+export function handleReadiness(env: Env): Response {
+  const dependencies = describeBreakers(env);
+  const ready = Object.values(dependencies).every((breaker) => breaker.state !== "open");
+  return jsonResponse({ ok: ready, dependencies }, ready ? 200 : 503);
+}
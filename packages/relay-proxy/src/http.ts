@@ -0,0 +1,73 @@
+export interface RetryPolicy {
+  maxAttempts: number;
+  baseDelayMs: number;
+}
+
+// Fetches with exponential backoff on network errors, `429` and `5xx`. Other client errors
+// will not succeed on retry and fail immediately. Throws once attempts are exhausted.
+export async function fetchWithRetry(url: string, init: RequestInit, policy: RetryPolicy): Promise<Response> {
+  for (let attempt = 1; ; attempt += 1) {
+    let retryable = true;
+    try {
+      const response = await fetch(url, init);
+      if (response.ok) {
+        return response;
+      }
+      retryable = response.status === 429 || response.status >= 500;
+      if (!retryable || attempt >= policy.maxAttempts) {
+        throw new Error(`${new URL(url).host} responded with status ${response.status}`);
+      }
+    } catch (error) {
+      if (!retryable || attempt >= policy.maxAttempts) {
+        throw error;
+      }
+    }
+    await sleep(policy.baseDelayMs * 2 ** (attempt - 1));
+  }
+}
+
+export function sleep(ms: number): Promise<void> {
+  return new Promise((resolve) => setTimeout(resolve, ms));
+}
+
+export type ContentCoding = "gzip" | "deflate";
+
+// Picks gzip over deflate; anything else (including `*` and a missing header) stays identity.
+// Codings listed with `q=0` are treated as refused.
+export function negotiateContentCoding(acceptEncoding: string | null): ContentCoding | null {
+  const accepted = new Set<string>();
+  for (const entry of (acceptEncoding ?? "").split(",")) {
+    const [coding, ...params] = entry.trim().toLowerCase().split(";");
+    const quality = params.map((param) => param.trim()).find((param) => param.startsWith("q="));
+    if (coding && (!quality || Number(quality.slice(2)) > 0)) {
+      accepted.add(coding.trim());
+    }
+  }
+  if (accepted.has("gzip")) {
+    return "gzip";
+  }
+  return accepted.has("deflate") ? "deflate" : null;
+}
+
+// Compresses a buffered response body when the client accepts it and the body is at least
+// `minBytes`. `encodeBody: "manual"` stops the runtime from encoding the bytes a second time.
+export async function compressResponse(request: Request, response: Response, minBytes: number): Promise<Response> {
+  response.headers.append("Vary", "Accept-Encoding");
+  const coding = negotiateContentCoding(request.headers.get("Accept-Encoding"));
+  if (!coding || !response.body || response.headers.has("Content-Encoding")) {
+    return response;
+  }
+
+  const body = await response.arrayBuffer();
+  if (body.byteLength < minBytes) {
+    return new Response(body, response);
+  }
+
+  const compressed = await new Response(
+    new Blob([body]).stream().pipeThrough(new CompressionStream(coding))
+  ).arrayBuffer();
+  const headers = new Headers(response.headers);
+  headers.set("Content-Encoding", coding);
+  headers.delete("Content-Length");
+  return new Response(compressed, { status: response.status, headers, encodeBody: "manual" });
+}
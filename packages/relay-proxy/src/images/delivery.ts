@@ -0,0 +1,193 @@
+import { BadRequestError, ServiceUnavailableError } from "../errors";
+import type { Env } from "../relay/models";
+import { resolveRequiredEnvValue } from "../utils";
+
+import { resolveDeliveryMode, resolvePinataGatewayBaseURL } from "./gateway";
+import { normalizeImageContentType } from "./sniff";
+
+export const CID_PLACEHOLDER = "{cid}";
+
+export type DeliveryTransform = "none" | "cf-images" | "pinata";
+
+export interface DeliveryVariant {
+  width?: number;
+  quality?: number;
+}
+
+const VARIANT_NAME_PATTERN = /^[a-z0-9_-]{1,32}$/;
+
+const DEFAULT_BROWSER_RENDERABLE_TYPES = ["image/jpeg", "image/png", "image/gif", "image/webp", "image/avif"];
+
+// Server-side sizing policy; clients pick variants by name and never build resize params themselves.
+const DEFAULT_DELIVERY_VARIANTS: Readonly<Record<string, DeliveryVariant>> = {
+  thumbnail: { width: 128, quality: 75 },
+  medium: { width: 512, quality: 80 },
+  full: {},
+};
+
+export function resolveDeliveryTransform(env: Env): DeliveryTransform {
+  const transform = (env.DELIVERY_TRANSFORM ?? "").trim().toLowerCase();
+  if (transform === "cf-images" || transform === "pinata") {
+    return transform;
+  }
+  return "none";
+}
+
+// DELIVERY_VARIANTS overrides the presets with a JSON object of name -> { width?, quality? }.
+export function resolveDeliveryVariants(env: Env): Record<string, DeliveryVariant> {
+  const raw = (env.DELIVERY_VARIANTS ?? "").trim();
+  if (!raw) {
+    return { ...DEFAULT_DELIVERY_VARIANTS };
+  }
+
+  let parsed: unknown;
+  try {
+    parsed = JSON.parse(raw);
+  } catch {
+    throw new ServiceUnavailableError("Invalid DELIVERY_VARIANTS: expected a JSON object.", "invalid_config");
+  }
+  if (!parsed || typeof parsed !== "object" || Array.isArray(parsed)) {
+    throw new ServiceUnavailableError("Invalid DELIVERY_VARIANTS: expected a JSON object.", "invalid_config");
+  }
+
+  const variants: Record<string, DeliveryVariant> = {};
+  for (const [name, value] of Object.entries(parsed)) {
+    if (!VARIANT_NAME_PATTERN.test(name) || !value || typeof value !== "object" || Array.isArray(value)) {
+      throw new ServiceUnavailableError(`Invalid DELIVERY_VARIANTS entry: ${name}`, "invalid_config");
+    }
+    const preset = value as { width?: unknown; quality?: unknown };
+    variants[name] = {
+      width: parseVariantInteger(preset.width, 1, 8192, name, "width"),
+      quality: parseVariantInteger(preset.quality, 1, 100, name, "quality"),
+    };
+  }
+  return variants;
+}
+
+// Returns the requested variant names, or every configured preset when the client did not ask.
+export function parseDeliveryVariantNames(value: unknown, env: Env): string[] {
+  const variants = resolveDeliveryVariants(env);
+  if (value === undefined || value === null) {
+    return Object.keys(variants);
+  }
+  if (!Array.isArray(value) || value.some((name) => typeof name !== "string")) {
+    throw new BadRequestError("variants must be an array of variant names.", "invalid_variant");
+  }
+
+  const names = [...new Set(value.map((name: string) => name.trim()))];
+  for (const name of names) {
+    if (!Object.hasOwn(variants, name)) {
+      throw new BadRequestError(`Unknown variant: ${name}`, "invalid_variant");
+    }
+  }
+  return names;
+}
+
+// Builds one URL per requested variant. Signed delivery has no variants: resize parameters
+// cannot be added to an access link without invalidating it. Pass CID_PLACEHOLDER as `cid` to
+// get templates for uploads whose CID is not known yet.
+export function buildDeliveryVariantURLs(
+  env: Env,
+  cid: string,
+  names: readonly string[] = Object.keys(resolveDeliveryVariants(env))
+): Record<string, string> {
+  const variants = resolveDeliveryVariants(env);
+  const urls: Record<string, string> = {};
+  if (resolveDeliveryMode(env) === "signed") {
+    return urls;
+  }
+  for (const name of names) {
+    urls[name] = buildDeliveryURL(env, cid, variants[name]);
+  }
+  return urls;
+}
+
+export function buildDeliveryURL(env: Env, cid: string, variant: DeliveryVariant = {}): string {
+  const rawURL = `${resolvePinataGatewayBaseURL(env)}/${cid}`;
+  const options = variant.width === undefined && variant.quality === undefined ? null : variant;
+  if (!options) {
+    return rawURL;
+  }
+
+  switch (resolveDeliveryTransform(env)) {
+    case "cf-images": {
+      const origin = resolveDeliveryTransformOrigin(env);
+      const params = [
+        options.width === undefined ? null : `width=${options.width}`,
+        options.quality === undefined ? null : `quality=${options.quality}`,
+        "fit=cover",
+      ].filter((param) => param !== null);
+      return `${origin}/cdn-cgi/image/${params.join(",")}/${rawURL}`;
+    }
+    case "pinata": {
+      const query = new URLSearchParams();
+      if (options.width !== undefined) {
+        query.set("img-width", String(options.width));
+      }
+      if (options.quality !== undefined) {
+        query.set("img-quality", String(options.quality));
+      }
+      return `${rawURL}?${query.toString()}`;
+    }
+    case "none":
+      return rawURL;
+  }
+}
+
+export interface BrowserRendition {
+  browserRenderable: boolean;
+  // A JPEG rendition for types an `<img>` cannot show (e.g. HEIC); null when none can be built.
+  browserFallbackURL: string | null;
+}
+
+// BROWSER_RENDERABLE_TYPES overrides the comma-separated list of types browsers display natively.
+// Only Image Resizing can convert formats, and a signed access link cannot carry its parameters,
+// so the fallback needs DELIVERY_TRANSFORM=cf-images and public delivery.
+export function describeBrowserRendition(env: Env, cid: string, contentType: string): BrowserRendition {
+  const raw = (env.BROWSER_RENDERABLE_TYPES ?? "").trim();
+  const renderable = raw
+    ? raw.split(",").map((entry) => normalizeImageContentType(entry))
+    : DEFAULT_BROWSER_RENDERABLE_TYPES;
+  if (renderable.includes(normalizeImageContentType(contentType))) {
+    return { browserRenderable: true, browserFallbackURL: null };
+  }
+
+  if (resolveDeliveryMode(env) === "signed" || resolveDeliveryTransform(env) !== "cf-images") {
+    return { browserRenderable: false, browserFallbackURL: null };
+  }
+  const rawURL = `${resolvePinataGatewayBaseURL(env)}/${cid}`;
+  return {
+    browserRenderable: false,
+    browserFallbackURL: `${resolveDeliveryTransformOrigin(env)}/cdn-cgi/image/format=jpeg/${rawURL}`,
+  };
+}
+
+function parseVariantInteger(
+  value: unknown,
+  min: number,
+  max: number,
+  name: string,
+  field: string
+): number | undefined {
+  if (value === undefined) {
+    return undefined;
+  }
+  if (typeof value !== "number" || !Number.isInteger(value) || value < min || value > max) {
+    throw new ServiceUnavailableError(
+      `Invalid DELIVERY_VARIANTS ${name}.${field}: expected ${min}-${max}.`,
+      "invalid_config"
+    );
+  }
+  return value;
+}
+
+// Cloudflare Image Resizing runs on a zone with resizing enabled and fetches the gateway URL as
+// the source.
+function resolveDeliveryTransformOrigin(env: Env): string {
+  const raw = resolveRequiredEnvValue(env.DELIVERY_TRANSFORM_ORIGIN, "DELIVERY_TRANSFORM_ORIGIN");
+  try {
+    return new URL(raw).origin;
+  } catch {
+    throw new ServiceUnavailableError("Invalid DELIVERY_TRANSFORM_ORIGIN.", "invalid_config");
+  }
+}
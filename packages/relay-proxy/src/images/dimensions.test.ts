@@ -0,0 +1,46 @@
+import { describe, expect, it } from "bun:test";
+
+import { readImageDimensions } from "./dimensions";
+
+const ascii = (value: string) => Array.from(value, (char) => char.charCodeAt(0));
+const uint16BE = (value: number) => [value >> 8, value & 0xff];
+const uint16LE = (value: number) => [value & 0xff, value >> 8];
+const uint24LE = (value: number) => [value & 0xff, (value >> 8) & 0xff, value >> 16];
+const uint32BE = (value: number) => [value >>> 24, (value >> 16) & 0xff, (value >> 8) & 0xff, value & 0xff];
+
+describe("readImageDimensions", () => {
+  it("reads the PNG IHDR chunk", () => {
+    const bytes = new Uint8Array([
+      0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, ...uint32BE(13), ...ascii("IHDR"), ...uint32BE(640),
+      ...uint32BE(480),
+    ]);
+    expect(readImageDimensions("image/png", bytes)).toEqual({ width: 640, height: 480 });
+  });
+
+  it("reads the GIF logical screen", () => {
+    const bytes = new Uint8Array([...ascii("GIF89a"), ...uint16LE(320), ...uint16LE(200)]);
+    expect(readImageDimensions("image/gif", bytes)).toEqual({ width: 320, height: 200 });
+  });
+
+  it("skips JPEG segments until the SOF marker", () => {
+    const bytes = new Uint8Array([
+      0xff, 0xd8, 0xff, 0xe0, ...uint16BE(16), ...new Array(14).fill(0), 0xff, 0xc0, ...uint16BE(17), 8,
+      ...uint16BE(1080), ...uint16BE(1920),
+    ]);
+    expect(readImageDimensions("image/jpeg", bytes)).toEqual({ width: 1920, height: 1080 });
+  });
+
+  it("reads the WebP VP8X canvas size", () => {
+    const bytes = new Uint8Array([
+      ...ascii("RIFF"), 0, 0, 0, 0, ...ascii("WEBPVP8X"), ...uint32BE(10).reverse(), 0, 0, 0, 0,
+      ...uint24LE(1023), ...uint24LE(767),
+    ]);
+    expect(readImageDimensions("image/webp", bytes)).toEqual({ width: 1024, height: 768 });
+  });
+
+  it("returns null for truncated headers and uncovered formats", () => {
+    expect(readImageDimensions("image/png", new Uint8Array(10))).toBeNull();
+    expect(readImageDimensions("image/jpeg", new Uint8Array([0xff, 0xd8, 0x00, 0x00]))).toBeNull();
+    expect(readImageDimensions("image/heic", new Uint8Array(64))).toBeNull();
+  });
+});
@@ -0,0 +1,89 @@
+import { readAscii, readUint32 } from "./sniff";
+
+// JPEG dimensions live in the SOF segment, which can sit behind large EXIF/ICC segments.
+export const DIMENSION_HEADER_BYTES = 65_536;
+
+const JPEG_SOF_MARKERS = new Set([0xc0, 0xc1, 0xc2, 0xc3, 0xc5, 0xc6, 0xc7, 0xc9, 0xca, 0xcb, 0xcd, 0xce, 0xcf]);
+
+export interface ImageDimensions {
+  width: number;
+  height: number;
+}
+
+// Reads width/height from the header bytes of a JPEG, PNG, GIF or WebP without decoding pixels.
+// Returns null when the format is not covered or the header is truncated.
+export function readImageDimensions(contentType: string, bytes: Uint8Array): ImageDimensions | null {
+  switch (contentType) {
+    case "image/jpeg":
+      return readJpegDimensions(bytes);
+    case "image/png":
+      return bytes.length >= 24 ? { width: readUint32(bytes, 16), height: readUint32(bytes, 20) } : null;
+    case "image/gif":
+      return bytes.length >= 10 ? { width: readUint16LE(bytes, 6), height: readUint16LE(bytes, 8) } : null;
+    case "image/webp":
+      return readWebpDimensions(bytes);
+    default:
+      return null;
+  }
+}
+
+function readJpegDimensions(bytes: Uint8Array): ImageDimensions | null {
+  let offset = 2;
+  while (offset + 4 <= bytes.length) {
+    if (bytes[offset] !== 0xff) {
+      return null;
+    }
+    const marker = bytes[offset + 1];
+    if (marker === 0xff) {
+      offset += 1;
+      continue;
+    }
+    // Standalone markers carry no length.
+    if (marker === 0x01 || (marker >= 0xd0 && marker <= 0xd9)) {
+      offset += 2;
+      continue;
+    }
+
+    const segmentLength = (bytes[offset + 2] << 8) | bytes[offset + 3];
+    if (JPEG_SOF_MARKERS.has(marker)) {
+      if (offset + 9 > bytes.length) {
+        return null;
+      }
+      return {
+        height: (bytes[offset + 5] << 8) | bytes[offset + 6],
+        width: (bytes[offset + 7] << 8) | bytes[offset + 8],
+      };
+    }
+    offset += 2 + segmentLength;
+  }
+  return null;
+}
+
+function readWebpDimensions(bytes: Uint8Array): ImageDimensions | null {
+  const chunk = readAscii(bytes, 12, 4);
+  if (chunk === "VP8 " && bytes.length >= 30) {
+    return { width: readUint16LE(bytes, 26) & 0x3fff, height: readUint16LE(bytes, 28) & 0x3fff };
+  }
+  if (chunk === "VP8L" && bytes.length >= 25) {
+    const b0 = bytes[21];
+    const b1 = bytes[22];
+    const b2 = bytes[23];
+    const b3 = bytes[24];
+    return {
+      width: 1 + (((b1 & 0x3f) << 8) | b0),
+      height: 1 + (((b3 & 0x0f) << 10) | (b2 << 2) | ((b1 & 0xc0) >> 6)),
+    };
+  }
+  if (chunk === "VP8X" && bytes.length >= 30) {
+    return { width: 1 + readUint24LE(bytes, 24), height: 1 + readUint24LE(bytes, 27) };
+  }
+  return null;
+}
+
+function readUint16LE(bytes: Uint8Array, offset: number): number {
+  return bytes[offset] | (bytes[offset + 1] << 8);
+}
+
+function readUint24LE(bytes: Uint8Array, offset: number): number {
+  return bytes[offset] | (bytes[offset + 1] << 8) | (bytes[offset + 2] << 16);
+}
@@ -0,0 +1,182 @@
+import { PinataSDK } from "pinata";
+
+import { type AuditIdentity, recordPresignAudit } from "../audit";
+import { CircuitOpenError, withCircuitBreaker } from "../breaker";
+import { BadRequestError, ServiceUnavailableError } from "../errors";
+import type { Env } from "../relay/models";
+import { parseBoundedInteger, resolveRequiredEnvValue } from "../utils";
+
+const CID_PATTERN = /^(Qm[1-9A-HJ-NP-Za-km-z]{44}|b[a-z2-7]{20,})$/;
+const GROUP_ROUTE_CONTENT_TYPE_PATTERN = /^image\/([a-z0-9.+-]+|\*)$/;
+const PINATA_GROUP_ID_PATTERN = /^[A-Za-z0-9-]{1,64}$/;
+const DEFAULT_SIGNED_URL_EXPIRES_SECONDS = 3600;
+const MAX_SIGNED_URL_EXPIRES_SECONDS = 7 * 24 * 60 * 60;
+
+export type DeliveryMode = "public" | "signed";
+
+export interface ResolvedDeliveryURL {
+  url: string;
+  // Null for public delivery; signed links should be refreshed before this instant.
+  expiresAt: string | null;
+}
+
+export function resolvePinataGatewayBaseURL(env: Env): string {
+  const raw = resolveRequiredEnvValue(env.PINATA_GATEWAY_BASE_URL, "PINATA_GATEWAY_BASE_URL")
+    .trim()
+    .replace(/\/+$/, "");
+  try {
+    const parsed = new URL(raw);
+    return `${parsed.origin}/ipfs`;
+  } catch {
+    throw new ServiceUnavailableError("Invalid PINATA_GATEWAY_BASE_URL.", "invalid_config");
+  }
+}
+
+// `signed` keeps uploads on Pinata's private network and serves them through expiring
+// gateway access links instead of permanent public URLs.
+export function resolveDeliveryMode(env: Env): DeliveryMode {
+  return (env.DELIVERY_MODE ?? "").trim().toLowerCase() === "signed" ? "signed" : "public";
+}
+
+export function resolveSignedURLExpirySeconds(env: Env): number {
+  return parseBoundedInteger(
+    env.DELIVERY_URL_EXPIRES_SECONDS ?? "",
+    60,
+    MAX_SIGNED_URL_EXPIRES_SECONDS,
+    DEFAULT_SIGNED_URL_EXPIRES_SECONDS
+  );
+}
+
+// File lookups have to target the network uploads are pinned to.
+export function resolvePinataFiles(pinata: PinataSDK, env: Env) {
+  return resolveDeliveryMode(env) === "signed" ? pinata.files.private : pinata.files.public;
+}
+
+// UPLOAD_GROUP_ROUTES sends uploads to a Pinata group by content type, e.g.
+// {"image/jpeg":"<group>","image/*":"<group>"}: an exact type wins over `image/*`, and anything
+// unmatched goes to PINATA_GROUP_ID. Delivery is by CID, so the group never changes a URL.
+export function resolveUploadGroupRoutes(env: Env): Map<string, string> {
+  const raw = (env.UPLOAD_GROUP_ROUTES ?? "").trim();
+  const routes = new Map<string, string>();
+  if (!raw) {
+    return routes;
+  }
+
+  let parsed: unknown;
+  try {
+    parsed = JSON.parse(raw);
+  } catch {
+    throw new ServiceUnavailableError("UPLOAD_GROUP_ROUTES must be a JSON object.", "invalid_config");
+  }
+  if (!parsed || typeof parsed !== "object" || Array.isArray(parsed)) {
+    throw new ServiceUnavailableError("UPLOAD_GROUP_ROUTES must be a JSON object.", "invalid_config");
+  }
+
+  for (const [key, groupID] of Object.entries(parsed)) {
+    const contentType = key.trim().toLowerCase();
+    if (!GROUP_ROUTE_CONTENT_TYPE_PATTERN.test(contentType)) {
+      throw new ServiceUnavailableError(`Invalid UPLOAD_GROUP_ROUTES content type: ${key}`, "invalid_config");
+    }
+    if (typeof groupID !== "string" || !PINATA_GROUP_ID_PATTERN.test(groupID.trim())) {
+      throw new ServiceUnavailableError(`Invalid UPLOAD_GROUP_ROUTES group for ${contentType}.`, "invalid_config");
+    }
+    routes.set(contentType, groupID.trim());
+  }
+  return routes;
+}
+
+export function resolveUploadGroupID(env: Env, contentType: string): string {
+  const routes = resolveUploadGroupRoutes(env);
+  const [type] = contentType.split("/");
+  return (
+    routes.get(contentType) ??
+    routes.get(`${type}/*`) ??
+    resolveRequiredEnvValue(env.PINATA_GROUP_ID, "PINATA_GROUP_ID")
+  );
+}
+
+// Every group an upload can land in, PINATA_GROUP_ID first.
+export function resolveImageGroupIDs(env: Env): string[] {
+  const defaultGroupID = resolveRequiredEnvValue(env.PINATA_GROUP_ID, "PINATA_GROUP_ID");
+  return [...new Set([defaultGroupID, ...resolveUploadGroupRoutes(env).values()])];
+}
+
+// A file list scoped to the image groups. One group is filtered by Pinata; Pinata cannot filter
+// on several, so with routing the query spans the account and callers keep only the files
+// `inImageGroups` accepts.
+export function listImageFiles(pinata: PinataSDK, env: Env) {
+  const groupIDs = resolveImageGroupIDs(env);
+  const query = resolvePinataFiles(pinata, env).list();
+  return {
+    query: groupIDs.length === 1 ? query.group(groupIDs[0]) : query,
+    inImageGroups: (file: { group_id: string | null }) => groupIDs.includes(file.group_id ?? ""),
+  };
+}
+
+// `issuedTo` is set when the link is handed to a caller, which audits signed links. Links the
+// worker only uses itself (e.g. ranged header reads) pass nothing.
+export async function resolveDeliveryURL(
+  env: Env,
+  cid: string,
+  issuedTo?: { identity: AuditIdentity; imageID: string | null }
+): Promise<ResolvedDeliveryURL> {
+  const gatewayBaseURL = resolvePinataGatewayBaseURL(env);
+  if (resolveDeliveryMode(env) === "public") {
+    return { url: `${gatewayBaseURL}/${cid}`, expiresAt: null };
+  }
+
+  const jwt = resolveRequiredEnvValue(env.PINATA_JWT, "PINATA_JWT");
+  const pinata = new PinataSDK({ pinataJwt: jwt, pinataGateway: new URL(gatewayBaseURL).host });
+  const expires = resolveSignedURLExpirySeconds(env);
+  const issuedAt = Date.now();
+
+  let url: string;
+  try {
+    url = await withCircuitBreaker(env, "pinata_api", async () =>
+      pinata.gateways.private.createAccessLink({ cid, expires })
+    );
+  } catch (err: unknown) {
+    if (err instanceof CircuitOpenError) {
+      throw err;
+    }
+    throw new BadRequestError(
+      `Pinata access link request failed: ${err instanceof Error ? err.message : String(err)}`,
+      "upstream_error"
+    );
+  }
+  const expiresAt = new Date(issuedAt + expires * 1000).toISOString();
+  if (issuedTo) {
+    recordPresignAudit(env, { ...issuedTo, method: "GET", cid, expiresAt });
+  }
+  return { url, expiresAt };
+}
+
+export function normalizeCID(value: string): string {
+  const trimmed = value.trim();
+  if (!CID_PATTERN.test(trimmed)) {
+    throw new BadRequestError("Invalid cid.", "invalid_cid");
+  }
+  return trimmed;
+}
+
+// Reads the first `length` bytes of a pinned object through the gateway with a ranged GET.
+// Gateways that ignore Range still work: the body is truncated client-side.
+export async function fetchGatewayBytes(env: Env, cid: string, length: number): Promise<Uint8Array> {
+  const { url } = await resolveDeliveryURL(env, cid);
+  return await withCircuitBreaker(env, "pinata_gateway", async () => {
+    const response = await fetch(url, {
+      method: "GET",
+      headers: { Range: `bytes=0-${length - 1}` },
+    });
+
+    if (response.status === 404) {
+      throw new BadRequestError(`Object ${cid} was not found on the gateway.`, "object_not_found");
+    }
+    if (!response.ok) {
+      throw new Error(`Gateway request for ${cid} failed with status ${response.status}.`);
+    }
+
+    const bytes = new Uint8Array(await response.arrayBuffer());
+    return bytes.slice(0, length);
+  });
+}
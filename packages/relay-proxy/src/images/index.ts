@@ -0,0 +1,6 @@
+export { handleInspectImage } from "./inspect";
+export { handleListImages } from "./list";
+export { handleImageRedirect } from "./redirect";
+export { handleRevokeImage } from "./revoke";
+export { handleVerifyImage } from "./verify";
+export { handleValidateImageDimensions } from "./validate";
@@ -0,0 +1,129 @@
+import { BadRequestError } from "../errors";
+import type { Env } from "../relay/models";
+import type { UploadAuthContext } from "../upload-token";
+import { jsonResponse } from "../utils";
+
+import { DIMENSION_HEADER_BYTES, type ImageDimensions, readImageDimensions } from "./dimensions";
+import { fetchGatewayBytes } from "./gateway";
+import { assertCanManageImage, findImageCID, parseImageID } from "./revoke";
+import { readAscii, sniffImageContentType } from "./sniff";
+
+// VP8X feature flags (byte 20 of the file).
+const VP8X_FLAG_EXIF = 0x08;
+const VP8X_FLAG_XMP = 0x04;
+const VP8X_FLAG_ANIMATION = 0x02;
+
+type WebpCompression = "lossy" | "lossless" | "unknown";
+
+interface WebpInfo {
+  compression: WebpCompression;
+  dimensions: ImageDimensions | null;
+  animated: boolean;
+  hasExif: boolean;
+  hasXmp: boolean;
+}
+
+// Reports how a stored avatar is encoded so the pipeline can decide whether to re-encode it.
+// Only the leading bytes are fetched; EXIF/XMP chunks usually trail the bitstream, so their
+// presence comes from the VP8X flags rather than from finding the chunks themselves.
+export async function handleInspectImage(
+  rawImageID: string,
+  env: Env,
+  auth: UploadAuthContext
+): Promise<Response> {
+  const parsed = parseImageID(rawImageID);
+  assertCanManageImage(parsed, auth, "Inspecting images");
+  const { imageID } = parsed;
+
+  const cid = await findImageCID(env, imageID);
+  if (!cid) {
+    throw new BadRequestError(`No uploaded file was found for ${imageID}.`, "image_not_found");
+  }
+
+  const bytes = await fetchGatewayBytes(env, cid, DIMENSION_HEADER_BYTES);
+  const contentType = sniffImageContentType(bytes);
+  if (contentType !== "image/webp") {
+    return jsonResponse({
+      ok: true,
+      imageID,
+      cid,
+      contentType,
+      webp: false,
+      recommendation: "re_encode",
+      reasons: ["not_webp"],
+    });
+  }
+
+  const info = readWebpInfo(bytes);
+  const reasons = recommendWebpChanges(info);
+  return jsonResponse({
+    ok: true,
+    imageID,
+    cid,
+    contentType,
+    webp: true,
+    compression: info.compression,
+    width: info.dimensions?.width ?? null,
+    height: info.dimensions?.height ?? null,
+    animated: info.animated,
+    metadata: { exif: info.hasExif, xmp: info.hasXmp },
+    recommendation: reasons.length === 0 ? "keep" : "re_encode",
+    reasons,
+  });
+}
+
+// Walks the RIFF chunk list just far enough to find the bitstream chunk. A simple file starts
+// with `VP8 ` or `VP8L`; an extended file starts with `VP8X` and the bitstream follows
+// optional ICCP/ANIM chunks.
+export function readWebpInfo(bytes: Uint8Array): WebpInfo {
+  const info: WebpInfo = {
+    compression: "unknown",
+    dimensions: readImageDimensions("image/webp", bytes),
+    animated: false,
+    hasExif: false,
+    hasXmp: false,
+  };
+
+  for (let offset = 12; offset + 8 <= bytes.length; ) {
+    const fourCC = readAscii(bytes, offset, 4);
+    const size = readUint32LE(bytes, offset + 4);
+
+    if (fourCC === "VP8 " || fourCC === "VP8L") {
+      info.compression = fourCC === "VP8L" ? "lossless" : "lossy";
+      break;
+    }
+    if (fourCC === "VP8X" && offset + 8 < bytes.length) {
+      const flags = bytes[offset + 8];
+      info.hasExif = (flags & VP8X_FLAG_EXIF) !== 0;
+      info.hasXmp = (flags & VP8X_FLAG_XMP) !== 0;
+      info.animated = (flags & VP8X_FLAG_ANIMATION) !== 0;
+    } else if (fourCC === "EXIF") {
+      info.hasExif = true;
+    } else if (fourCC === "XMP ") {
+      info.hasXmp = true;
+    }
+
+    // Chunk payloads are padded to an even length.
+    offset += 8 + size + (size % 2);
+  }
+
+  return info;
+}
+
+function recommendWebpChanges(info: WebpInfo): string[] {
+  const reasons: string[] = [];
+  if (info.compression === "lossless") {
+    reasons.push("lossless");
+  }
+  if (info.animated) {
+    reasons.push("animated");
+  }
+  if (info.hasExif || info.hasXmp) {
+    reasons.push("metadata_present");
+  }
+  return reasons;
+}
+
+function readUint32LE(bytes: Uint8Array, offset: number): number {
+  return (bytes[offset] | (bytes[offset + 1] << 8) | (bytes[offset + 2] << 16) | (bytes[offset + 3] << 24)) >>> 0;
+}
@@ -0,0 +1,73 @@
+import { beforeEach, describe, expect, it } from "bun:test";
+
+import { createKVNamespace } from "../../test/kv";
+import { pinata, seedPinnedFile } from "../../test/pinata";
+import type { Env } from "../relay/models";
+import type { UploadAuthContext } from "../upload-token";
+
+import { handleListImages } from "./list";
+import { handleRevokeImage } from "./revoke";
+
+const OWNER = "0x70997970c51812dc3a010c7d01b50e0d17dc79c8";
+const STRANGER = "0x3c44cdddb6a900fa2b585dd299e03d12fa4293bc";
+
+let env: Env;
+
+function tokenFor(eoaAddress: string): UploadAuthContext {
+  return { mode: "upload_token", eoaAddress, tenant: null };
+}
+
+async function list(eoaAddress: string, auth: UploadAuthContext) {
+  const response = await handleListImages(new URL(`https://relay.test/v1/images?eoa=${eoaAddress}`), env, auth);
+  return (await response.json()) as { images: { imageID: string }[] };
+}
+
+beforeEach(() => {
+  env = {
+    PINATA_JWT: "test-jwt",
+    PINATA_GROUP_ID: "group-avatars",
+    PINATA_GATEWAY_BASE_URL: "https://gateway.pinata.test/ipfs",
+    IMAGE_REVOCATION_KV: createKVNamespace(),
+  } as Env;
+  pinata.reset();
+  for (const owner of [OWNER, STRANGER]) {
+    seedPinnedFile({ group_id: "group-avatars", keyvalues: { owner, imageID: `avatars/${owner}/a.png` } });
+  }
+});
+
+describe("handleListImages authorization", () => {
+  it("lists only the authenticated EOA's images", async () => {
+    const { images } = await list(OWNER, tokenFor(OWNER));
+    expect(images.map((image) => image.imageID)).toEqual([`avatars/${OWNER}/a.png`]);
+  });
+
+  it("refuses another EOA's listing", async () => {
+    await expect(list(STRANGER, tokenFor(OWNER))).rejects.toMatchObject({ code: "eoa_mismatch" });
+  });
+
+  it("refuses the shared token, which carries no EOA", async () => {
+    const shared: UploadAuthContext = { mode: "shared_token", eoaAddress: null, tenant: null };
+    await expect(list(OWNER, shared)).rejects.toMatchObject({ code: "upload_token_required" });
+  });
+});
+
+describe("handleListImages revocations", () => {
+  it("leaves revoked images out", async () => {
+    seedPinnedFile({ group_id: "group-avatars", keyvalues: { owner: OWNER, imageID: `avatars/${OWNER}/b.png` } });
+    await handleRevokeImage(encodeURIComponent(`avatars/${OWNER}/a.png`), env, tokenFor(OWNER));
+
+    const { images } = await list(OWNER, tokenFor(OWNER));
+    expect(images.map((image) => image.imageID)).toEqual([`avatars/${OWNER}/b.png`]);
+  });
+});
+
+describe("handleListImages with UPLOAD_GROUP_ROUTES", () => {
+  it("lists files from every routed group and nothing outside them", async () => {
+    env.UPLOAD_GROUP_ROUTES = JSON.stringify({ "image/jpeg": "group-jpeg" });
+    seedPinnedFile({ group_id: "group-jpeg", keyvalues: { owner: OWNER, imageID: `avatars/${OWNER}/b.jpg` } });
+    seedPinnedFile({ group_id: "group-other", keyvalues: { owner: OWNER, imageID: `avatars/${OWNER}/c.png` } });
+
+    const { images } = await list(OWNER, tokenFor(OWNER));
+    expect(images.map((image) => image.imageID).sort()).toEqual([`avatars/${OWNER}/a.png`, `avatars/${OWNER}/b.jpg`]);
+  });
+});
@@ -0,0 +1,94 @@
+import { PinataSDK } from "pinata";
+
+import { CircuitOpenError, withCircuitBreaker } from "../breaker";
+import { toAuditIdentity } from "../audit";
+import { BadRequestError, ForbiddenError } from "../errors";
+import type { Env, UploadedImageModel } from "../relay/models";
+import type { UploadAuthContext } from "../upload-token";
+import { jsonResponse, normalizeAddress, parseBoundedInteger, resolveRequiredEnvValue } from "../utils";
+
+import { buildDeliveryVariantURLs, describeBrowserRendition } from "./delivery";
+import { listImageFiles, resolveDeliveryURL } from "./gateway";
+import { isStoredImageRevoked } from "./revoke";
+
+const LIST_DEFAULT_LIMIT = 20;
+const LIST_MAX_LIMIT = 100;
+
+// Lists avatars previously uploaded for an EOA, newest first, using the `owner` keyvalue
+// attached when the signed upload URL was created.
+export async function handleListImages(url: URL, env: Env, auth: UploadAuthContext): Promise<Response> {
+  const eoaAddress = normalizeAddress(url.searchParams.get("eoa") ?? "");
+  assertCanListImages(eoaAddress, auth);
+
+  const limit = parseBoundedInteger(url.searchParams.get("limit") ?? "", 1, LIST_MAX_LIMIT, LIST_DEFAULT_LIMIT);
+  const pageToken = (url.searchParams.get("pageToken") ?? "").trim();
+
+  const jwt = resolveRequiredEnvValue(env.PINATA_JWT, "PINATA_JWT");
+  const pinata = new PinataSDK({ pinataJwt: jwt });
+
+  const { query: files, inImageGroups } = listImageFiles(pinata, env);
+  let query = files
+    .keyvalues(auth.tenant ? { owner: eoaAddress, tenant: auth.tenant } : { owner: eoaAddress })
+    .order("DESC")
+    .limit(limit);
+  if (pageToken) {
+    query = query.pageToken(pageToken);
+  }
+
+  let result: Awaited<typeof query>;
+  try {
+    result = await withCircuitBreaker(env, "pinata_api", async () => await query);
+  } catch (err: unknown) {
+    if (err instanceof CircuitOpenError) {
+      throw err;
+    }
+    throw new BadRequestError(
+      `Pinata file list request failed: ${err instanceof Error ? err.message : String(err)}`,
+      "upstream_error"
+    );
+  }
+
+  // Pinata cannot filter on a missing keyvalue or on several groups, so default-tenant listings drop
+  // tenant files here, routed uploads drop files outside the image groups, and a page can come
+  // back shorter than `limit`. Revoked images are dropped the same way.
+  const candidates = result.files
+    .filter((file) => inImageGroups(file) && (auth.tenant || !file.keyvalues?.tenant))
+    .map((file) => ({ file, imageID: file.keyvalues?.imageID ?? file.name ?? file.id }));
+  const revoked = await Promise.all(
+    candidates.map(({ file, imageID }) => isStoredImageRevoked(env, file.cid, imageID))
+  );
+  const listed = candidates.filter((_, index) => !revoked[index]);
+  const images: UploadedImageModel[] = await Promise.all(
+    listed.map(async ({ file, imageID }) => {
+      const delivery = await resolveDeliveryURL(env, file.cid, { identity: toAuditIdentity(auth), imageID });
+      return {
+        imageID,
+        cid: file.cid,
+        deliveryURL: delivery.url,
+        deliveryURLExpiresAt: delivery.expiresAt,
+        variants: buildDeliveryVariantURLs(env, file.cid),
+        ...describeBrowserRendition(env, file.cid, file.mime_type),
+        size: file.size,
+        contentType: file.mime_type,
+        createdAt: file.created_at,
+      };
+    })
+  );
+
+  return jsonResponse({
+    ok: true,
+    images,
+    nextPageToken: result.next_page_token || null,
+  });
+}
+
+// Callers may only list their own authenticated EOA. Shared-token callers carry no identity, so
+// listing takes an upload token.
+function assertCanListImages(eoaAddress: string, auth: UploadAuthContext): void {
+  if (!auth.eoaAddress) {
+    throw new ForbiddenError("Listing images requires an upload token.", "upload_token_required");
+  }
+  if (auth.eoaAddress !== eoaAddress) {
+    throw new ForbiddenError("Authenticated EOA does not match eoa.", "eoa_mismatch");
+  }
+}
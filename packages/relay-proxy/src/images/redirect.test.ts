@@ -0,0 +1,94 @@
+import { beforeEach, describe, expect, it } from "bun:test";
+
+import { createKVNamespace } from "../../test/kv";
+import { pinata, seedPinnedFile } from "../../test/pinata";
+import type { Env } from "../relay/models";
+import type { UploadAuthContext } from "../upload-token";
+
+import { handleImageRedirect } from "./redirect";
+import { handleRevokeImage } from "./revoke";
+
+const OWNER = "0x976ea74026e726554db657fa54763abd0c3a0aa9";
+const IMAGE_ID = `avatars/${OWNER}/20260101000000000-a1b2c3d4-avatar.png`;
+const AUTH: UploadAuthContext = { mode: "upload_token", eoaAddress: OWNER, tenant: null };
+
+function redirectEnv(vars: Partial<Env> = {}): Env {
+  return {
+    PINATA_JWT: "test-jwt",
+    PINATA_GROUP_ID: "group-avatars",
+    PINATA_GATEWAY_BASE_URL: "https://gateway.pinata.test/ipfs",
+    IMAGE_REVOCATION_KV: createKVNamespace(),
+    ...vars,
+  } as Env;
+}
+
+const redirect = (env: Env, query = "", auth = AUTH) =>
+  handleImageRedirect(encodeURIComponent(IMAGE_ID), new URL(`https://relay.test/v1/images/x${query}`), env, auth);
+
+let cid: string;
+
+beforeEach(() => {
+  pinata.reset();
+  cid = seedPinnedFile({ group_id: "group-avatars", keyvalues: { owner: OWNER, imageID: IMAGE_ID } }).cid;
+});
+
+describe("handleImageRedirect", () => {
+  it("redirects to the public gateway URL of the pinned CID", async () => {
+    const response = await redirect(redirectEnv());
+    expect(response.status).toBe(302);
+    expect(response.headers.get("Location")).toBe(`https://gateway.pinata.test/ipfs/${cid}`);
+    expect(response.headers.get("Cache-Control")).toBe("private, max-age=300");
+  });
+
+  it("mints a fresh access link per request with signed delivery", async () => {
+    const response = await redirect(redirectEnv({ DELIVERY_MODE: "signed" }));
+    expect(response.headers.get("Location")).toMatch(new RegExp(`^https://gateway\\.pinata\\.test/files/${cid}\\?`));
+    expect(response.headers.get("Cache-Control")).toBe("private, no-store");
+    expect(pinata.accessLinks.map((link) => link.cid)).toEqual([cid]);
+  });
+
+  it("reports an imageID with no pinned file", async () => {
+    pinata.reset();
+    await expect(redirect(redirectEnv())).rejects.toMatchObject({ code: "image_not_found" });
+  });
+
+  it("refuses revoked images", async () => {
+    const env = redirectEnv();
+    await handleRevokeImage(encodeURIComponent(IMAGE_ID), env, AUTH);
+    await expect(redirect(env)).rejects.toMatchObject({ code: "image_revoked" });
+  });
+
+  it("surfaces a Pinata failure as upstream_error", async () => {
+    pinata.failNext = new Error("pinata is down");
+    await expect(redirect(redirectEnv())).rejects.toMatchObject({ code: "upstream_error" });
+  });
+});
+
+describe("handleImageRedirect variants and scope", () => {
+  it("redirects a variant to its transformed URL", async () => {
+    const env = redirectEnv({ DELIVERY_TRANSFORM: "pinata" });
+    const response = await redirect(env, "?variant=thumbnail");
+    expect(response.headers.get("Location")).toBe(
+      `https://gateway.pinata.test/ipfs/${cid}?img-width=128&img-quality=75`
+    );
+  });
+
+  it("signs a fresh link for every request", async () => {
+    const env = redirectEnv({ DELIVERY_MODE: "signed" });
+    const first = (await redirect(env)).headers.get("Location");
+    const second = (await redirect(env)).headers.get("Location");
+    expect(first).not.toBe(second);
+    expect(pinata.accessLinks.length).toBe(2);
+  });
+
+  it("refuses variants with signed delivery", async () => {
+    const env = redirectEnv({ DELIVERY_MODE: "signed" });
+    await expect(redirect(env, "?variant=thumbnail")).rejects.toMatchObject({ code: "invalid_variant" });
+  });
+
+  it("refuses another EOA's image before looking it up", async () => {
+    const stranger: UploadAuthContext = { ...AUTH, eoaAddress: "0x14dc79964da2c08b23698b3d3cc7ca32193d9955" };
+    pinata.failNext = new Error("pinata should not be called");
+    await expect(redirect(redirectEnv(), "", stranger)).rejects.toMatchObject({ code: "eoa_mismatch" });
+  });
+});
@@ -0,0 +1,56 @@
+import { toAuditIdentity } from "../audit";
+import { BadRequestError, ForbiddenError } from "../errors";
+import type { Env } from "../relay/models";
+import type { UploadAuthContext } from "../upload-token";
+import { corsResponse } from "../utils";
+
+import { buildDeliveryVariantURLs, parseDeliveryVariantNames } from "./delivery";
+import { resolveDeliveryMode, resolveDeliveryURL } from "./gateway";
+import { assertCanManageImage, findImageCID, isImageRevoked, parseImageID } from "./revoke";
+
+// Public URLs are content-addressed, so the redirect can be reused briefly; a signed link is minted
+// per request and must not outlive it in a cache.
+const PUBLIC_REDIRECT_MAX_AGE_SECONDS = 300;
+
+// A stable URL for an image that resolves to its current delivery URL. `?variant=` picks a resize
+// preset, which only public delivery has.
+export async function handleImageRedirect(
+  rawImageID: string,
+  url: URL,
+  env: Env,
+  auth: UploadAuthContext
+): Promise<Response> {
+  const parsed = parseImageID(rawImageID);
+  assertCanManageImage(parsed, auth, "Resolving images");
+  const { imageID } = parsed;
+
+  const cid = await findImageCID(env, imageID);
+  if (!cid) {
+    throw new BadRequestError(`Unknown image: ${imageID}`, "image_not_found");
+  }
+  if (await isImageRevoked(env, cid)) {
+    throw new ForbiddenError(`Image ${cid} has been revoked.`, "image_revoked");
+  }
+
+  const variant = url.searchParams.get("variant");
+  const signed = resolveDeliveryMode(env) === "signed";
+  let location: string;
+  if (variant === null) {
+    location = (await resolveDeliveryURL(env, cid, { identity: toAuditIdentity(auth), imageID })).url;
+  } else if (signed) {
+    throw new BadRequestError("Variants are not available with signed delivery.", "invalid_variant");
+  } else {
+    const [name] = parseDeliveryVariantNames([variant], env);
+    location = buildDeliveryVariantURLs(env, cid, [name])[name];
+  }
+
+  return corsResponse(
+    new Response(null, {
+      status: 302,
+      headers: {
+        Location: location,
+        "Cache-Control": signed ? "private, no-store" : `private, max-age=${PUBLIC_REDIRECT_MAX_AGE_SECONDS}`,
+      },
+    })
+  );
+}
@@ -0,0 +1,62 @@
+import { beforeEach, describe, expect, it } from "bun:test";
+
+import { createKVNamespace } from "../../test/kv";
+import { pinata, seedPinnedFile } from "../../test/pinata";
+import type { Env } from "../relay/models";
+import type { UploadAuthContext } from "../upload-token";
+
+import { handleRevokeImage } from "./revoke";
+
+const OWNER = "0x90f79bf6eb2c4f870365e785982e1f101e93b906";
+const IMAGE_ID = `avatars/${OWNER}/avatar.png`;
+
+function revokeEnv(): Env {
+  return { PINATA_JWT: "test-jwt", PINATA_GROUP_ID: "group-avatars", IMAGE_REVOCATION_KV: createKVNamespace() } as Env;
+}
+
+const revoke = (env: Env, auth: UploadAuthContext, imageID = IMAGE_ID) =>
+  handleRevokeImage(encodeURIComponent(imageID), env, auth);
+
+beforeEach(() => {
+  pinata.reset();
+  seedPinnedFile({ group_id: "group-avatars", keyvalues: { owner: OWNER, imageID: IMAGE_ID } });
+});
+
+describe("handleRevokeImage authorization", () => {
+  it("lets an upload token revoke its own EOA's image", async () => {
+    const env = revokeEnv();
+    const response = await revoke(env, { mode: "upload_token", eoaAddress: OWNER, tenant: null });
+    expect(response.status).toBe(200);
+    const recorded = JSON.parse((await env.IMAGE_REVOCATION_KV!.get(`image-revoked:${IMAGE_ID}`)) ?? "null");
+    expect(recorded?.cid).toBe(pinata.files[0].cid);
+  });
+
+  it("refuses another EOA's token", async () => {
+    const auth: UploadAuthContext = {
+      mode: "upload_token",
+      eoaAddress: "0x15d34aaf54267db7d7c367839aaf71a00a2c6a65",
+      tenant: null,
+    };
+    await expect(revoke(revokeEnv(), auth)).rejects.toMatchObject({ code: "eoa_mismatch" });
+  });
+
+  it("refuses the shared token even without REQUIRE_SIGNED_EOA", async () => {
+    const shared: UploadAuthContext = { mode: "shared_token", eoaAddress: null, tenant: null };
+    await expect(revoke(revokeEnv(), shared)).rejects.toMatchObject({ code: "upload_token_required" });
+  });
+
+  it("refuses images in another tenant", async () => {
+    const auth: UploadAuthContext = { mode: "tenant_token", eoaAddress: OWNER, tenant: "acme" };
+    await expect(revoke(revokeEnv(), auth)).rejects.toMatchObject({ code: "tenant_mismatch" });
+  });
+});
+
+describe("revocation store", () => {
+  it("requires IMAGE_REVOCATION_KV instead of falling back to GAS_TANK_KV", async () => {
+    const gasTank = createKVNamespace();
+    const env = { PINATA_JWT: "test-jwt", PINATA_GROUP_ID: "group-avatars", GAS_TANK_KV: gasTank } as Env;
+    const auth: UploadAuthContext = { mode: "upload_token", eoaAddress: OWNER, tenant: null };
+    await expect(revoke(env, auth)).rejects.toMatchObject({ code: "missing_config" });
+    expect(gasTank.entries.size).toBe(0);
+  });
+});
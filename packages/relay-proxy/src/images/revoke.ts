@@ -0,0 +1,138 @@
+import { PinataSDK } from "pinata";
+
+import { CircuitOpenError, withCircuitBreaker } from "../breaker";
+import { BadRequestError, ForbiddenError, ServiceUnavailableError } from "../errors";
+import type { Env, RevokedImageModel } from "../relay/models";
+import type { UploadAuthContext } from "../upload-token";
+import { jsonResponse, normalizeAddress, resolveRequiredEnvValue } from "../utils";
+
+import { listImageFiles, resolvePinataFiles } from "./gateway";
+
+// An optional tenant prefix (see TENANT_ID_PATTERN), then the EOA's avatar folder.
+const IMAGE_ID_PATTERN = /^(?:([a-z0-9][a-z0-9-]{0,62})\/)?avatars\/(0x[0-9a-fA-F]{40})\/[^/]+$/;
+
+export interface ParsedImageID {
+  imageID: string;
+  tenant: string | null;
+  eoaAddress: string;
+}
+
+// Pinata signed upload URLs cannot be invalidated before they expire, so revocation is a
+// block list enforced by this service rather than by the upload URL itself.
+const REVOCATION_LIMITATION =
+  "Signed upload URLs cannot be invalidated at Pinata before they expire. " +
+  "The image is blocked from verification here, but an upload through a leaked URL can still land in the gateway.";
+
+export async function handleRevokeImage(
+  rawImageID: string,
+  env: Env,
+  auth: UploadAuthContext
+): Promise<Response> {
+  const parsed = parseImageID(rawImageID);
+  assertCanManageImage(parsed, auth, "Revoking images");
+  const { imageID } = parsed;
+
+  const kv = resolveImageRevocationKV(env);
+  const cid = await findImageCID(env, imageID);
+  const revocation: RevokedImageModel = { imageID, cid, revokedAt: new Date().toISOString() };
+
+  await kv.put(buildImageRevocationKey(imageID), JSON.stringify(revocation));
+  if (cid) {
+    await kv.put(buildCIDRevocationKey(cid), JSON.stringify(revocation));
+  }
+
+  return jsonResponse({ ok: true, revoked: true, ...revocation, limitation: REVOCATION_LIMITATION });
+}
+
+// A CID is revoked if it was recorded at revoke time, or if it was uploaded afterwards
+// under an imageID that had already been revoked.
+export async function isImageRevoked(env: Env, cid: string): Promise<boolean> {
+  const kv = resolveImageRevocationKV(env);
+  if (await kv.get(buildCIDRevocationKey(cid))) {
+    return true;
+  }
+  if (!(env.PINATA_JWT ?? "").trim()) {
+    return false;
+  }
+
+  const pinata = new PinataSDK({ pinataJwt: env.PINATA_JWT });
+  const result = await withCircuitBreaker(env, "pinata_api", async () =>
+    resolvePinataFiles(pinata, env).list().cid(cid).limit(1)
+  );
+  const imageID = result.files[0]?.keyvalues?.imageID;
+  return Boolean(imageID && (await kv.get(buildImageRevocationKey(imageID))));
+}
+
+// For files whose imageID is already known, such as listing results, so no Pinata lookup is needed.
+export async function isStoredImageRevoked(env: Env, cid: string, imageID: string): Promise<boolean> {
+  const kv = resolveImageRevocationKV(env);
+  return Boolean((await kv.get(buildCIDRevocationKey(cid))) || (await kv.get(buildImageRevocationKey(imageID))));
+}
+
+export function parseImageID(rawImageID: string): ParsedImageID {
+  let imageID: string;
+  try {
+    imageID = decodeURIComponent(rawImageID);
+  } catch {
+    throw new BadRequestError("Invalid imageID.", "invalid_image_id");
+  }
+  const match = IMAGE_ID_PATTERN.exec(imageID);
+  if (!match) {
+    throw new BadRequestError("Invalid imageID.", "invalid_image_id");
+  }
+  return { imageID, tenant: match[1] ?? null, eoaAddress: normalizeAddress(match[2]) };
+}
+
+// Same policy as listing: callers only reach images in their own tenant and of their own
+// authenticated EOA, so shared-token callers need an upload token.
+export function assertCanManageImage(
+  { tenant, eoaAddress }: ParsedImageID,
+  auth: UploadAuthContext,
+  action: string
+): void {
+  if (tenant !== auth.tenant) {
+    throw new ForbiddenError("Image belongs to another tenant.", "tenant_mismatch");
+  }
+  if (!auth.eoaAddress) {
+    throw new ForbiddenError(`${action} requires an upload token.`, "upload_token_required");
+  }
+  if (auth.eoaAddress !== eoaAddress) {
+    throw new ForbiddenError("Authenticated EOA does not own this image.", "eoa_mismatch");
+  }
+}
+
+export async function findImageCID(env: Env, imageID: string): Promise<string | null> {
+  const jwt = resolveRequiredEnvValue(env.PINATA_JWT, "PINATA_JWT");
+  const pinata = new PinataSDK({ pinataJwt: jwt });
+  const { query, inImageGroups } = listImageFiles(pinata, env);
+
+  try {
+    const result = await withCircuitBreaker(env, "pinata_api", async () => query.keyvalues({ imageID }).limit(1));
+    return result.files.find(inImageGroups)?.cid ?? null;
+  } catch (err: unknown) {
+    if (err instanceof CircuitOpenError) {
+      throw err;
+    }
+    throw new BadRequestError(
+      `Pinata file lookup failed: ${err instanceof Error ? err.message : String(err)}`,
+      "upstream_error"
+    );
+  }
+}
+
+// Revocations get their own namespace: sharing GAS_TANK_KV would let a key collision or a bulk
+// cleanup of gas tank data silently unblock a revoked image.
+function resolveImageRevocationKV(env: Env): KVNamespace {
+  if (!env.IMAGE_REVOCATION_KV) {
+    throw new ServiceUnavailableError("Missing required binding: IMAGE_REVOCATION_KV.", "missing_config");
+  }
+  return env.IMAGE_REVOCATION_KV;
+}
+
+function buildImageRevocationKey(imageID: string): string {
+  return `image-revoked:${imageID.toLowerCase()}`;
+}
+
+function buildCIDRevocationKey(cid: string): string {
+  return `image-revoked-cid:${cid}`;
+}
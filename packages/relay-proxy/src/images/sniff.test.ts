@@ -0,0 +1,42 @@
+import { describe, expect, it } from "bun:test";
+
+import { isSameImageFamily, normalizeImageContentType, sniffImageContentType } from "./sniff";
+
+const ascii = (value: string) => Array.from(value, (char) => char.charCodeAt(0));
+
+function ftyp(...brands: string[]): Uint8Array {
+  const [major, ...compatible] = brands;
+  const size = 16 + compatible.length * 4;
+  return new Uint8Array([0, 0, 0, size, ...ascii("ftyp"), ...ascii(major), 0, 0, 0, 0, ...compatible.flatMap(ascii)]);
+}
+
+describe("sniffImageContentType", () => {
+  it("detects formats from their magic bytes", () => {
+    expect(sniffImageContentType(new Uint8Array([0xff, 0xd8, 0xff, 0xe0]))).toBe("image/jpeg");
+    expect(sniffImageContentType(new Uint8Array([0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a]))).toBe("image/png");
+    expect(sniffImageContentType(new Uint8Array(ascii("GIF89a")))).toBe("image/gif");
+    expect(sniffImageContentType(new Uint8Array(ascii("RIFF\0\0\0\0WEBPVP8 ")))).toBe("image/webp");
+  });
+
+  it("reads ISO-BMFF brands, including compatible ones", () => {
+    expect(sniffImageContentType(ftyp("avif", "mif1"))).toBe("image/avif");
+    expect(sniffImageContentType(ftyp("heic", "mif1"))).toBe("image/heic");
+    expect(sniffImageContentType(ftyp("mp42", "isom"))).toBeNull();
+  });
+
+  it("returns null for unknown or truncated content", () => {
+    expect(sniffImageContentType(new Uint8Array(ascii("<svg")))).toBeNull();
+    expect(sniffImageContentType(new Uint8Array([0xff, 0xd8]))).toBeNull();
+  });
+});
+
+describe("content type helpers", () => {
+  it("normalizes image/jpg to image/jpeg", () => {
+    expect(normalizeImageContentType(" Image/JPG ")).toBe("image/jpeg");
+  });
+
+  it("treats HEIC and HEIF as one family", () => {
+    expect(isSameImageFamily("image/heif", "image/heic")).toBe(true);
+    expect(isSameImageFamily("image/png", "image/jpeg")).toBe(false);
+  });
+});
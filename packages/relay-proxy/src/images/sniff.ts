@@ -0,0 +1,77 @@
+export const SNIFF_LENGTH_BYTES = 512;
+
+const HEIC_BRANDS = new Set(["heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1"]);
+const AVIF_BRANDS = new Set(["avif", "avis"]);
+
+export function normalizeImageContentType(value: string): string {
+  const normalized = value.trim().toLowerCase();
+  return normalized === "image/jpg" ? "image/jpeg" : normalized;
+}
+
+// Detects the image type from leading magic bytes. Returns null for unrecognized content.
+export function sniffImageContentType(bytes: Uint8Array): string | null {
+  if (startsWith(bytes, [0xff, 0xd8, 0xff])) {
+    return "image/jpeg";
+  }
+  if (startsWith(bytes, [0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a])) {
+    return "image/png";
+  }
+  if (readAscii(bytes, 0, 6) === "GIF87a" || readAscii(bytes, 0, 6) === "GIF89a") {
+    return "image/gif";
+  }
+  if (readAscii(bytes, 0, 4) === "RIFF" && readAscii(bytes, 8, 4) === "WEBP") {
+    return "image/webp";
+  }
+  return sniffIsoBmffImage(bytes);
+}
+
+// HEIC/HEIF and AVIF are ISO-BMFF files whose first box is `ftyp` with an image brand.
+function sniffIsoBmffImage(bytes: Uint8Array): string | null {
+  if (readAscii(bytes, 4, 4) !== "ftyp") {
+    return null;
+  }
+
+  const boxSize = readUint32(bytes, 0);
+  const end = Math.min(bytes.length, boxSize > 0 ? boxSize : bytes.length);
+  const brands = [readAscii(bytes, 8, 4)];
+  for (let offset = 16; offset + 4 <= end; offset += 4) {
+    brands.push(readAscii(bytes, offset, 4));
+  }
+
+  if (brands.some((brand) => AVIF_BRANDS.has(brand))) {
+    return "image/avif";
+  }
+  if (brands.some((brand) => HEIC_BRANDS.has(brand))) {
+    return "image/heic";
+  }
+  return null;
+}
+
+export function isSameImageFamily(declared: string, detected: string): boolean {
+  const heifFamily = new Set(["image/heic", "image/heif"]);
+  if (heifFamily.has(declared) && heifFamily.has(detected)) {
+    return true;
+  }
+  return declared === detected;
+}
+
+export function startsWith(bytes: Uint8Array, prefix: readonly number[], offset = 0): boolean {
+  if (bytes.length < offset + prefix.length) {
+    return false;
+  }
+  return prefix.every((value, index) => bytes[offset + index] === value);
+}
+
+export function readAscii(bytes: Uint8Array, offset: number, length: number): string {
+  if (bytes.length < offset + length) {
+    return "";
+  }
+  return String.fromCharCode(...bytes.subarray(offset, offset + length));
+}
+
+export function readUint32(bytes: Uint8Array, offset: number): number {
+  if (bytes.length < offset + 4) {
+    return 0;
+  }
+  return ((bytes[offset] << 24) | (bytes[offset + 1] << 16) | (bytes[offset + 2] << 8) | bytes[offset + 3]) >>> 0;
+}
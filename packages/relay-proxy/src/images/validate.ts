@@ -0,0 +1,71 @@
+import type { Env } from "../relay/models";
+import { jsonResponse, parseBoundedInteger, parseJsonObject } from "../utils";
+
+import { DIMENSION_HEADER_BYTES, type ImageDimensions, readImageDimensions } from "./dimensions";
+import { fetchGatewayBytes, normalizeCID } from "./gateway";
+import { sniffImageContentType } from "./sniff";
+
+interface DimensionBounds {
+  minDimension: number;
+  maxDimension: number;
+  maxAspectRatio: number;
+}
+
+// Presigned uploads cannot constrain pixel dimensions, so avatars are checked after upload.
+export async function handleValidateImageDimensions(rawBody: string, env: Env): Promise<Response> {
+  const cid = parseValidateDimensionsRequest(rawBody);
+  const bytes = await fetchGatewayBytes(env, cid, DIMENSION_HEADER_BYTES);
+  const contentType = sniffImageContentType(bytes);
+  const dimensions = contentType ? readImageDimensions(contentType, bytes) : null;
+
+  if (!dimensions) {
+    return jsonResponse({
+      ok: true,
+      cid,
+      contentType,
+      supported: false,
+      reason: "unsupported for dimension check",
+    });
+  }
+
+  const bounds = resolveDimensionBounds(env);
+  const violations = checkDimensions(dimensions, bounds);
+  return jsonResponse({
+    ok: true,
+    cid,
+    contentType,
+    supported: true,
+    width: dimensions.width,
+    height: dimensions.height,
+    passes: violations.length === 0,
+    violations,
+    bounds,
+  });
+}
+
+function parseValidateDimensionsRequest(rawBody: string): string {
+  const payload = parseJsonObject(rawBody, ["cid"], "validate-dimensions");
+  return normalizeCID(String(payload.cid ?? ""));
+}
+
+function resolveDimensionBounds(env: Env): DimensionBounds {
+  const minDimension = parseBoundedInteger(env.IMAGE_MIN_DIMENSION ?? "64", 1, 16_384, 64);
+  const maxDimension = Math.max(minDimension, parseBoundedInteger(env.IMAGE_MAX_DIMENSION ?? "4096", 1, 16_384, 4096));
+  const parsedRatio = Number(env.IMAGE_MAX_ASPECT_RATIO ?? "1.25");
+  const maxAspectRatio = Number.isFinite(parsedRatio) && parsedRatio >= 1 ? parsedRatio : 1.25;
+  return { minDimension, maxDimension, maxAspectRatio };
+}
+
+function checkDimensions({ width, height }: ImageDimensions, bounds: DimensionBounds): string[] {
+  const violations: string[] = [];
+  if (Math.min(width, height) < bounds.minDimension) {
+    violations.push("below_min_dimension");
+  }
+  if (Math.max(width, height) > bounds.maxDimension) {
+    violations.push("above_max_dimension");
+  }
+  if (Math.min(width, height) === 0 || Math.max(width, height) / Math.min(width, height) > bounds.maxAspectRatio) {
+    violations.push("aspect_ratio_out_of_bounds");
+  }
+  return violations;
+}
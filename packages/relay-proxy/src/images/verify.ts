@@ -0,0 +1,42 @@
+import { BadRequestError, ForbiddenError } from "../errors";
+import type { Env, VerifyImageRequestModel } from "../relay/models";
+import { jsonResponse, parseJsonObject } from "../utils";
+
+import { fetchGatewayBytes, normalizeCID } from "./gateway";
+import { isImageRevoked } from "./revoke";
+import { SNIFF_LENGTH_BYTES, isSameImageFamily, normalizeImageContentType, sniffImageContentType } from "./sniff";
+import { scheduleUploadWebhook } from "./webhook";
+
+export async function handleVerifyImage(rawBody: string, env: Env, ctx: ExecutionContext): Promise<Response> {
+  const request = parseVerifyImageRequest(rawBody);
+  if (await isImageRevoked(env, request.cid)) {
+    throw new ForbiddenError(`Image ${request.cid} has been revoked.`, "image_revoked");
+  }
+
+  const bytes = await fetchGatewayBytes(env, request.cid, SNIFF_LENGTH_BYTES);
+  const detectedContentType = sniffImageContentType(bytes);
+  const matches = detectedContentType !== null && isSameImageFamily(request.contentType, detectedContentType);
+
+  if (matches) {
+    scheduleUploadWebhook(env, ctx, request.cid, detectedContentType);
+  }
+
+  return jsonResponse({
+    ok: true,
+    cid: request.cid,
+    declaredContentType: request.contentType,
+    detectedContentType,
+    matches,
+  });
+}
+
+function parseVerifyImageRequest(rawBody: string): VerifyImageRequestModel {
+  const request = parseJsonObject(rawBody, ["cid", "contentType"], "verify") as Partial<VerifyImageRequestModel>;
+  const cid = normalizeCID(String(request.cid ?? ""));
+  const contentType = normalizeImageContentType(String(request.contentType ?? ""));
+  if (!contentType.startsWith("image/")) {
+    throw new BadRequestError("Invalid contentType.", "invalid_content_type");
+  }
+
+  return { cid, contentType };
+}
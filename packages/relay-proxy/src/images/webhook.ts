@@ -0,0 +1,71 @@
+import { PinataSDK } from "pinata";
+
+import { withCircuitBreaker } from "../breaker";
+import { fetchWithRetry } from "../http";
+import type { Env, UploadWebhookPayloadModel } from "../relay/models";
+import { hmacHex, resolveRequiredEnvValue } from "../utils";
+
+import { resolveDeliveryURL, resolvePinataFiles } from "./gateway";
+
+const WEBHOOK_RETRY_POLICY = { maxAttempts: 4, baseDelayMs: 500 };
+
+// Notifies the app backend that an upload was verified. Runs after the response is sent and
+// never fails the verify request: delivery errors are retried with backoff, then logged.
+export function scheduleUploadWebhook(env: Env, ctx: ExecutionContext, cid: string, contentType: string): void {
+  const webhookURL = (env.UPLOAD_WEBHOOK_URL ?? "").trim();
+  if (!webhookURL) {
+    return;
+  }
+
+  ctx.waitUntil(
+    deliverUploadWebhook(env, webhookURL, cid, contentType).catch((error: unknown) => {
+      const reason = error instanceof Error ? error.message : "unknown webhook error";
+      console.error(`upload webhook for ${cid} failed permanently`, reason);
+    })
+  );
+}
+
+async function deliverUploadWebhook(env: Env, webhookURL: string, cid: string, contentType: string): Promise<void> {
+  const secret = resolveRequiredEnvValue(env.UPLOAD_WEBHOOK_SECRET, "UPLOAD_WEBHOOK_SECRET");
+  const payload = await buildUploadWebhookPayload(env, cid, contentType);
+  const body = JSON.stringify(payload);
+  const signature = await hmacHex(secret, body);
+
+  await fetchWithRetry(
+    webhookURL,
+    { method: "POST", headers: { "Content-Type": "application/json", "X-Signature": signature }, body },
+    WEBHOOK_RETRY_POLICY
+  );
+}
+
+// The verify request only carries the CID; owner and imageID come from the keyvalues
+// attached when the signed upload URL was created.
+async function buildUploadWebhookPayload(
+  env: Env,
+  cid: string,
+  contentType: string
+): Promise<UploadWebhookPayloadModel> {
+  const jwt = resolveRequiredEnvValue(env.PINATA_JWT, "PINATA_JWT");
+  const pinata = new PinataSDK({ pinataJwt: jwt });
+  const result = await withCircuitBreaker(env, "pinata_api", async () =>
+    resolvePinataFiles(pinata, env).list().cid(cid).limit(1)
+  );
+  const file = result.files[0];
+  const eoa = file?.keyvalues?.owner ?? null;
+  const tenant = file?.keyvalues?.tenant ?? null;
+  const imageID = file?.keyvalues?.imageID ?? null;
+  const identity = { authMode: "webhook" as const, eoaAddress: eoa, tenant };
+  const delivery = await resolveDeliveryURL(env, cid, { identity, imageID });
+
+  return {
+    eoa,
+    tenant,
+    imageID,
+    cid,
+    deliveryURL: delivery.url,
+    deliveryURLExpiresAt: delivery.expiresAt,
+    size: file?.size ?? null,
+    contentType,
+    verifiedAt: new Date().toISOString(),
+  };
+}
@@ -0,0 +1,138 @@
+import { describe, expect, it } from "bun:test";
+
+import type { Env } from "./relay/models";
+
+import worker from "./index";
+
+// Sends one request through the worker and returns the response with the metrics it wrote.
+async function send(
+  method: string,
+  path: string,
+  { headers = {}, body, vars = {} }: { headers?: Record<string, string>; body?: string; vars?: Partial<Env> } = {}
+) {
+  const points: AnalyticsEngineDataPoint[] = [];
+  const env = { METRICS: { writeDataPoint: (point) => points.push(point) }, ...vars } as Env;
+  const ctx = { waitUntil: () => {}, passThroughOnException: () => {} } as unknown as ExecutionContext;
+  const response = await worker.fetch(new Request(`https://relay.test${path}`, { method, headers, body }), env, ctx);
+  return { response, points };
+}
+
+async function routeLabel(method: string, path: string): Promise<string> {
+  const { points } = await send(method, path);
+  const duration = points.find((point) => point.blobs?.[0] === "request_duration_ms");
+  return String(duration?.blobs?.[4]);
+}
+
+describe("request_duration_ms", () => {
+  it("labels exact paths by the path itself", async () => {
+    expect(await routeLabel("GET", "/health")).toBe("GET /health");
+  });
+
+  it("labels pattern paths by the route, not the ID in the URL", async () => {
+    expect(await routeLabel("GET", "/v1/faucet/jobs/0b6f2c1e-8d4a-4f3e-9a51-7c2d0e6b1f90")).toBe(
+      "GET /v1/faucet/jobs/:jobID"
+    );
+    expect(await routeLabel("POST", "/v1/images/avatars%2F0xabc%2F1.png/revoke")).toBe(
+      "POST /v1/images/:imageID/revoke"
+    );
+  });
+
+  it("sends only encoded imageIDs to the image redirect route", async () => {
+    expect(await routeLabel("GET", "/v1/images/avatars%2F0xabc%2F1.png")).toBe("GET /v1/images/:imageID");
+    expect(await routeLabel("GET", "/v1/images/verify")).toBe("unmatched");
+  });
+
+  it("labels paths and methods no route serves as unmatched", async () => {
+    expect(await routeLabel("GET", "/v1/nope")).toBe("unmatched");
+    expect(await routeLabel("GET", "/v1/faucet/chains/84532/toggle")).toBe("unmatched");
+  });
+});
+
+describe("preflight", () => {
+  const preflight = (path: string, requestMethod: string) =>
+    send("OPTIONS", path, {
+      headers: { Origin: "https://app.knot.test", "Access-Control-Request-Method": requestMethod },
+    });
+
+  it("answers 204 with the route's methods for a real route", async () => {
+    const { response } = await preflight("/v1/faucet/jobs/0b6f2c1e", "GET");
+    expect(response.status).toBe(204);
+    expect(response.headers.get("Access-Control-Allow-Methods")).toBe("GET,OPTIONS");
+    expect(await response.text()).toBe("");
+  });
+
+  it("answers 404 for a path no route serves", async () => {
+    const { response } = await preflight("/v1/nope", "GET");
+    expect(response.status).toBe(404);
+  });
+
+  it("leaves out a method the path does not register", async () => {
+    const { response } = await preflight("/health", "POST");
+    expect(response.status).toBe(204);
+    expect(response.headers.get("Access-Control-Allow-Methods")).toBe("GET,OPTIONS");
+  });
+});
+
+describe("request body cap", () => {
+  const post = (body: string) =>
+    send("POST", "/v1/faucet/fund", { headers: { "Content-Type": "application/json" }, body });
+
+  it("answers 413 for a body over the default 64 KiB before any handler runs", async () => {
+    const { response } = await post(JSON.stringify({ eoaAddress: "0x".padEnd(70_000, "0") }));
+    expect(response.status).toBe(413);
+    const { error } = (await response.json()) as { error: { code: string } };
+    expect(error.code).toBe("payload_too_large");
+  });
+});
+
+describe("maintenance mode", () => {
+  const vars = { MAINTENANCE_MODE: "true" };
+
+  it("answers 503 maintenance_mode on upload and faucet routes", async () => {
+    for (const path of ["/v1/images/direct-upload", "/v1/images/direct-upload/batch", "/v1/faucet/fund"]) {
+      const { response } = await send("POST", path, { body: "{}", vars });
+      expect(response.status).toBe(503);
+      const { error } = (await response.json()) as { error: { code: string } };
+      expect(error.code).toBe("maintenance_mode");
+    }
+  });
+
+  it("keeps health and read routes up", async () => {
+    for (const path of ["/health", "/v1/capabilities"]) {
+      const { response } = await send("GET", path, { vars });
+      expect(response.status).toBe(200);
+    }
+  });
+});
+
+describe("LOG_SAMPLE_RATE", () => {
+  // Sends `count` requests and returns how many wrote the per-request log line.
+  async function loggedRequests(path: string, count: number, rate: string): Promise<number> {
+    const original = console.log;
+    let logged = 0;
+    console.log = (line: unknown) => {
+      if (typeof line === "string" && line.includes('"requestId"')) {
+        logged += 1;
+      }
+    };
+    try {
+      for (let i = 0; i < count; i += 1) {
+        await send("GET", path, { vars: { LOG_SAMPLE_RATE: rate } });
+      }
+    } finally {
+      console.log = original;
+    }
+    return logged;
+  }
+
+  it("always logs error responses", async () => {
+    expect(await loggedRequests("/v1/nope", 50, "0")).toBe(50);
+  });
+
+  it("logs roughly the configured share of successful responses", async () => {
+    expect(await loggedRequests("/health", 50, "0")).toBe(0);
+    // Binomial(400, 0.25) has a standard deviation under 9; the bounds sit more than 5 of them out.
+    const sampled = await loggedRequests("/health", 400, "0.25");
+    expect(sampled > 50 && sampled < 150).toBe(true);
+  });
+});
@@ -1,99 +1,471 @@
-import { AuthError, BadRequestError, PaymentRequiredError } from "./errors";
-import { handleFaucetFund } from "./faucet";
+import { handleCapabilities } from "./capabilities";
+import {
+  AuthError,
+  BadRequestError,
+  ForbiddenError,
+  HandlerTimeoutError,
+  PayloadTooLargeError,
+  PaymentRequiredError,
+  RateLimitedError,
+  RelaySubmissionError,
+  ServiceUnavailableError,
+} from "./errors";
+import {
+  handleFaucetChainToggle,
+  handleFaucetChallenge,
+  handleFaucetFund,
+  handleFaucetJobStatus,
+  handleFaucetMetrics,
+  handleFaucetStatus,
+} from "./faucet";
 export { FaucetTracker } from "./faucet/do";
+export { OwnershipLedger } from "./ownership-ledger";
+import { handleHealth, handleReadiness, recordIsolateStart } from "./health";
+import { compressResponse } from "./http";
+import {
+  handleImageRedirect,
+  handleInspectImage,
+  handleListImages,
+  handleRevokeImage,
+  handleValidateImageDimensions,
+  handleVerifyImage,
+} from "./images";
+import { assertWritesEnabled, handleMaintenanceToggle } from "./maintenance";
+import { recordMetric } from "./metrics";
+import { enforceRateLimit } from "./rate-limit";
 import { handleCredit, handleRelayStatus, handleSubmitRelay } from "./relay";
 import type { Env } from "./relay";
 import { handleSingletonVersion } from "./singleton";
-import { handleDirectImageUpload } from "./upload";
+import { logEffectiveConfig, logInvalidCorsPolicy } from "./startup";
+import { type Span, Tracer } from "./tracing";
+import { handleBatchDirectImageUpload, handleDirectImageUpload, handleProxiedImageUpload } from "./upload";
+import { authorizeUploadRequest } from "./upload-token";
 import {
+  applyCorsPolicy,
+  authorizeAdminRequest,
   authorizeRequest,
-  corsResponse,
+  errorResponse,
   formatNativeToken,
   isRouteAllowedForHostname,
-  jsonResponse,
   normalizeHostname,
+  parseBoundedInteger,
+  preflightResponse,
+  randomHex,
+  readRequestBody,
+  resolveCorsPolicy,
 } from "./utils";
 
 export default {
   async fetch(request: Request, env: Env, ctx: ExecutionContext): Promise<Response> {
+    if (recordIsolateStart()) {
+      logEffectiveConfig(env);
+      logInvalidCorsPolicy(env);
+    }
+    const startedAt = Date.now();
+    const requestId = randomHex(8);
+    const path = new URL(request.url).pathname;
+    const tracer = new Tracer(env, request.headers.get("traceparent"));
+    const span = tracer.startSpan(`${request.method} ${path}`, {
+      "http.request.method": request.method,
+      "url.path": path,
+      "relay.request_id": requestId,
+    });
+    const response = await routeRequest(request, env, ctx, requestId, span);
     try {
-      const url = new URL(request.url);
-      const path = url.pathname;
-      const hostname = normalizeHostname(url.hostname);
+      applyCorsPolicy(request, resolveCorsPolicy(env), response);
+    } catch {
+      // An invalid CORS config was already answered with `503 invalid_cors_config`, which keeps `*`.
+    }
+    span.setAttribute("http.response.status_code", response.status);
+    span.end(response.status >= 500 ? `status ${response.status}` : undefined);
+    ctx.waitUntil(tracer.flush());
+    response.headers.set("X-Request-Id", requestId);
+    if (shouldLogRequest(env, response.status)) {
+      console.log(
+        JSON.stringify({
+          requestId,
+          method: request.method,
+          path,
+          status: response.status,
+          durationMs: Date.now() - startedAt,
+        })
+      );
+    }
+    recordMetric(
+      env,
+      "request_duration_ms",
+      {
+        result: String(response.status),
+        route: resolveRouteLabel(request.method, path),
+      },
+      Date.now() - startedAt
+    );
+    return response;
+  },
+};
 
-      if (!isRouteAllowedForHostname(hostname, request.method, path)) {
-        return jsonResponse({ ok: false, error: "not_found" }, 404);
-      }
+interface RouteContext {
+  request: Request;
+  env: Env;
+  ctx: ExecutionContext;
+  url: URL;
+  rawBody: string;
+  span: Span;
+  params: string[];
+}
 
-      if (request.method === "OPTIONS") {
-        return corsResponse(new Response(null, { status: 204 }));
-      }
+interface Route {
+  method: "GET" | "POST";
+  // Exact path, or a pattern whose capture groups become `params`.
+  path: string | RegExp;
+  // How a pattern path is named in metrics, so every imageID or jobID shares one series.
+  label?: string;
+  // `/health` and `/ready` skip rate limiting so probes never consume the budget.
+  rateLimited?: boolean;
+  // Routes that stream a binary body read it themselves instead of getting `rawBody`.
+  readsBody?: false;
+  // List responses can grow large; small ones such as `/health` are never worth compressing.
+  compress?: boolean;
+  // Uploads and faucet funding answer `503 maintenance_mode` while maintenance mode is on.
+  pausedInMaintenance?: boolean;
+  handle(context: RouteContext): Promise<Response> | Response;
+}
 
-      if (request.method === "GET" && path === "/health") {
-        return jsonResponse({ ok: true, service: "relay-proxy" });
-      }
+// Each route declares its method here, so preflights advertise exactly what the path supports.
+const ROUTES: readonly Route[] = [
+  {
+    method: "GET",
+    path: "/health",
+    rateLimited: false,
+    handle: ({ env }) => handleHealth(env),
+  },
+  { method: "GET", path: "/ready", rateLimited: false, handle: ({ env }) => handleReadiness(env) },
+  { method: "GET", path: "/v1/capabilities", handle: ({ env }) => handleCapabilities(env) },
+  {
+    method: "POST",
+    path: "/v1/relay/submit",
+    handle: async ({ request, env, rawBody }) => {
+      await authorizeRequest(request, env, rawBody);
+      return await handleSubmitRelay(rawBody, env);
+    },
+  },
+  {
+    method: "GET",
+    path: "/v1/relay/status",
+    handle: async ({ request, env, url }) => {
+      await authorizeRequest(request, env, "");
+      return await handleRelayStatus(url, env);
+    },
+  },
+  {
+    method: "GET",
+    path: "/v1/relay/credit",
+    handle: async ({ request, env, url }) => {
+      await authorizeRequest(request, env, "");
+      return await handleCredit(url, env);
+    },
+  },
+  {
+    method: "POST",
+    path: "/v1/images/direct-upload",
+    pausedInMaintenance: true,
+    handle: async ({ request, env, rawBody, span }) => {
+      const auth = await authorizeUploadRequest(request, env, rawBody, { allowSignedEOA: true });
+      return await handleDirectImageUpload(rawBody, env, auth, span);
+    },
+  },
+  {
+    method: "POST",
+    path: "/v1/images/direct-upload/batch",
+    pausedInMaintenance: true,
+    handle: async ({ request, env, rawBody, span }) => {
+      const auth = await authorizeUploadRequest(request, env, rawBody, { allowSignedEOA: true });
+      return await handleBatchDirectImageUpload(rawBody, env, auth, span);
+    },
+  },
+  {
+    method: "POST",
+    path: "/v1/images/upload",
+    readsBody: false,
+    pausedInMaintenance: true,
+    handle: async ({ request, env, ctx, url, span }) => {
+      // The image is not buffered before auth, so an HMAC signature here covers an empty body.
+      const auth = await authorizeUploadRequest(request, env, "");
+      return await handleProxiedImageUpload(request, url, env, ctx, auth, span);
+    },
+  },
+  {
+    method: "GET",
+    path: "/v1/images",
+    compress: true,
+    handle: async ({ request, env, url }) => {
+      const auth = await authorizeUploadRequest(request, env, "");
+      return await handleListImages(url, env, auth);
+    },
+  },
+  {
+    method: "POST",
+    path: /^\/v1\/images\/(.+)\/revoke$/,
+    label: "/v1/images/:imageID/revoke",
+    handle: async ({ request, env, rawBody, params }) => {
+      const auth = await authorizeUploadRequest(request, env, rawBody);
+      return await handleRevokeImage(params[0], env, auth);
+    },
+  },
+  {
+    method: "POST",
+    path: /^\/v1\/images\/(.+)\/inspect$/,
+    label: "/v1/images/:imageID/inspect",
+    handle: async ({ request, env, rawBody, params }) => {
+      const auth = await authorizeUploadRequest(request, env, rawBody);
+      return await handleInspectImage(params[0], env, auth);
+    },
+  },
+  {
+    method: "GET",
+    // Only URL-encoded imageIDs (`avatars%2F...`), so fixed paths like `/v1/images/verify` never match.
+    path: /^\/v1\/images\/((?:[^/]*%2F)?avatars%2F[^/]+)$/i,
+    label: "/v1/images/:imageID",
+    handle: async ({ request, env, url, params }) => {
+      const auth = await authorizeUploadRequest(request, env, "");
+      return await handleImageRedirect(params[0], url, env, auth);
+    },
+  },
+  {
+    method: "POST",
+    path: "/v1/images/verify",
+    handle: async ({ request, env, ctx, rawBody }) => {
+      await authorizeRequest(request, env, rawBody);
+      return await handleVerifyImage(rawBody, env, ctx);
+    },
+  },
+  {
+    method: "POST",
+    path: "/v1/images/validate-dimensions",
+    handle: async ({ request, env, rawBody }) => {
+      await authorizeRequest(request, env, rawBody);
+      return await handleValidateImageDimensions(rawBody, env);
+    },
+  },
+  { method: "GET", path: "/v1/account/singleton-version", handle: ({ env }) => handleSingletonVersion(env) },
+  {
+    method: "POST",
+    path: "/v1/faucet/fund",
+    pausedInMaintenance: true,
+    handle: async ({ request, env, rawBody, span }) => {
+      await authorizeRequest(request, env, rawBody);
+      return await handleFaucetFund(rawBody, env, span);
+    },
+  },
+  {
+    method: "GET",
+    path: "/v1/faucet/challenge",
+    handle: async ({ request, env, url }) => {
+      await authorizeRequest(request, env, "");
+      return await handleFaucetChallenge(url, env);
+    },
+  },
+  {
+    method: "GET",
+    path: "/v1/faucet/status",
+    handle: async ({ request, env }) => {
+      await authorizeRequest(request, env, "");
+      return await handleFaucetStatus(env);
+    },
+  },
+  {
+    method: "GET",
+    path: /^\/v1\/faucet\/jobs\/([^/]+)$/,
+    label: "/v1/faucet/jobs/:jobID",
+    handle: async ({ request, env, params }) => {
+      await authorizeRequest(request, env, "");
+      return await handleFaucetJobStatus(params[0], env);
+    },
+  },
+  {
+    method: "GET",
+    path: "/v1/faucet/metrics",
+    handle: async ({ request, env }) => {
+      await authorizeRequest(request, env, "");
+      return await handleFaucetMetrics(env);
+    },
+  },
+  {
+    method: "POST",
+    path: /^\/v1\/faucet\/chains\/(\d+)\/toggle$/,
+    label: "/v1/faucet/chains/:chainId/toggle",
+    handle: async ({ request, env, rawBody, params }) => {
+      await authorizeAdminRequest(request, env);
+      return await handleFaucetChainToggle(params[0], rawBody, env);
+    },
+  },
+  {
+    method: "POST",
+    path: "/v1/admin/maintenance",
+    handle: async ({ request, env, rawBody }) => {
+      await authorizeAdminRequest(request, env);
+      return await handleMaintenanceToggle(rawBody, env);
+    },
+  },
+];
 
-      if (request.method === "POST" && path === "/v1/relay/submit") {
-        const rawBody = await request.text();
-        await authorizeRequest(request, env, rawBody);
-        return await handleSubmitRelay(rawBody, env);
-      }
+function matchRoutePath(route: Route, path: string): string[] | null {
+  if (typeof route.path === "string") {
+    return route.path === path ? [] : null;
+  }
+  const match = route.path.exec(path);
+  return match ? match.slice(1) : null;
+}
 
-      if (request.method === "GET" && path === "/v1/relay/status") {
-        await authorizeRequest(request, env, "");
-        return await handleRelayStatus(url, env);
-      }
+// Labels metrics by the route that matched rather than the raw path; anything else is "unmatched".
+function resolveRouteLabel(method: string, path: string): string {
+  const route = ROUTES.find((candidate) => candidate.method === method && matchRoutePath(candidate, path));
+  if (!route) {
+    return "unmatched";
+  }
+  return `${method} ${typeof route.path === "string" ? route.path : (route.label ?? route.path.source)}`;
+}
 
-      if (request.method === "GET" && path === "/v1/relay/credit") {
-        await authorizeRequest(request, env, "");
-        return await handleCredit(url, env);
-      }
+// Stops waiting on a slow handler (e.g. an upstream RPC or Pinata call) and answers `504`. The
+// handler's work is not cancelled; anything it started simply finishes unobserved. Faucet funding
+// is queued and returns right away, so only the request path is bounded, never the drip itself.
+async function withHandlerTimeout(env: Env, pending: Promise<Response> | Response): Promise<Response> {
+  const timeoutMs = parseBoundedInteger(env.HANDLER_TIMEOUT_SECONDS ?? "60", 1, 300, 60) * 1000;
+  let timer: ReturnType<typeof setTimeout> | undefined;
+  const deadline = new Promise<never>((_, reject) => {
+    timer = setTimeout(() => reject(new HandlerTimeoutError(`Handler exceeded ${timeoutMs}ms.`)), timeoutMs);
+  });
+  try {
+    return await Promise.race([pending, deadline]);
+  } finally {
+    clearTimeout(timer);
+  }
+}
 
-      if (request.method === "POST" && path === "/v1/images/direct-upload") {
-        const rawBody = await request.text();
-        await authorizeRequest(request, env, rawBody);
-        return await handleDirectImageUpload(rawBody, env);
-      }
+// LOG_SAMPLE_RATE (0.0-1.0, default 1) thins out the per-request log line for successful
+// responses only; 4xx and 5xx are always logged. Metrics and traces are not sampled.
+function shouldLogRequest(env: Env, status: number): boolean {
+  if (status >= 400) {
+    return true;
+  }
+  const raw = (env.LOG_SAMPLE_RATE ?? "").trim();
+  const rate = Number(raw);
+  if (!raw || !Number.isFinite(rate) || rate >= 1) {
+    return true;
+  }
+  return Math.random() < Math.max(rate, 0);
+}
 
-      if (request.method === "GET" && path === "/v1/account/singleton-version") {
-        return handleSingletonVersion(env);
-      }
+function resolveCompressionMinBytes(env: Env): number {
+  return parseBoundedInteger(env.RESPONSE_COMPRESSION_MIN_BYTES ?? "1024", 0, 1_048_576, 1024);
+}
 
-      if (request.method === "POST" && path === "/v1/faucet/fund") {
-        const rawBody = await request.text();
-        await authorizeRequest(request, env, rawBody);
-        return await handleFaucetFund(rawBody, env, ctx);
-      }
+// Liveness and readiness answer even when the CORS config is invalid.
+const CORS_EXEMPT_PATHS = new Set(["/health", "/ready"]);
 
-      return jsonResponse({ ok: false, error: "not_found" }, 404);
-    } catch (error) {
-      if (error instanceof AuthError) {
-        return jsonResponse({ ok: false, error: "unauthorized", reason: error.message }, 401);
-      }
-      if (error instanceof BadRequestError) {
-        return jsonResponse({ ok: false, error: "bad_request", reason: error.message }, 400);
-      }
-      if (error instanceof PaymentRequiredError) {
-        return jsonResponse(
-          {
-            ok: false,
-            error: "payment_required",
-            account: error.account,
-            supportMode: error.supportMode,
-            estimatedDebitNative: formatNativeToken(error.estimatedDebitWei),
-            balanceNative: formatNativeToken(error.balanceWei),
-            postDebitNative: formatNativeToken(error.postDebitWei),
-            minimumAllowedNative: formatNativeToken(error.minimumAllowedWei),
-            requiredTopUpNative: formatNativeToken(error.requiredTopUpWei),
-            suggestedTopUpNative: formatNativeToken(error.suggestedTopUpWei),
-            paymentOptions: error.paymentOptions,
-          },
-          402
-        );
+async function routeRequest(
+  request: Request,
+  env: Env,
+  ctx: ExecutionContext,
+  requestId: string,
+  span: Span
+): Promise<Response> {
+  try {
+    const url = new URL(request.url);
+    const path = url.pathname;
+    const hostname = normalizeHostname(url.hostname);
+    // Validated up front so a credentials + wildcard config fails loudly instead of being ignored.
+    // Probes are exempt: a CORS mistake must not take the worker out of rotation.
+    if (!CORS_EXEMPT_PATHS.has(path)) {
+      resolveCorsPolicy(env);
+    }
+
+    if (!isRouteAllowedForHostname(hostname, request.method, path)) {
+      return errorResponse(404, "not_found", "Route not found.", requestId);
+    }
+
+    const matches = ROUTES.flatMap((route) => {
+      const params = matchRoutePath(route, path);
+      return params ? [{ route, params }] : [];
+    });
+
+    if (request.method === "OPTIONS") {
+      if (matches.length === 0) {
+        return errorResponse(404, "not_found", "Route not found.", requestId);
       }
+      return preflightResponse(request, matches.map(({ route }) => route.method));
+    }
 
-      const reason = error instanceof Error ? error.message : "internal_error";
-      return jsonResponse({ ok: false, error: "internal_error", reason }, 500);
+    const matched = matches.find(({ route }) => route.method === request.method);
+    if (matched?.route.rateLimited !== false) {
+      await enforceRateLimit(request, env, path);
     }
-  },
-};
+    if (!matched) {
+      return errorResponse(404, "not_found", "Route not found.", requestId);
+    }
+    if (matched.route.pausedInMaintenance) {
+      await assertWritesEnabled(env);
+    }
+
+    // Every JSON body is read once here so the size cap applies to all routes; streaming routes
+    // enforce their own cap while reading.
+    const rawBody =
+      request.method === "POST" && matched.route.readsBody !== false ? await readRequestBody(request, env) : "";
+
+    const response = await withHandlerTimeout(
+      env,
+      matched.route.handle({ request, env, ctx, url, rawBody, span, params: matched.params })
+    );
+    if (!matched.route.compress) {
+      return response;
+    }
+    return await compressResponse(request, response, resolveCompressionMinBytes(env));
+  } catch (error) {
+    if (error instanceof AuthError) {
+      return errorResponse(401, error.code, error.message, requestId);
+    }
+    if (error instanceof ForbiddenError) {
+      return errorResponse(403, error.code, error.message, requestId);
+    }
+    if (error instanceof BadRequestError) {
+      return errorResponse(400, error.code, error.message, requestId);
+    }
+    if (error instanceof RateLimitedError) {
+      const response = errorResponse(429, error.code, error.message, requestId);
+      response.headers.set("Retry-After", String(error.retryAfterSeconds));
+      return response;
+    }
+    if (error instanceof HandlerTimeoutError) {
+      return errorResponse(504, error.code, error.message, requestId);
+    }
+    if (error instanceof PayloadTooLargeError) {
+      return errorResponse(413, error.code, error.message, requestId);
+    }
+    if (error instanceof ServiceUnavailableError) {
+      return errorResponse(503, error.code, error.message, requestId);
+    }
+    if (error instanceof RelaySubmissionError) {
+      return errorResponse(502, error.code, error.message, requestId, error.details);
+    }
+    if (error instanceof PaymentRequiredError) {
+      return errorResponse(402, "payment_required", "Insufficient gas tank credit.", requestId, {
+        account: error.account,
+        supportMode: error.supportMode,
+        estimatedDebitNative: formatNativeToken(error.estimatedDebitWei),
+        balanceNative: formatNativeToken(error.balanceWei),
+        postDebitNative: formatNativeToken(error.postDebitWei),
+        minimumAllowedNative: formatNativeToken(error.minimumAllowedWei),
+        requiredTopUpNative: formatNativeToken(error.requiredTopUpWei),
+        suggestedTopUpNative: formatNativeToken(error.suggestedTopUpWei),
+        paymentOptions: error.paymentOptions,
+      });
+    }
+
+    // Anything unexpected, including non-Error throws, still gets the JSON envelope; the stack is
+    // only logged, keyed by request ID.
+    const message = error instanceof Error ? error.message : "internal_error";
+    const stack = error instanceof Error ? error.stack : String(error);
+    console.error(JSON.stringify({ requestId, error: message, stack }));
+    return errorResponse(500, "internal_error", message, requestId);
+  }
+}
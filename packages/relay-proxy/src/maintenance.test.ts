@@ -0,0 +1,40 @@
+import { describe, expect, it } from "bun:test";
+
+import { bindDurableObject, createDurableObjectState } from "../test/durable-object";
+
+import { FaucetTracker } from "./faucet/do";
+import { assertWritesEnabled, handleMaintenanceToggle } from "./maintenance";
+import type { Env } from "./relay/models";
+
+function maintenanceEnv(vars: Partial<Env> = {}): Env {
+  const env = { ...vars } as Env;
+  env.FAUCET_TRACKER_DO = bindDurableObject(new FaucetTracker(createDurableObjectState(), env));
+  return env;
+}
+
+describe("maintenance toggle", () => {
+  it("pauses writes as soon as it is switched on and resumes them when switched off", async () => {
+    const env = maintenanceEnv();
+    await expect(assertWritesEnabled(env)).resolves.toBeUndefined();
+
+    const on = await handleMaintenanceToggle(JSON.stringify({ enabled: true }), env);
+    expect(await on.json()).toEqual({ ok: true, enabled: true, toggle: true, configured: false });
+    await expect(assertWritesEnabled(env)).rejects.toMatchObject({ code: "maintenance_mode" });
+
+    await handleMaintenanceToggle(JSON.stringify({ enabled: false }), env);
+    await expect(assertWritesEnabled(env)).resolves.toBeUndefined();
+  });
+
+  it("cannot switch off MAINTENANCE_MODE from config", async () => {
+    const env = maintenanceEnv({ MAINTENANCE_MODE: "true" });
+    const off = await handleMaintenanceToggle(JSON.stringify({ enabled: false }), env);
+    expect(await off.json()).toEqual({ ok: true, enabled: true, toggle: false, configured: true });
+    await expect(assertWritesEnabled(env)).rejects.toMatchObject({ code: "maintenance_mode" });
+  });
+
+  it("rejects a non-boolean flag", async () => {
+    await expect(handleMaintenanceToggle(JSON.stringify({ enabled: "yes" }), maintenanceEnv())).rejects.toMatchObject({
+      code: "invalid_payload",
+    });
+  });
+});
@@ -0,0 +1,77 @@
+import { BadRequestError, ServiceUnavailableError } from "./errors";
+import { resolveFaucetTracker } from "./faucet";
+import type { Env, MaintenanceToggleRequestModel } from "./relay/models";
+import { jsonResponse, parseBooleanFlag, parseJsonObject } from "./utils";
+
+const MAINTENANCE_TOGGLE_FIELDS = ["enabled"] as const satisfies readonly (keyof MaintenanceToggleRequestModel)[];
+
+// How long an isolate reuses the toggle it last read, so uploads do not wait on the faucet
+// Durable Object on every request.
+const MAINTENANCE_TOGGLE_CACHE_MS = 5_000;
+
+let cachedToggle: { enabled: boolean; expiresAt: number } | undefined;
+
+// Write routes (uploads and faucet funding) call this before doing any work; reads never do.
+// MAINTENANCE_MODE forces the mode on from config; otherwise the admin toggle stored in the
+// faucet Durable Object decides, so a toggle reaches every isolate within a few seconds.
+export async function assertWritesEnabled(env: Env): Promise<void> {
+  if (parseBooleanFlag(env.MAINTENANCE_MODE, false) || (await readMaintenanceToggle(env))) {
+    throw new ServiceUnavailableError(
+      "The service is in maintenance mode: uploads and faucet funding are paused. Reads are unaffected.",
+      "maintenance_mode"
+    );
+  }
+}
+
+export async function handleMaintenanceToggle(rawBody: string, env: Env): Promise<Response> {
+  const request = rawBody.trim() === "" ? {} : parseMaintenanceToggleRequest(rawBody);
+
+  const doRes = await resolveFaucetTracker(env).fetch(
+    new Request("http://do/maintenance", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ enabled: request.enabled }),
+    })
+  );
+  if (!doRes.ok) {
+    throw new Error(`Maintenance toggle failed with status ${doRes.status}.`);
+  }
+  const payload = (await doRes.json()) as { enabled: boolean };
+  cachedToggle = { enabled: payload.enabled, expiresAt: Date.now() + MAINTENANCE_TOGGLE_CACHE_MS };
+  const configured = parseBooleanFlag(env.MAINTENANCE_MODE, false);
+  return jsonResponse({ ok: true, enabled: configured || payload.enabled, toggle: payload.enabled, configured });
+}
+
+// Without the Durable Object binding only MAINTENANCE_MODE applies. A failed lookup fails open
+// with the last known state, so a faucet outage cannot take uploads down with it.
+async function readMaintenanceToggle(env: Env): Promise<boolean> {
+  if (!env.FAUCET_TRACKER_DO) {
+    return false;
+  }
+  const now = Date.now();
+  if (cachedToggle && cachedToggle.expiresAt > now) {
+    return cachedToggle.enabled;
+  }
+
+  let enabled: boolean;
+  try {
+    const doRes = await resolveFaucetTracker(env).fetch(new Request("http://do/maintenance", { method: "GET" }));
+    if (!doRes.ok) {
+      throw new Error(`Maintenance state lookup failed with status ${doRes.status}.`);
+    }
+    enabled = ((await doRes.json()) as { enabled: boolean }).enabled;
+  } catch (error) {
+    enabled = cachedToggle?.enabled ?? false;
+    console.warn(`maintenance toggle lookup failed; assuming ${enabled ? "enabled" : "disabled"}`, error);
+  }
+  cachedToggle = { enabled, expiresAt: now + MAINTENANCE_TOGGLE_CACHE_MS };
+  return enabled;
+}
+
+function parseMaintenanceToggleRequest(rawBody: string): MaintenanceToggleRequestModel {
+  const request = parseJsonObject(rawBody, MAINTENANCE_TOGGLE_FIELDS, "maintenance toggle");
+  if (request.enabled !== undefined && typeof request.enabled !== "boolean") {
+    throw new BadRequestError("enabled must be a boolean.", "invalid_payload");
+  }
+  return { enabled: request.enabled };
+}
@@ -0,0 +1,37 @@
+import type { Env } from "./relay/models";
+
+export type MetricName =
+  | "direct_upload_requests_total"
+  | "faucet_requests_total"
+  | "faucet_funding_total"
+  | "faucet_tx_gas_used"
+  | "faucet_queue_depth"
+  | "request_duration_ms";
+
+export interface MetricLabels {
+  result?: string;
+  chain?: string;
+  token?: string;
+  route?: string;
+}
+
+// Data points land in Workers Analytics Engine with a fixed blob layout so
+// dashboards can query them positionally:
+// blob1 = metric name, blob2 = result, blob3 = chain, blob4 = token, blob5 = route, double1 = value.
+export function recordMetric(env: Env, name: MetricName, labels: MetricLabels = {}, value = 1): void {
+  const dataset = env.METRICS;
+  if (!dataset) {
+    return;
+  }
+
+  try {
+    dataset.writeDataPoint({
+      indexes: [name],
+      blobs: [name, labels.result ?? "", labels.chain ?? "", labels.token ?? "", labels.route ?? ""],
+      doubles: [value],
+    });
+  } catch (error) {
+    const reason = error instanceof Error ? error.message : "unknown metrics error";
+    console.warn(`metric ${name} write failed`, reason);
+  }
+}
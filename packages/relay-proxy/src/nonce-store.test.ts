@@ -0,0 +1,22 @@
+import { describe, expect, it } from "bun:test";
+
+import { createDurableObjectState } from "../test/durable-object";
+
+import { sleep } from "./http";
+import { SqliteUsedNonceStore } from "./nonce-store";
+
+describe("SqliteUsedNonceStore", () => {
+  it("accepts a nonce once until its record expires", async () => {
+    const store = new SqliteUsedNonceStore(createDurableObjectState().storage);
+    expect(await store.consume("n-1", 60_000)).toBe(true);
+    expect(await store.consume("n-1", 60_000)).toBe(false);
+    expect(await store.consume("n-2", 60_000)).toBe(true);
+  });
+
+  it("forgets expired nonces", async () => {
+    const store = new SqliteUsedNonceStore(createDurableObjectState().storage);
+    expect(await store.consume("short-lived", 1)).toBe(true);
+    await sleep(5);
+    expect(await store.consume("short-lived", 1)).toBe(true);
+  });
+});
@@ -0,0 +1,71 @@
+import { jsonResponse } from "./utils";
+
+// Single-use values (signed proofs, challenge nonces) spent in a Durable Object. KV cannot hold
+// them: a get followed by a put lets two concurrent requests both see a value as unused.
+export interface UsedNonceStore {
+  // False when `nonce` was already consumed and its record has not expired yet.
+  consume(nonce: string, ttlMs: number): Promise<boolean>;
+}
+
+// The insert only writes a row for an unseen nonce, and it shares one transaction with the sweep
+// of expired rows, so the check and the write cannot be split by another request.
+export class SqliteUsedNonceStore implements UsedNonceStore {
+  private readonly storage: DurableObjectStorage;
+
+  constructor(storage: DurableObjectStorage) {
+    this.storage = storage;
+    this.storage.sql.exec(
+      "CREATE TABLE IF NOT EXISTS used_nonces (nonce TEXT PRIMARY KEY, expires_at INTEGER NOT NULL)"
+    );
+  }
+
+  async consume(nonce: string, ttlMs: number): Promise<boolean> {
+    return this.storage.transactionSync(() => {
+      const now = Date.now();
+      this.storage.sql.exec("DELETE FROM used_nonces WHERE expires_at <= ?", now);
+      const cursor = this.storage.sql.exec(
+        "INSERT INTO used_nonces (nonce, expires_at) VALUES (?, ?) ON CONFLICT(nonce) DO NOTHING",
+        nonce,
+        now + ttlMs
+      );
+      return cursor.rowsWritten === 1;
+    });
+  }
+}
+
+// `POST /nonces/consume` on a Durable Object that owns a UsedNonceStore.
+export async function handleConsumeNonce(request: Request, store: UsedNonceStore): Promise<Response> {
+  let payload: { nonce?: string; ttlMs?: number };
+  try {
+    payload = (await request.json()) as { nonce?: string; ttlMs?: number };
+  } catch {
+    return jsonResponse({ ok: false, error: "invalid_json" }, 400);
+  }
+
+  if (!payload.nonce || typeof payload.ttlMs !== "number" || payload.ttlMs <= 0) {
+    return jsonResponse({ ok: false, error: "invalid_nonce" }, 400);
+  }
+
+  if (!(await store.consume(payload.nonce, payload.ttlMs))) {
+    return jsonResponse({ ok: false, error: "nonce_used" }, 409);
+  }
+  return jsonResponse({ ok: true });
+}
+
+// Worker side of handleConsumeNonce: true if this call spent the nonce, false if it was spent before.
+export async function consumeNonce(stub: DurableObjectStub, nonce: string, ttlMs: number): Promise<boolean> {
+  const response = await stub.fetch(
+    new Request("http://do/nonces/consume", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ nonce, ttlMs }),
+    })
+  );
+  if (response.status === 409) {
+    return false;
+  }
+  if (!response.ok) {
+    throw new Error(`Nonce store returned status: ${response.status}`);
+  }
+  return true;
+}
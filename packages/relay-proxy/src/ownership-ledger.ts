@@ -0,0 +1,25 @@
+import { DurableObject } from "cloudflare:workers";
+
+import { SqliteUsedNonceStore, type UsedNonceStore, handleConsumeNonce } from "./nonce-store";
+import type { Env } from "./relay/models";
+import { jsonResponse } from "./utils";
+
+// Spent upload ownership proofs. There is one instance per EOA (see consumeOwnershipProof), so
+// uploads for different wallets never queue behind each other, while two requests replaying the
+// same proof always reach the same instance.
+export class OwnershipLedger extends DurableObject<Env> {
+  private readonly usedProofs: UsedNonceStore;
+
+  constructor(ctx: DurableObjectState, env: Env) {
+    super(ctx, env);
+    this.usedProofs = new SqliteUsedNonceStore(ctx.storage);
+  }
+
+  async fetch(request: Request): Promise<Response> {
+    const url = new URL(request.url);
+    if (request.method === "POST" && url.pathname === "/nonces/consume") {
+      return await handleConsumeNonce(request, this.usedProofs);
+    }
+    return jsonResponse({ ok: false, error: "not_found" }, 404);
+  }
+}
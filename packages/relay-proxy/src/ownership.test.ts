@@ -0,0 +1,134 @@
+import { describe, expect, it } from "bun:test";
+import { privateKeyToAccount } from "viem/accounts";
+
+import { bindDurableObject, createDurableObjectState } from "../test/durable-object";
+
+import {
+  UPLOAD_AUTHORIZATION_DOMAIN,
+  UPLOAD_AUTHORIZATION_TYPES,
+  assertUploadOwnership,
+  buildUploadAuthorizationMessage,
+  buildUploadOwnershipMessage,
+  consumeOwnershipProof,
+} from "./ownership";
+import { OwnershipLedger } from "./ownership-ledger";
+import type { Env, NormalizedDirectUploadRequestModel, NormalizedOwnershipProofModel } from "./relay/models";
+import type { UploadAuthContext } from "./upload-token";
+
+// Well-known development keys (Hardhat accounts 0 and 1); never funded anywhere that matters.
+const OWNER = privateKeyToAccount("0xac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcb6a40f7f2cd7f2ff80");
+const STRANGER = privateKeyToAccount("0x59c6995e998f97a5a0044966f0945389dc9e86dae88c7a8412f4603b6b78690d");
+const EOA = OWNER.address.toLowerCase();
+
+const SHARED_TOKEN: UploadAuthContext = { mode: "shared_token", eoaAddress: null, tenant: null };
+const SIGNED_EOA: UploadAuthContext = { mode: "signed_eoa", eoaAddress: null, tenant: null };
+
+// Each test gets its own ledger so a proof spent in one test cannot affect another.
+function testEnv(): Env {
+  const ledger = new OwnershipLedger(createDurableObjectState(), {} as Env);
+  return { REQUIRE_SIGNED_EOA: "true", OWNERSHIP_LEDGER_DO: bindDurableObject(ledger) } as Env;
+}
+
+function uploadRequest(proof: NormalizedOwnershipProofModel): NormalizedDirectUploadRequestModel {
+  return { eoaAddress: EOA, ownershipProof: proof } as NormalizedDirectUploadRequestModel;
+}
+
+async function personalSignProof(
+  fileName: string,
+  issuedAt: number,
+  signer = OWNER
+): Promise<NormalizedOwnershipProofModel> {
+  const signature = await signer.signMessage({ message: buildUploadOwnershipMessage(EOA, fileName, issuedAt) });
+  return { type: "eip191", signature, issuedAt, fileName };
+}
+
+async function typedDataProof(fileName: string, issuedAt: number): Promise<NormalizedOwnershipProofModel> {
+  const signature = await OWNER.signTypedData({
+    domain: UPLOAD_AUTHORIZATION_DOMAIN,
+    types: UPLOAD_AUTHORIZATION_TYPES,
+    primaryType: "UploadAuthorization",
+    message: buildUploadAuthorizationMessage(EOA, fileName, issuedAt),
+  });
+  return { type: "eip712", signature, issuedAt, fileName };
+}
+
+const nowSeconds = () => Math.floor(Date.now() / 1000);
+
+describe("assertUploadOwnership with an EIP-191 proof", () => {
+  it("accepts a fresh signature by eoaAddress for the file it names", async () => {
+    const proof = await personalSignProof("avatar.png", nowSeconds() - 10);
+    await expect(assertUploadOwnership(uploadRequest(proof), SHARED_TOKEN, testEnv())).resolves.toEqual(proof);
+  });
+
+  it("rejects a signature presented for a different file", async () => {
+    const proof = await personalSignProof("avatar.png", nowSeconds() - 10);
+    await expect(
+      assertUploadOwnership(uploadRequest({ ...proof, fileName: "other.png" }), SHARED_TOKEN, testEnv())
+    ).rejects.toMatchObject({ code: "invalid_ownership_proof" });
+  });
+
+  it("rejects a signature by another key", async () => {
+    const proof = await personalSignProof("avatar.png", nowSeconds() - 10, STRANGER);
+    await expect(assertUploadOwnership(uploadRequest(proof), SHARED_TOKEN, testEnv())).rejects.toMatchObject({
+      code: "invalid_ownership_proof",
+    });
+  });
+
+  it("rejects proofs older than the window or beyond the clock skew", async () => {
+    const stale = await personalSignProof("avatar.png", nowSeconds() - 301);
+    await expect(assertUploadOwnership(uploadRequest(stale), SHARED_TOKEN, testEnv())).rejects.toMatchObject({
+      code: "ownership_proof_expired",
+    });
+
+    const future = await personalSignProof("avatar.png", nowSeconds() + 120);
+    await expect(assertUploadOwnership(uploadRequest(future), SHARED_TOKEN, testEnv())).rejects.toMatchObject({
+      code: "ownership_proof_expired",
+    });
+  });
+});
+
+describe("assertUploadOwnership without a bearer token", () => {
+  it("requires the EIP-712 form", async () => {
+    const proof = await personalSignProof("avatar.png", nowSeconds() - 10);
+    await expect(assertUploadOwnership(uploadRequest(proof), SIGNED_EOA, testEnv())).rejects.toMatchObject({
+      code: "ownership_proof_required",
+    });
+  });
+
+  it("rejects an EIP-712 proof for a different file", async () => {
+    const proof = await typedDataProof("avatar.png", nowSeconds() - 10);
+    await expect(
+      assertUploadOwnership(uploadRequest({ ...proof, fileName: "other.png" }), SIGNED_EOA, testEnv())
+    ).rejects.toMatchObject({ code: "invalid_ownership_proof" });
+  });
+});
+
+describe("consumeOwnershipProof", () => {
+  it("spends a proof once", async () => {
+    const env = testEnv();
+    const proof = await typedDataProof("avatar.png", nowSeconds() - 10);
+    const verified = await assertUploadOwnership(uploadRequest(proof), SIGNED_EOA, env);
+    expect(verified).toEqual(proof);
+
+    await expect(consumeOwnershipProof(env, EOA, proof)).resolves.toBeUndefined();
+    await expect(consumeOwnershipProof(env, EOA, proof)).rejects.toMatchObject({ code: "ownership_proof_reused" });
+  });
+
+  it("lets only one of two concurrent replays through", async () => {
+    const env = testEnv();
+    const proof = await personalSignProof("avatar.png", nowSeconds() - 10);
+    const outcomes = await Promise.allSettled([
+      consumeOwnershipProof(env, EOA, proof),
+      consumeOwnershipProof(env, EOA, proof),
+    ]);
+    expect(outcomes.map((outcome) => outcome.status).sort()).toEqual(["fulfilled", "rejected"]);
+  });
+
+  it("keeps proofs for different files apart", async () => {
+    const env = testEnv();
+    const first = await personalSignProof("avatar.png", nowSeconds() - 10);
+    const second = await personalSignProof("banner.png", first.issuedAt);
+    await consumeOwnershipProof(env, EOA, first);
+    await expect(consumeOwnershipProof(env, EOA, second)).resolves.toBeUndefined();
+  });
+});
@@ -0,0 +1,152 @@
+import { type Hex, getAddress, isHex, keccak256, recoverMessageAddress, recoverTypedDataAddress, toBytes } from "viem";
+
+import { BadRequestError, ForbiddenError } from "./errors";
+import { consumeNonce } from "./nonce-store";
+import type {
+  Env,
+  NormalizedDirectUploadRequestModel,
+  NormalizedOwnershipProofModel,
+  UploadOwnershipProofModel,
+} from "./relay/models";
+import type { UploadAuthContext } from "./upload-token";
+import { parseBooleanFlag } from "./utils";
+
+const OWNERSHIP_PROOF_WINDOW_SECONDS = 300;
+// How far ahead of server time `issuedAt` may be, to absorb wallet clock drift.
+const OWNERSHIP_PROOF_CLOCK_SKEW_SECONDS = 30;
+
+// Wallets show the domain and struct to the user, so the names stay stable and readable.
+export const UPLOAD_AUTHORIZATION_DOMAIN = { name: "knot avatar upload", version: "1" } as const;
+
+export const UPLOAD_AUTHORIZATION_TYPES = {
+  UploadAuthorization: [
+    { name: "eoa", type: "address" },
+    { name: "fileNameHash", type: "bytes32" },
+    { name: "issuedAt", type: "uint256" },
+  ],
+} as const;
+
+// Commits to the file name as sent (before sanitizing), like the EIP-712 struct, so a captured
+// signature cannot authorize a different file.
+export function buildUploadOwnershipMessage(eoaAddress: string, fileName: string, issuedAt: number): string {
+  return `knot avatar upload\naddress: ${eoaAddress.toLowerCase()}\nfile: ${fileName}\nissuedAt: ${issuedAt}`;
+}
+
+export function buildUploadAuthorizationMessage(eoaAddress: string, fileName: string, issuedAt: number) {
+  return {
+    eoa: getAddress(eoaAddress),
+    fileNameHash: keccak256(toBytes(fileName)),
+    issuedAt: BigInt(issuedAt),
+  };
+}
+
+export function parseOwnershipProof(value: unknown, fileName: string): NormalizedOwnershipProofModel | null {
+  if (value === undefined || value === null) {
+    return null;
+  }
+  if (typeof value !== "object" || Array.isArray(value)) {
+    throw new BadRequestError("Invalid ownershipProof.", "invalid_ownership_proof");
+  }
+
+  const proof = value as Partial<UploadOwnershipProofModel>;
+  const type = proof.type ?? "eip191";
+  if (type !== "eip191" && type !== "eip712") {
+    throw new BadRequestError("Invalid ownershipProof.type.", "invalid_ownership_proof");
+  }
+  const signature = String(proof.signature ?? "").trim();
+  if (!isHex(signature) || signature.length !== 132) {
+    throw new BadRequestError("Invalid ownershipProof.signature.", "invalid_ownership_proof");
+  }
+  if (typeof proof.issuedAt !== "number" || !Number.isSafeInteger(proof.issuedAt)) {
+    throw new BadRequestError("Invalid ownershipProof.issuedAt.", "invalid_ownership_proof");
+  }
+  return { type, signature, issuedAt: proof.issuedAt, fileName: fileName.trim() };
+}
+
+// An upload token binds the caller to one EOA. Shared-token callers carry no identity, so with
+// REQUIRE_SIGNED_EOA they must prove control of the EOA with an EIP-191 personal_sign over
+// buildUploadOwnershipMessage or an EIP-712 UploadAuthorization, issued within the last few
+// minutes (never more than a small clock skew in the future). Callers without any bearer token
+// (ALLOW_SIGNED_EOA_UPLOADS) always need the EIP-712 proof. Returns the verified proof, which the
+// caller spends with consumeOwnershipProof once the upload it authorizes exists, or null when no
+// proof was needed.
+export async function assertUploadOwnership(
+  body: NormalizedDirectUploadRequestModel,
+  auth: UploadAuthContext,
+  env: Env
+): Promise<NormalizedOwnershipProofModel | null> {
+  if (auth.eoaAddress) {
+    if (auth.eoaAddress !== body.eoaAddress) {
+      throw new ForbiddenError("Authenticated EOA does not match eoaAddress.", "eoa_mismatch");
+    }
+    return null;
+  }
+
+  const signedOnly = auth.mode === "signed_eoa";
+  if (!signedOnly && !parseBooleanFlag(env.REQUIRE_SIGNED_EOA, false)) {
+    return null;
+  }
+
+  const proof = body.ownershipProof;
+  if (!proof) {
+    throw new ForbiddenError("ownershipProof is required.", "ownership_proof_required");
+  }
+  if (signedOnly && proof.type !== "eip712") {
+    throw new ForbiddenError(
+      "Uploads without a bearer token need an EIP-712 ownershipProof.",
+      "ownership_proof_required"
+    );
+  }
+
+  const age = Math.floor(Date.now() / 1000) - proof.issuedAt;
+  if (age < -OWNERSHIP_PROOF_CLOCK_SKEW_SECONDS || age > OWNERSHIP_PROOF_WINDOW_SECONDS) {
+    throw new ForbiddenError("ownershipProof is outside the allowed window.", "ownership_proof_expired");
+  }
+
+  let signer: string;
+  try {
+    signer = await recoverOwnershipSigner(body.eoaAddress, proof);
+  } catch {
+    throw new ForbiddenError("Invalid ownershipProof signature.", "invalid_ownership_proof");
+  }
+
+  if (signer.toLowerCase() !== body.eoaAddress) {
+    throw new ForbiddenError("ownershipProof was not signed by eoaAddress.", "invalid_ownership_proof");
+  }
+
+  return proof;
+}
+
+// Spends a verified proof in the EOA's OwnershipLedger, which records it until it could no longer
+// pass the window check, so a captured proof cannot mint a second upload. Callers spend it only
+// once the upload exists: a failed Pinata call leaves the proof usable for a retry. Keyed on what
+// was signed rather than on the signature bytes, which can be re-encoded (e.g. flipping `s`)
+// without invalidating the signature.
+export async function consumeOwnershipProof(
+  env: Env,
+  eoaAddress: string,
+  proof: NormalizedOwnershipProofModel
+): Promise<void> {
+  const payload = `${proof.type}:${eoaAddress}:${proof.issuedAt}:${proof.fileName}`;
+  const ledger = env.OWNERSHIP_LEDGER_DO.get(env.OWNERSHIP_LEDGER_DO.idFromName(eoaAddress));
+  const ttlMs = (OWNERSHIP_PROOF_WINDOW_SECONDS + OWNERSHIP_PROOF_CLOCK_SKEW_SECONDS) * 1000;
+  if (!(await consumeNonce(ledger, keccak256(toBytes(payload)), ttlMs))) {
+    throw new ForbiddenError("ownershipProof was already used.", "ownership_proof_reused");
+  }
+}
+
+async function recoverOwnershipSigner(eoaAddress: string, proof: NormalizedOwnershipProofModel): Promise<string> {
+  if (proof.type === "eip712") {
+    return await recoverTypedDataAddress({
+      domain: UPLOAD_AUTHORIZATION_DOMAIN,
+      types: UPLOAD_AUTHORIZATION_TYPES,
+      primaryType: "UploadAuthorization",
+      message: buildUploadAuthorizationMessage(eoaAddress, proof.fileName, proof.issuedAt),
+      signature: proof.signature as Hex,
+    });
+  }
+  return await recoverMessageAddress({
+    message: buildUploadOwnershipMessage(eoaAddress, proof.fileName, proof.issuedAt),
+    signature: proof.signature as Hex,
+  });
+}
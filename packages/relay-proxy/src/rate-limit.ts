@@ -0,0 +1,60 @@
+import { RateLimitedError } from "./errors";
+import type { Env } from "./relay/models";
+import { parseBoundedInteger } from "./utils";
+
+const RATE_LIMIT_EXEMPT_PATHS: Set<string> = new Set(["/health"]);
+
+// Limits themselves (requests per period) live on the [[ratelimits]] bindings in wrangler.toml.
+export async function enforceRateLimit(request: Request, env: Env, path: string): Promise<void> {
+  if (request.method === "OPTIONS" || RATE_LIMIT_EXEMPT_PATHS.has(path)) {
+    return;
+  }
+
+  const retryAfterSeconds = parseBoundedInteger(env.RATE_LIMIT_PERIOD_SECONDS ?? "60", 1, 3600, 60);
+
+  if (env.GLOBAL_RATE_LIMITER) {
+    const { success } = await env.GLOBAL_RATE_LIMITER.limit({ key: "global" });
+    if (!success) {
+      throw new RateLimitedError("Global rate limit exceeded.", retryAfterSeconds);
+    }
+  }
+
+  if (env.IP_RATE_LIMITER) {
+    const clientIP = resolveClientIP(request, env);
+    const { success } = await env.IP_RATE_LIMITER.limit({ key: `ip:${clientIP}` });
+    if (!success) {
+      throw new RateLimitedError("Rate limit exceeded for client.", retryAfterSeconds);
+    }
+  }
+}
+
+// CF-Connecting-IP is set by Cloudflare and cannot be forged by the client. X-Forwarded-For is
+// only honored when the connecting peer is a configured trusted proxy, walking right-to-left past
+// other trusted hops so a client-supplied left-most entry is never trusted.
+export function resolveClientIP(request: Request, env: Env): string {
+  const connectingIP = (request.headers.get("CF-Connecting-IP") ?? "").trim() || "unknown";
+  const trustedProxies = parseTrustedProxies(env.RATE_LIMIT_TRUSTED_PROXY_IPS);
+  if (!trustedProxies.has(connectingIP)) {
+    return connectingIP;
+  }
+
+  const forwarded = (request.headers.get("X-Forwarded-For") ?? "")
+    .split(",")
+    .map((value) => value.trim())
+    .filter(Boolean);
+  for (let index = forwarded.length - 1; index >= 0; index -= 1) {
+    if (!trustedProxies.has(forwarded[index])) {
+      return forwarded[index];
+    }
+  }
+  return connectingIP;
+}
+
+function parseTrustedProxies(value: string | undefined): Set<string> {
+  return new Set(
+    (value ?? "")
+      .split(",")
+      .map((item) => item.trim())
+      .filter(Boolean)
+  );
+}
@@ -12,7 +12,7 @@ const ALL_KNOWN_CHAINS = Object.values(viemChains).filter(isChainDefinition) as
 export async function estimateRelayRequestGas(chainId: number, request: RelayTransactionRequestModel): Promise<bigint> {
   const chain = extractChain({ chains: ALL_KNOWN_CHAINS, id: chainId });
   if (!chain) {
-    throw new BadRequestError(`Unsupported chain ${chainId} for gas estimation.`);
+    throw new BadRequestError(`Unsupported chain ${chainId} for gas estimation.`, "unsupported_chain");
   }
 
   const client = createPublicClient({
@@ -33,7 +33,7 @@ export async function estimateRelayRequestGas(chainId: number, request: RelayTra
     });
   } catch (error) {
     const reason = error instanceof Error ? error.message : "unknown gas estimation error";
-    throw new BadRequestError(`Gas estimation failed for chain ${chainId}: ${reason}`);
+    throw new BadRequestError(`Gas estimation failed for chain ${chainId}: ${reason}`, "gas_estimation_failed");
   }
 }
 
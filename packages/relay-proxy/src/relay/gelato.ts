@@ -6,7 +6,7 @@ import {
 } from "@gelatocloud/gasless";
 import { zeroAddress } from "viem";
 
-import { BadRequestError } from "../errors";
+import { BadRequestError, ServiceUnavailableError } from "../errors";
 
 import { estimateRelayRequestGas } from "./gas-estimator";
 import type {
@@ -69,7 +69,7 @@ export async function getRelayStatus(
 ): Promise<RelayStatusModel> {
   const relayID = id.trim();
   if (!relayID) {
-    throw new BadRequestError("Missing relay task id.");
+    throw new BadRequestError("Missing relay task id.", "missing_task_id");
   }
 
   try {
@@ -79,9 +79,10 @@ export async function getRelayStatus(
     if (error instanceof Error) {
       throw new BadRequestError(
         `Relayer status lookup failed: ${error.message}`,
+        "relay_status_failed",
       );
     }
-    throw new BadRequestError("Relayer status lookup failed.");
+    throw new BadRequestError("Relayer status lookup failed.", "relay_status_failed");
   }
 }
 
@@ -101,6 +102,7 @@ function buildSendTransactionParameters(
   if (tx.request.value && BigInt(tx.request.value) > 0n) {
     throw new BadRequestError(
       `Unsupported request.value for chain ${tx.chainId}; include value in execute call payload instead.`,
+      "invalid_relay_request",
     );
   }
 
@@ -174,7 +176,7 @@ function getClientForSupportMode(
     case "FULL_MAINNET":
       return createClient(getApiKey(false, env), false);
     default:
-      throw new BadRequestError("Invalid support mode.");
+      throw new BadRequestError("Invalid support mode.", "invalid_support_mode");
   }
 }
 
@@ -192,10 +194,11 @@ function getApiKey(isTestnet: boolean, env: Env): string {
       : env.GELATO_MAINNET_API_KEY
     )?.trim() ?? "";
   if (!apiKey) {
-    throw new BadRequestError(
+    throw new ServiceUnavailableError(
       isTestnet
         ? "Missing GELATO_TESTNET_API_KEY."
         : "Missing GELATO_MAINNET_API_KEY.",
+      "missing_config",
     );
   }
   return apiKey;
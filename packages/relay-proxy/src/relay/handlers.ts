@@ -1,5 +1,5 @@
 import { SUPPORT_MODES } from "../constants";
-import { BadRequestError, PaymentRequiredError } from "../errors";
+import { BadRequestError, PaymentRequiredError, RelaySubmissionError } from "../errors";
 import { formatNativeToken, jsonResponse, normalizeAddress } from "../utils";
 
 import {
@@ -23,7 +23,7 @@ export async function handleSubmitRelay(rawBody: string, env: Env): Promise<Resp
   const allTxs = [...relayNowTxs, ...body.deferredTxs];
 
   if (relayNowTxs.length === 0 && body.deferredTxs.length === 0) {
-    throw new BadRequestError("At least one relay transaction is required.");
+    throw new BadRequestError("At least one relay transaction is required.", "invalid_relay_request");
   }
   assertSingleSupportModeInvocation(allTxs, body.supportMode);
   await assertRelayTransactionsMatchAccount(account, allTxs);
@@ -104,23 +104,17 @@ export async function handleSubmitRelay(rawBody: string, env: Env): Promise<Resp
 
   if (hasError) {
     // Keep debit as-is for now: we still pay infra for attempted relays.
-    return jsonResponse(
-      {
-        ok: false,
-        error: "relay_submission_failed",
-        reason: firstErrorMessage,
-        accounting: {
-          supportMode: body.supportMode,
-          estimatedDebitNative: formatNativeToken(estimatedDebitWei),
-          balanceBeforeNative: formatNativeToken(tankBefore.balanceWei),
-          balanceAfterNative: formatNativeToken(postDebitWei),
-        },
-        immediateSubmissions,
-        backgroundSubmissions,
-        deferredSubmissions,
+    throw new RelaySubmissionError(firstErrorMessage, {
+      accounting: {
+        supportMode: body.supportMode,
+        estimatedDebitNative: formatNativeToken(estimatedDebitWei),
+        balanceBeforeNative: formatNativeToken(tankBefore.balanceWei),
+        balanceAfterNative: formatNativeToken(postDebitWei),
       },
-      502
-    );
+      immediateSubmissions,
+      backgroundSubmissions,
+      deferredSubmissions,
+    });
   }
 
   return jsonResponse({
@@ -141,10 +135,10 @@ export async function handleRelayStatus(url: URL, env: Env): Promise<Response> {
   const id = (url.searchParams.get("id") ?? "").trim();
   const modeRaw = (url.searchParams.get("supportMode") ?? "").trim();
   if (!id) {
-    throw new BadRequestError("Missing relay task id.");
+    throw new BadRequestError("Missing relay task id.", "missing_task_id");
   }
   if (!SUPPORT_MODES.has(modeRaw)) {
-    throw new BadRequestError("Missing or invalid supportMode.");
+    throw new BadRequestError("Missing or invalid supportMode.", "invalid_support_mode");
   }
 
   const supportMode = modeRaw as SupportMode;
@@ -156,7 +150,7 @@ export async function handleCredit(url: URL, env: Env): Promise<Response> {
   const account = normalizeAddress(url.searchParams.get("account") ?? "");
   const modeRaw = (url.searchParams.get("supportMode") ?? "").trim();
   if (!SUPPORT_MODES.has(modeRaw)) {
-    throw new BadRequestError("Invalid supportMode.");
+    throw new BadRequestError("Invalid supportMode.", "invalid_support_mode");
   }
 
   const supportMode = modeRaw as SupportMode;
@@ -180,7 +174,7 @@ function assertSingleSupportModeInvocation(txs: ReadonlyArray<{ supportMode?: Su
       continue;
     }
     if (invocationMode !== mode) {
-      throw new BadRequestError("Mixed support modes in one relay invocation are not allowed.");
+      throw new BadRequestError("Mixed support modes in one relay invocation are not allowed.", "mixed_support_modes");
     }
   }
 }
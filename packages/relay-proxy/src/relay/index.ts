@@ -1,9 +1,17 @@
 export { handleCredit, handleRelayStatus, handleSubmitRelay } from "./handlers";
 
 export type {
+  BatchDirectUploadItemModel,
+  BatchDirectUploadRequestModel,
   DirectUploadRequestModel,
+  DirectUploadResponseModel,
   Env,
+  FaucetAntibotProofModel,
+  FaucetChainOutcomeModel,
+  FaucetChainResultModel,
+  FaucetFundingReportModel,
   FaucetFundRequestModel,
+  FaucetTransferResultModel,
   HexQuantity,
   NormalizedDirectUploadRequestModel,
   PaymentOptionModel,
@@ -13,7 +21,12 @@ export type {
   RelayTransactionRequestModel,
   RelayTxEnvelopeModel,
   RelayYParity,
+  RevokedImageModel,
   SubmitRelayRequestModel,
   SupportMode,
   TankStateModel,
+  UploadedImageModel,
+  UploadOwnershipProofModel,
+  UploadWebhookPayloadModel,
+  VerifyImageRequestModel,
 } from "./models";
@@ -3,16 +3,74 @@ import type { Address, Hex } from "viem";
 export interface Env {
   GAS_TANK_KV: KVNamespace;
   FAUCET_FUNDING_KV?: KVNamespace;
+  IMAGE_REVOCATION_KV?: KVNamespace;
   FAUCET_TRACKER_DO?: DurableObjectNamespace;
+  OWNERSHIP_LEDGER_DO: DurableObjectNamespace;
+  METRICS?: AnalyticsEngineDataset;
+  CF_VERSION_METADATA?: WorkerVersionMetadata;
+  BUILD_VERSION?: string;
+  BUILD_COMMIT?: string;
+  GLOBAL_RATE_LIMITER?: RateLimit;
+  IP_RATE_LIMITER?: RateLimit;
+  RATE_LIMIT_PERIOD_SECONDS?: string;
+  RATE_LIMIT_TRUSTED_PROXY_IPS?: string;
   RELAY_AUTH_TOKEN: string;
+  RELAY_AUTH_TOKEN_NEXT?: string;
   RELAY_AUTH_HMAC_SECRET?: string;
+  ADMIN_AUTH_TOKEN?: string;
+  TENANT_TOKENS?: string;
+  MAINTENANCE_MODE?: string;
+  AUDIT_LOG_ENABLED?: string;
+  LOG_SAMPLE_RATE?: string;
+  LOG_EFFECTIVE_CONFIG?: string;
+  MAX_REQUEST_BODY_BYTES?: string;
+  UPLOAD_TOKEN_SECRET?: string;
+  UPLOAD_TOKEN_MAX_TTL_SECONDS?: string;
+  ALLOW_SHARED_UPLOAD_TOKEN?: string;
+  REQUIRE_SIGNED_EOA?: string;
+  ALLOW_SIGNED_EOA_UPLOADS?: string;
   GELATO_MAINNET_API_KEY?: string;
   GELATO_TESTNET_API_KEY?: string;
   PINATA_JWT: string;
   PINATA_GATEWAY_BASE_URL: string;
   PINATA_GROUP_ID: string;
   PINATA_SIGN_EXPIRES_SECONDS?: string;
+  PINATA_SIGN_MIN_EXPIRES_SECONDS?: string;
+  PINATA_SIGN_MAX_EXPIRES_SECONDS?: string;
   PINATA_MAX_FILE_SIZE_BYTES?: string;
+  REJECT_DOUBLE_EXTENSION?: string;
+  ALLOWED_CONTENT_TYPES?: string;
+  UPLOAD_SCOPES?: string;
+  UPLOAD_BATCH_MAX_ITEMS?: string;
+  RESPONSE_COMPRESSION_MIN_BYTES?: string;
+  CORS_ALLOWED_ORIGINS?: string;
+  CORS_ALLOW_CREDENTIALS?: string;
+  CORS_MAX_AGE_SECONDS?: string;
+  HANDLER_TIMEOUT_SECONDS?: string;
+  PROXY_UPLOAD_ENABLED?: string;
+  UPSTREAM_BREAKER_FAILURE_THRESHOLD?: string;
+  UPSTREAM_BREAKER_COOLDOWN_SECONDS?: string;
+  UPSTREAM_BREAKER_MAX_COOLDOWN_SECONDS?: string;
+  IMAGE_ID_COLLISION_CHECK?: string;
+  FILE_NAME_MIN_LENGTH?: string;
+  FILE_NAME_MAX_LENGTH?: string;
+  FILENAME_UNICODE_MODE?: string;
+  UPLOAD_GROUP_ROUTES?: string;
+  OBJECT_KEY_TIME_FORMAT?: string;
+  OBJECT_KEY_RANDOM_BYTES?: string;
+  DELIVERY_TRANSFORM?: string;
+  DELIVERY_TRANSFORM_ORIGIN?: string;
+  BROWSER_RENDERABLE_TYPES?: string;
+  DELIVERY_VARIANTS?: string;
+  DELIVERY_MODE?: string;
+  DELIVERY_URL_EXPIRES_SECONDS?: string;
+  IMAGE_MIN_DIMENSION?: string;
+  IMAGE_MAX_DIMENSION?: string;
+  IMAGE_MAX_ASPECT_RATIO?: string;
+  UPLOAD_WEBHOOK_URL?: string;
+  UPLOAD_WEBHOOK_SECRET?: string;
+  OTEL_EXPORTER_OTLP_ENDPOINT?: string;
+  OTEL_EXPORTER_OTLP_HEADERS?: string;
   GELATO_SYNC_TIMEOUT_MS?: string;
   INITIAL_CREDIT_NATIVE?: string;
   FLOOR_LIMITED_TESTNET_NATIVE?: string;
@@ -23,6 +81,34 @@ export interface Env {
   SINGLETON_ACCUMULATOR_FACTORY?: string;
   SINGLETON_VERSION?: string;
   SINGLETON_RELEASE_NOTES?: string;
+  STRICT_CONFIG?: string;
+  FAUCET_MIN_NATIVE_BALANCE?: string;
+  FAUCET_MIN_USDC_BALANCE?: string;
+  FAUCET_BALANCE_CACHE_SECONDS?: string;
+  FAUCET_RPC_URLS?: string;
+  FAUCET_TOKENS?: string;
+  FAUCET_USDC_ADDRESSES?: string;
+  FAUCET_DRY_RUN?: string;
+  FAUCET_REPORT_GAS_COST?: string;
+  FAUCET_SKIP_ACTIVE_ACCOUNTS?: string;
+  FAUCET_CONFIRMATIONS?: string;
+  FAUCET_TOPUP_TARGETS?: string;
+  FAUCET_NATIVE_USD_PRICE?: string;
+  FAUCET_ANTIBOT?: string;
+  FAUCET_COOLDOWN_SECONDS?: string;
+  FAUCET_CHAIN_TIMEOUT_SECONDS?: string;
+  FAUCET_JOB_TIMEOUT_SECONDS?: string;
+  FAUCET_QUEUE_MAX_DEPTH?: string;
+  FAUCET_DISABLED_CHAINS?: string;
+  FAUCET_ALLOWED_EOAS?: string;
+  TURNSTILE_SECRET_KEY?: string;
+  FAUCET_POW_SECRET?: string;
+  FAUCET_SIGNATURE_SECRET?: string;
+  FAUCET_POW_DIFFICULTY?: string;
+  FAUCET_GAS_MARGIN_PERCENT?: string;
+  FAUCET_MAX_GAS_LIMIT?: string;
+  FAUCET_MIN_GAS_PRICE_WEI?: string;
+  FAUCET_MAX_GAS_PRICE_WEI?: string;
 }
 
 export type SupportMode = "LIMITED_TESTNET" | "LIMITED_MAINNET" | "FULL_MAINNET";
@@ -92,16 +178,170 @@ export interface DirectUploadRequestModel {
   eoaAddress: string;
   fileName: string;
   contentType: string;
+  expirySeconds?: number;
+  metadata?: Record<string, string>;
+  ownershipProof?: UploadOwnershipProofModel;
+  variants?: string[];
+  scope?: string;
+}
+
+export interface DirectUploadResponseModel {
+  uploadURL: string;
+  imageID: string;
+  gatewayBaseURL: string;
+  deliveryMode: "public" | "signed";
+  variants: Record<string, string>;
+  browserRenderable: boolean;
+  browserFallbackURL: string | null;
+  expirySeconds: number;
+  expiresAt: string;
+}
+
+export interface BatchDirectUploadRequestModel {
+  uploads: unknown[];
+}
+
+export type BatchDirectUploadItemModel =
+  | ({ ok: true } & DirectUploadResponseModel)
+  | { ok: false; error: { code: string; message: string } };
+
+export interface ProxiedUploadResponseModel {
+  imageID: string;
+  cid: string;
+  deliveryURL: string;
+  deliveryURLExpiresAt: string | null;
+  variants: Record<string, string>;
+  browserRenderable: boolean;
+  browserFallbackURL: string | null;
+  size: number;
+  contentType: string;
+}
+
+export interface UploadedImageModel {
+  imageID: string;
+  cid: string;
+  deliveryURL: string;
+  // Set when DELIVERY_MODE=signed; list again to get a fresh link before it lapses.
+  deliveryURLExpiresAt: string | null;
+  variants: Record<string, string>;
+  browserRenderable: boolean;
+  browserFallbackURL: string | null;
+  size: number;
+  contentType: string;
+  createdAt: string;
+}
+
+export interface RevokedImageModel {
+  imageID: string;
+  cid: string | null;
+  revokedAt: string;
+}
+
+export interface UploadWebhookPayloadModel {
+  eoa: string | null;
+  tenant: string | null;
+  imageID: string | null;
+  cid: string;
+  deliveryURL: string;
+  deliveryURLExpiresAt: string | null;
+  size: number | null;
+  contentType: string;
+  verifiedAt: string;
+}
+
+export type UploadOwnershipProofType = "eip191" | "eip712";
+
+export interface UploadOwnershipProofModel {
+  type?: UploadOwnershipProofType;
+  signature: string;
+  issuedAt: number;
+}
+
+export interface NormalizedOwnershipProofModel {
+  type: UploadOwnershipProofType;
+  signature: string;
+  issuedAt: number;
+  // fileName as sent, before sanitizing: the EIP-712 struct commits to its hash.
+  fileName: string;
 }
 
 export interface NormalizedDirectUploadRequestModel {
   eoaAddress: string;
   fileName: string;
   contentType: string;
+  expirySeconds: number;
+  metadata: Record<string, string>;
+  ownershipProof: NormalizedOwnershipProofModel | null;
+  variants: string[];
+  scope: string | null;
+  tenant: string | null;
   imageID: string;
 }
 
+export interface VerifyImageRequestModel {
+  cid: string;
+  contentType: string;
+}
+
 export interface FaucetFundRequestModel {
   eoaAddress: string;
   supportMode: SupportMode;
+  antibot?: FaucetAntibotProofModel;
+}
+
+export interface MaintenanceToggleRequestModel {
+  enabled?: boolean;
+}
+
+export interface FaucetChainToggleRequestModel {
+  enabled?: boolean;
+}
+
+export interface FaucetAntibotProofModel {
+  token?: string;
+  challenge?: string;
+  solution?: string;
+  signature?: string;
+}
+
+export interface FaucetTransferResultModel {
+  token: string;
+  status: "sent" | "simulated" | "failed" | "skipped";
+  // Only for top-up drips: the units sent, or why nothing was (`at_target`).
+  amount?: string;
+  reason?: string;
+  txHash?: string;
+  calldata?: string;
+  nonce?: number;
+  gasLimit?: string;
+  // Only with FAUCET_REPORT_GAS_COST, once the receipt arrived.
+  gasUsed?: string;
+  gasCostWei?: string;
+  // Only with FAUCET_CONFIRMATIONS: blocks mined on top of the transfer's block when waiting stopped.
+  confirmations?: number;
+  nonceCorrected?: boolean;
+  error?: string;
+}
+
+export interface FaucetChainResultModel {
+  chainId: number;
+  status: "succeeded" | "failed" | "skipped";
+  reason?: string;
+  transfers: FaucetTransferResultModel[];
+  gasCostNative?: string;
+  gasCostUsd?: number;
+}
+
+export interface FaucetChainOutcomeModel {
+  chainId: number;
+  reason: string;
+}
+
+export interface FaucetFundingReportModel {
+  configured: number[];
+  attempted: number[];
+  succeeded: number[];
+  failed: FaucetChainOutcomeModel[];
+  skipped: FaucetChainOutcomeModel[];
+  chains: FaucetChainResultModel[];
 }
@@ -40,17 +40,23 @@ export async function assertRelayTransactionsMatchAccount(
 ): Promise<void> {
   for (const tx of txs) {
     if (tx.request.from !== account) {
-      throw new BadRequestError(`Relay tx account mismatch for chain ${tx.chainId}.`);
+      throw new BadRequestError(`Relay tx account mismatch for chain ${tx.chainId}.`, "invalid_relay_request");
     }
 
     for (const [index, auth] of (tx.request.authorizationList ?? []).entries()) {
       if (auth.chainId !== tx.chainId) {
-        throw new BadRequestError(`request.authorizationList[${index}].chainId must match relay chain ${tx.chainId}.`);
+        throw new BadRequestError(
+          `request.authorizationList[${index}].chainId must match relay chain ${tx.chainId}.`,
+          "invalid_relay_request"
+        );
       }
 
       const recoveredAuthority = await recoverAuthAddress(auth, index);
       if (recoveredAuthority !== account) {
-        throw new BadRequestError(`request.authorizationList[${index}] signer mismatch for chain ${tx.chainId}.`);
+        throw new BadRequestError(
+          `request.authorizationList[${index}] signer mismatch for chain ${tx.chainId}.`,
+          "invalid_relay_request"
+        );
       }
     }
   }
@@ -64,13 +70,16 @@ async function recoverAuthAddress(auth: RelayAuthorizationModel, index: number):
   try {
     return normalizeAddress(await recoverAuthorizationAddress({ authorization: auth }));
   } catch {
-    throw new BadRequestError(`request.authorizationList[${index}] has an invalid EIP-7702 signature.`);
+    throw new BadRequestError(
+      `request.authorizationList[${index}] has an invalid EIP-7702 signature.`,
+      "invalid_relay_request"
+    );
   }
 }
 
 function parseTxEnvelopeList(value: JsonValue | undefined, fieldName: string): RelayTxEnvelopeModel[] {
   if (!Array.isArray(value)) {
-    throw new BadRequestError(`${fieldName} must be an array.`);
+    throw new BadRequestError(`${fieldName} must be an array.`, "invalid_relay_request");
   }
 
   return value.map((item) => parseTxEnvelope(item, fieldName));
@@ -115,7 +124,7 @@ function parseAuthorizationList(value: JsonValue | undefined, chainId: number, e
     return [];
   }
   if (!Array.isArray(value)) {
-    throw new BadRequestError(errorMessage);
+    throw new BadRequestError(errorMessage, "invalid_relay_request");
   }
 
   return value.map((item, index) => {
@@ -139,7 +148,7 @@ function parsePaymentOptions(value: JsonValue | undefined): PaymentOptionModel[]
     return [];
   }
   if (!Array.isArray(value)) {
-    throw new BadRequestError("paymentOptions must be an array.");
+    throw new BadRequestError("paymentOptions must be an array.", "invalid_relay_request");
   }
 
   return value.map((item, index) => {
@@ -158,11 +167,11 @@ function parseJsonObject(rawBody: string, jsonError: string, payloadError: strin
   try {
     parsed = JSON.parse(rawBody) as JsonValue;
   } catch {
-    throw new BadRequestError(jsonError);
+    throw new BadRequestError(jsonError, "invalid_relay_request");
   }
 
   if (!isJsonObject(parsed)) {
-    throw new BadRequestError(payloadError);
+    throw new BadRequestError(payloadError, "invalid_relay_request");
   }
   return parsed;
 }
@@ -173,18 +182,18 @@ function isJsonObject(value: JsonValue): value is JsonObject {
 
 function asJsonObject(value: JsonValue | undefined, errorMessage: string): JsonObject {
   if (value === undefined || !isJsonObject(value)) {
-    throw new BadRequestError(errorMessage);
+    throw new BadRequestError(errorMessage, "invalid_relay_request");
   }
   return value;
 }
 
 function parseSupportMode(value: JsonValue | undefined, errorMessage: string): SupportMode {
   if (typeof value !== "string") {
-    throw new BadRequestError(errorMessage);
+    throw new BadRequestError(errorMessage, "invalid_relay_request");
   }
   const normalized = value.trim();
   if (!SUPPORT_MODES.has(normalized)) {
-    throw new BadRequestError(errorMessage);
+    throw new BadRequestError(errorMessage, "invalid_relay_request");
   }
   return normalized as SupportMode;
 }
@@ -198,18 +207,18 @@ function parseOptionalSupportMode(value: JsonValue | undefined, errorMessage: st
 
 function parseAddress(value: JsonValue | undefined, errorMessage: string): Address {
   if (typeof value !== "string") {
-    throw new BadRequestError(errorMessage);
+    throw new BadRequestError(errorMessage, "invalid_relay_request");
   }
   return normalizeAddress(value) as Address;
 }
 
 function parseHexData(value: JsonValue | undefined, errorMessage: string): Hex {
   if (typeof value !== "string") {
-    throw new BadRequestError(errorMessage);
+    throw new BadRequestError(errorMessage, "invalid_relay_request");
   }
   const trimmed = value.trim();
   if (!/^0x[0-9a-fA-F]*$/.test(trimmed)) {
-    throw new BadRequestError(errorMessage);
+    throw new BadRequestError(errorMessage, "invalid_relay_request");
   }
   return trimmed as Hex;
 }
@@ -219,11 +228,11 @@ function parseOptionalHexQuantity(value: JsonValue | undefined, errorMessage: st
     return undefined;
   }
   if (typeof value !== "string") {
-    throw new BadRequestError(errorMessage);
+    throw new BadRequestError(errorMessage, "invalid_relay_request");
   }
   const trimmed = value.trim().toLowerCase();
   if (!/^0x[0-9a-f]+$/.test(trimmed)) {
-    throw new BadRequestError(errorMessage);
+    throw new BadRequestError(errorMessage, "invalid_relay_request");
   }
   return trimmed as Hex;
 }
@@ -231,7 +240,7 @@ function parseOptionalHexQuantity(value: JsonValue | undefined, errorMessage: st
 function parsePositiveInteger(value: JsonValue | undefined, errorMessage: string): number {
   const out = parseUnsignedInteger(value, errorMessage);
   if (out <= 0) {
-    throw new BadRequestError(errorMessage);
+    throw new BadRequestError(errorMessage, "invalid_relay_request");
   }
   return out;
 }
@@ -241,7 +250,7 @@ function parseUnsignedInteger(value: JsonValue | undefined, errorMessage: string
     if (Number.isSafeInteger(value) && value >= 0) {
       return value;
     }
-    throw new BadRequestError(errorMessage);
+    throw new BadRequestError(errorMessage, "invalid_relay_request");
   }
 
   if (typeof value === "string" && /^\d+$/.test(value.trim())) {
@@ -251,7 +260,7 @@ function parseUnsignedInteger(value: JsonValue | undefined, errorMessage: string
     }
   }
 
-  throw new BadRequestError(errorMessage);
+  throw new BadRequestError(errorMessage, "invalid_relay_request");
 }
 
 function parseYParity(value: JsonValue | undefined, errorMessage: string): RelayYParity {
@@ -262,28 +271,28 @@ function parseYParity(value: JsonValue | undefined, errorMessage: string): Relay
   if (raw === 27 || raw === 28) {
     return (raw - 27) as RelayYParity;
   }
-  throw new BadRequestError(errorMessage);
+  throw new BadRequestError(errorMessage, "invalid_relay_request");
 }
 
 function parseNonEmptyString(value: JsonValue | undefined, errorMessage: string): string {
   if (typeof value !== "string") {
-    throw new BadRequestError(errorMessage);
+    throw new BadRequestError(errorMessage, "invalid_relay_request");
   }
   const trimmed = value.trim();
   if (!trimmed) {
-    throw new BadRequestError(errorMessage);
+    throw new BadRequestError(errorMessage, "invalid_relay_request");
   }
   return trimmed;
 }
 
 function parsePositiveDecimalString(value: JsonValue | undefined, errorMessage: string): string {
   if (typeof value !== "string" && typeof value !== "number") {
-    throw new BadRequestError(errorMessage);
+    throw new BadRequestError(errorMessage, "invalid_relay_request");
   }
   const normalized = String(value).trim();
   const asNumber = Number(normalized);
   if (!Number.isFinite(asNumber) || asNumber <= 0) {
-    throw new BadRequestError(errorMessage);
+    throw new BadRequestError(errorMessage, "invalid_relay_request");
   }
   return normalized;
 }
@@ -1,3 +1,4 @@
+import { ServiceUnavailableError } from "./errors";
 import type { Env } from "./relay/models";
 import { jsonResponse } from "./utils";
 
@@ -8,7 +9,7 @@ export function handleSingletonVersion(env: Env): Response {
     const releaseNotes = (env.SINGLETON_RELEASE_NOTES ?? "").trim();
 
     if (!address || !accumulatorFactory || !version) {
-        return jsonResponse({ ok: false, error: "singleton_not_configured" }, 503);
+        throw new ServiceUnavailableError("Singleton release is not configured.", "singleton_not_configured");
     }
 
     return jsonResponse({
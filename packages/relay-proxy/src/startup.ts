@@ -0,0 +1,66 @@
+import { describeCapabilities } from "./capabilities";
+import type { Env } from "./relay/models";
+import { parseBooleanFlag, resolveCorsPolicy } from "./utils";
+
+// Matched against the variable name, so a new secret is redacted as long as it is named like one.
+// URL-valued settings are included because RPC and webhook URLs often embed an API key.
+const SECRET_ENV_NAME_PATTERN = /SECRET|TOKEN|JWT|PASSWORD|KEY|RPC_URL|WEBHOOK_URL/;
+const REDACTED = "***";
+
+// With LOG_EFFECTIVE_CONFIG=true, the first request an isolate serves logs one JSON line with the
+// config in effect. Workers have no startup hook, and env is only available per request. Plain
+// settings are logged as set, secret-named ones as `***`, and bindings only as present.
+export function logEffectiveConfig(env: Env): void {
+  if (!parseBooleanFlag(env.LOG_EFFECTIVE_CONFIG, false)) {
+    return;
+  }
+
+  let capabilities: unknown;
+  try {
+    capabilities = describeCapabilities(env);
+  } catch (error) {
+    capabilities = { error: error instanceof Error ? error.message : "invalid config" };
+  }
+
+  console.log(
+    JSON.stringify({
+      log: "config",
+      event: "effective_config",
+      version: (env.BUILD_VERSION ?? "").trim() || null,
+      commit: (env.BUILD_COMMIT ?? "").trim() || null,
+      deploymentID: env.CF_VERSION_METADATA?.id ?? null,
+      capabilities,
+      settings: redactEnv(env),
+    })
+  );
+}
+
+// Logged regardless of LOG_EFFECTIVE_CONFIG: an invalid CORS config fails every non-probe request
+// with `503 invalid_cors_config`, and the probes alone would not show why.
+export function logInvalidCorsPolicy(env: Env): void {
+  try {
+    resolveCorsPolicy(env);
+  } catch (error) {
+    console.error(
+      JSON.stringify({
+        log: "config",
+        event: "invalid_cors_config",
+        message: error instanceof Error ? error.message : String(error),
+      })
+    );
+  }
+}
+
+function redactEnv(env: Env): Record<string, string> {
+  const settings: Record<string, string> = {};
+  for (const [name, value] of Object.entries(env).sort(([a], [b]) => a.localeCompare(b))) {
+    if (typeof value !== "string") {
+      settings[name] = "bound";
+    } else if (SECRET_ENV_NAME_PATTERN.test(name)) {
+      settings[name] = REDACTED;
+    } else {
+      settings[name] = value;
+    }
+  }
+  return settings;
+}
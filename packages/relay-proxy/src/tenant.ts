@@ -0,0 +1,51 @@
+import { ServiceUnavailableError } from "./errors";
+import type { Env } from "./relay/models";
+import { matchesAnyToken } from "./utils";
+
+// Lowercase and URL-safe, so a tenant ID can lead an imageID without encoding.
+export const TENANT_ID_PATTERN = /^[a-z0-9][a-z0-9-]{0,62}$/;
+
+// TENANT_TOKENS is a JSON object mapping an app's bearer token to its tenant ID, e.g.
+// {"<token>": "app-one"}. Tenant tokens authenticate the image routes only; relay and faucet
+// routes keep using RELAY_AUTH_TOKEN.
+export function resolveTenantTokens(env: Env): [token: string, tenant: string][] {
+  const raw = (env.TENANT_TOKENS ?? "").trim();
+  if (!raw) {
+    return [];
+  }
+
+  let parsed: unknown;
+  try {
+    parsed = JSON.parse(raw);
+  } catch {
+    throw new ServiceUnavailableError("TENANT_TOKENS must be a JSON object.", "invalid_config");
+  }
+  if (!parsed || typeof parsed !== "object" || Array.isArray(parsed)) {
+    throw new ServiceUnavailableError("TENANT_TOKENS must be a JSON object.", "invalid_config");
+  }
+
+  return Object.entries(parsed).map(([token, tenant]): [string, string] => {
+    // The token is a secret, so only the tenant side is echoed back.
+    if (typeof tenant !== "string" || !TENANT_ID_PATTERN.test(tenant) || token.trim() === "") {
+      throw new ServiceUnavailableError(`Invalid TENANT_TOKENS entry for tenant ${String(tenant)}.`, "invalid_config");
+    }
+    return [token.trim(), tenant];
+  });
+}
+
+// Compares against every entry so the time taken does not reveal which token matched.
+export async function resolveTenantForToken(env: Env, token: string): Promise<string | null> {
+  let matched: string | null = null;
+  for (const [candidate, tenant] of resolveTenantTokens(env)) {
+    if (await matchesAnyToken(token, [candidate])) {
+      matched = tenant;
+    }
+  }
+  return matched;
+}
+
+// The default tenant (RELAY_AUTH_TOKEN, upload tokens and signed-EOA uploads) keeps the
+// unprefixed `avatars/...` layout.
+export function buildTenantKeyPrefix(tenant: string | null): string {
+  return tenant ? `${tenant}/` : "";
+}
@@ -0,0 +1,194 @@
+import type { Env } from "./relay/models";
+import { randomHex } from "./utils";
+
+export type SpanAttributeValue = string | number | boolean;
+export type SpanAttributes = Record<string, SpanAttributeValue>;
+
+// OTLP SpanKind values.
+type SpanKind = 1 | 2;
+const SPAN_KIND_INTERNAL: SpanKind = 1;
+const SPAN_KIND_SERVER: SpanKind = 2;
+
+interface RecordedSpan {
+  traceId: string;
+  spanId: string;
+  parentSpanId?: string;
+  name: string;
+  kind: SpanKind;
+  startedAt: number;
+  endedAt: number;
+  attributes: SpanAttributes;
+  error?: string;
+}
+
+const TRACEPARENT_PATTERN = /^00-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$/;
+const SERVICE_NAME = "relay-proxy";
+
+// Minimal OpenTelemetry tracer: spans are buffered per request and exported as OTLP/HTTP JSON to
+// OTEL_EXPORTER_OTLP_ENDPOINT on flush. With no endpoint configured every call is a cheap no-op.
+// Context crosses the Worker -> Durable Object hop through a W3C `traceparent` header.
+export class Tracer {
+  private readonly endpoint: string;
+  private readonly traceId: string;
+  private readonly remoteParentSpanId?: string;
+  private buffer: RecordedSpan[] = [];
+
+  constructor(
+    private readonly env: Env,
+    traceparent: string | null
+  ) {
+    this.endpoint = (env.OTEL_EXPORTER_OTLP_ENDPOINT ?? "").trim().replace(/\/+$/, "");
+    const parent = TRACEPARENT_PATTERN.exec((traceparent ?? "").trim().toLowerCase());
+    this.traceId = parent?.[1] ?? randomHex(16);
+    this.remoteParentSpanId = parent?.[2];
+  }
+
+  get enabled(): boolean {
+    return this.endpoint !== "";
+  }
+
+  startSpan(name: string, attributes: SpanAttributes = {}): Span {
+    return new Span(this, this.traceId, this.remoteParentSpanId, name, SPAN_KIND_SERVER, attributes);
+  }
+
+  record(span: RecordedSpan): void {
+    if (this.enabled) {
+      this.buffer.push(span);
+    }
+  }
+
+  // Sends every span ended so far. Safe to call more than once, e.g. again at the end of a
+  // `waitUntil` task whose spans outlive the request.
+  async flush(): Promise<void> {
+    if (!this.enabled || this.buffer.length === 0) {
+      return;
+    }
+
+    const spans = this.buffer;
+    this.buffer = [];
+    try {
+      const response = await fetch(`${this.endpoint}/v1/traces`, {
+        method: "POST",
+        headers: { "Content-Type": "application/json", ...parseOtlpHeaders(this.env.OTEL_EXPORTER_OTLP_HEADERS) },
+        body: JSON.stringify(buildOtlpPayload(spans)),
+      });
+      if (!response.ok) {
+        console.warn(`trace export failed with status ${response.status}`);
+      }
+    } catch (error) {
+      const reason = error instanceof Error ? error.message : "unknown trace export error";
+      console.warn("trace export failed", reason);
+    }
+  }
+}
+
+export class Span {
+  readonly spanId = randomHex(8);
+  private readonly startedAt = Date.now();
+  private ended = false;
+
+  constructor(
+    readonly tracer: Tracer,
+    readonly traceId: string,
+    private readonly parentSpanId: string | undefined,
+    private readonly name: string,
+    private readonly kind: SpanKind,
+    private readonly attributes: SpanAttributes
+  ) {}
+
+  get traceparent(): string {
+    return `00-${this.traceId}-${this.spanId}-01`;
+  }
+
+  setAttribute(key: string, value: SpanAttributeValue): void {
+    this.attributes[key] = value;
+  }
+
+  child(name: string, attributes: SpanAttributes = {}): Span {
+    return new Span(this.tracer, this.traceId, this.spanId, name, SPAN_KIND_INTERNAL, attributes);
+  }
+
+  // Runs `fn` inside a child span that ends when it settles and records a thrown error.
+  async run<T>(name: string, attributes: SpanAttributes, fn: (span: Span) => Promise<T>): Promise<T> {
+    const span = this.child(name, attributes);
+    try {
+      const result = await fn(span);
+      span.end();
+      return result;
+    } catch (error) {
+      span.end(error);
+      throw error;
+    }
+  }
+
+  end(error?: unknown): void {
+    if (this.ended) {
+      return;
+    }
+    this.ended = true;
+    this.tracer.record({
+      traceId: this.traceId,
+      spanId: this.spanId,
+      parentSpanId: this.parentSpanId,
+      name: this.name,
+      kind: this.kind,
+      startedAt: this.startedAt,
+      endedAt: Date.now(),
+      attributes: this.attributes,
+      error: error === undefined ? undefined : error instanceof Error ? error.message : String(error),
+    });
+  }
+}
+
+// OTEL_EXPORTER_OTLP_HEADERS follows the OpenTelemetry env format: `key1=value1,key2=value2`.
+function parseOtlpHeaders(value: string | undefined): Record<string, string> {
+  const headers: Record<string, string> = {};
+  for (const entry of (value ?? "").split(",")) {
+    const separator = entry.indexOf("=");
+    if (separator <= 0) {
+      continue;
+    }
+    headers[entry.slice(0, separator).trim()] = decodeURIComponent(entry.slice(separator + 1).trim());
+  }
+  return headers;
+}
+
+function buildOtlpPayload(spans: RecordedSpan[]) {
+  return {
+    resourceSpans: [
+      {
+        resource: { attributes: toOtlpAttributes({ "service.name": SERVICE_NAME }) },
+        scopeSpans: [
+          {
+            scope: { name: SERVICE_NAME },
+            spans: spans.map((span) => ({
+              traceId: span.traceId,
+              spanId: span.spanId,
+              parentSpanId: span.parentSpanId,
+              name: span.name,
+              kind: span.kind,
+              startTimeUnixNano: `${span.startedAt}000000`,
+              endTimeUnixNano: `${span.endedAt}000000`,
+              attributes: toOtlpAttributes(span.attributes),
+              status: span.error ? { code: 2, message: span.error } : { code: 1 },
+            })),
+          },
+        ],
+      },
+    ],
+  };
+}
+
+function toOtlpAttributes(attributes: SpanAttributes) {
+  return Object.entries(attributes).map(([key, value]) => ({
+    key,
+    value:
+      typeof value === "string"
+        ? { stringValue: value }
+        : typeof value === "boolean"
+          ? { boolValue: value }
+          : Number.isInteger(value)
+            ? { intValue: String(value) }
+            : { doubleValue: value },
+  }));
+}
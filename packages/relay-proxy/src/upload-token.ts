@@ -0,0 +1,104 @@
+import { isAddress } from "viem";
+
+import { AuthError } from "./errors";
+import type { Env } from "./relay/models";
+import { resolveTenantForToken } from "./tenant";
+import {
+  authorizeRequest,
+  hmacHex,
+  parseBooleanFlag,
+  parseBoundedInteger,
+  readBearerToken,
+  timingSafeEqual,
+  verifyRequestSignature,
+} from "./utils";
+
+const UPLOAD_TOKEN_VERSION = "v1";
+
+export interface UploadAuthContext {
+  mode: "upload_token" | "shared_token" | "tenant_token" | "signed_eoa";
+  eoaAddress: string | null;
+  // Set only for tenant tokens; null is the default tenant.
+  tenant: string | null;
+}
+
+export interface UploadAuthOptions {
+  // Only the direct-upload routes set this: their bodies carry a per-request wallet signature.
+  allowSignedEOA?: boolean;
+}
+
+// Upload tokens are minted per user by the app backend so a single client can be cut off
+// (by letting its token expire) without rotating the shared RELAY_AUTH_TOKEN:
+//   v1.<lowercased_eoa>.<expiresAt unix seconds>.<hex(hmac_sha256(UPLOAD_TOKEN_SECRET, "v1.<eoa>.<expiresAt>"))>
+// The shared bearer token keeps working unless ALLOW_SHARED_UPLOAD_TOKEN is false, and the same
+// flag governs the per-app tokens in TENANT_TOKENS, which scope every image to their tenant. With
+// ALLOW_SIGNED_EOA_UPLOADS, a direct upload without any bearer token is let through here and must
+// then carry an EIP-712 ownershipProof (see assertUploadOwnership).
+export async function authorizeUploadRequest(
+  request: Request,
+  env: Env,
+  rawBody: string,
+  options: UploadAuthOptions = {}
+): Promise<UploadAuthContext> {
+  const secret = (env.UPLOAD_TOKEN_SECRET ?? "").trim();
+  const token = readBearerToken(request);
+
+  if (!token && options.allowSignedEOA && parseBooleanFlag(env.ALLOW_SIGNED_EOA_UPLOADS, false)) {
+    return { mode: "signed_eoa", eoaAddress: null, tenant: null };
+  }
+
+  if (secret && token.startsWith(`${UPLOAD_TOKEN_VERSION}.`)) {
+    return { mode: "upload_token", eoaAddress: await verifyUploadToken(token, secret, env), tenant: null };
+  }
+  if (secret && !parseBooleanFlag(env.ALLOW_SHARED_UPLOAD_TOKEN, true)) {
+    throw new AuthError("Upload token required.", "upload_token_required");
+  }
+
+  const tenant = await resolveTenantForToken(env, token);
+  if (tenant) {
+    await verifyRequestSignature(request, env, rawBody);
+    return { mode: "tenant_token", eoaAddress: null, tenant };
+  }
+
+  await authorizeRequest(request, env, rawBody);
+  return { mode: "shared_token", eoaAddress: null, tenant: null };
+}
+
+export async function createUploadToken(secret: string, eoaAddress: string, expiresAt: number): Promise<string> {
+  const payload = `${UPLOAD_TOKEN_VERSION}.${eoaAddress.toLowerCase()}.${Math.floor(expiresAt)}`;
+  return `${payload}.${await hmacHex(secret, payload)}`;
+}
+
+async function verifyUploadToken(token: string, secret: string, env: Env): Promise<string> {
+  const parts = token.split(".");
+  if (parts.length !== 4) {
+    throw new AuthError("Malformed upload token.", "invalid_upload_token");
+  }
+
+  const [version, eoaAddress, expiresAtRaw, signature] = parts;
+  const expected = await hmacHex(secret, `${version}.${eoaAddress}.${expiresAtRaw}`);
+  if (!timingSafeEqual(signature.toLowerCase(), expected)) {
+    throw new AuthError("Invalid upload token signature.", "invalid_upload_token");
+  }
+
+  if (!isAddress(eoaAddress, { strict: false })) {
+    throw new AuthError("Invalid upload token address.", "invalid_upload_token");
+  }
+
+  const expiresAt = Number(expiresAtRaw);
+  if (!Number.isSafeInteger(expiresAt)) {
+    throw new AuthError("Invalid upload token expiry.", "invalid_upload_token");
+  }
+
+  const now = Math.floor(Date.now() / 1000);
+  if (expiresAt <= now) {
+    throw new AuthError("Upload token expired.", "upload_token_expired");
+  }
+
+  const maxTtlSeconds = parseBoundedInteger(env.UPLOAD_TOKEN_MAX_TTL_SECONDS ?? "3600", 60, 86_400, 3600);
+  if (expiresAt - now > maxTtlSeconds) {
+    throw new AuthError("Upload token lifetime exceeds the allowed maximum.", "upload_token_ttl_exceeded");
+  }
+
+  return eoaAddress.toLowerCase();
+}
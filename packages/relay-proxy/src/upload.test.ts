@@ -0,0 +1,296 @@
+import { beforeEach, describe, expect, it } from "bun:test";
+import { privateKeyToAccount } from "viem/accounts";
+
+import { bindDurableObject, createDurableObjectState } from "../test/durable-object";
+import { pinata, seedPinnedFile } from "../test/pinata";
+
+import { buildUploadOwnershipMessage } from "./ownership";
+import { OwnershipLedger } from "./ownership-ledger";
+import type { Env } from "./relay/models";
+import { Tracer } from "./tracing";
+import { handleBatchDirectImageUpload, handleDirectImageUpload } from "./upload";
+import type { UploadAuthContext } from "./upload-token";
+
+// Hardhat account 2.
+const UPLOADER = privateKeyToAccount("0x5de4111afa1a4b94908f83103eb1f1706367c2e68ca870fc3fb9a804cdab365a");
+const SHARED_TOKEN: UploadAuthContext = { mode: "shared_token", eoaAddress: null, tenant: null };
+
+function uploadEnv(overrides: Partial<Env> = {}): Env {
+  return {
+    PINATA_JWT: "test-jwt",
+    PINATA_GROUP_ID: "group-avatars",
+    PINATA_GATEWAY_BASE_URL: "https://gateway.pinata.test/ipfs",
+    OWNERSHIP_LEDGER_DO: bindDurableObject(new OwnershipLedger(createDurableObjectState(), {} as Env)),
+    ...overrides,
+  } as Env;
+}
+
+async function directUpload(env: Env, body: Record<string, unknown>, auth = SHARED_TOKEN) {
+  const span = new Tracer(env, null).startSpan("test");
+  const response = await handleDirectImageUpload(JSON.stringify(body), env, auth, span);
+  return (await response.json()) as Record<string, unknown>;
+}
+
+beforeEach(() => pinata.reset());
+
+describe("direct upload ownership proofs", () => {
+  it("spends the proof only once the signed URL exists", async () => {
+    const env = uploadEnv({ REQUIRE_SIGNED_EOA: "true" });
+    const eoaAddress = UPLOADER.address.toLowerCase();
+    const issuedAt = Math.floor(Date.now() / 1000);
+    const signature = await UPLOADER.signMessage({
+      message: buildUploadOwnershipMessage(eoaAddress, "avatar.png", issuedAt),
+    });
+    const body = {
+      eoaAddress,
+      fileName: "avatar.png",
+      contentType: "image/png",
+      ownershipProof: { type: "eip191", signature, issuedAt },
+    };
+
+    pinata.failNext = new Error("pinata is down");
+    await expect(directUpload(env, body)).rejects.toMatchObject({ code: "upstream_error" });
+
+    const retried = await directUpload(env, body);
+    expect(typeof retried.uploadURL).toBe("string");
+    await expect(directUpload(env, body)).rejects.toMatchObject({ code: "ownership_proof_reused" });
+    expect(pinata.signedURLs.length).toBe(2);
+  });
+});
+
+describe("double extensions", () => {
+  const upload = (env: Env, fileName: string) =>
+    directUpload(env, { eoaAddress: UPLOADER.address.toLowerCase(), fileName, contentType: "image/png" });
+
+  it("rejects a name whose final extension is not an image when enabled", async () => {
+    const env = uploadEnv({ REJECT_DOUBLE_EXTENSION: "true" });
+    await expect(upload(env, "a.png.exe")).rejects.toMatchObject({ code: "suspicious_file_name" });
+  });
+
+  it("allows extra dots when the final extension is an image", async () => {
+    const env = uploadEnv({ REJECT_DOUBLE_EXTENSION: "true" });
+    expect(typeof (await upload(env, "a.backup.png")).uploadURL).toBe("string");
+  });
+
+  it("is off by default", async () => {
+    expect(typeof (await upload(uploadEnv(), "a.png.exe")).uploadURL).toBe("string");
+  });
+});
+
+describe("imageID random suffix", () => {
+  async function suffixLength(randomBytes?: string): Promise<number> {
+    const env = uploadEnv(randomBytes === undefined ? {} : { OBJECT_KEY_RANDOM_BYTES: randomBytes });
+    const { imageID } = await directUpload(env, {
+      eoaAddress: UPLOADER.address.toLowerCase(),
+      fileName: "avatar.png",
+      contentType: "image/png",
+    });
+    // avatars/<eoa>/<timestamp>-<suffix>-avatar.png
+    return String(imageID).split("/")[2].split("-")[1].length;
+  }
+
+  it("keeps the baseline 4 bytes by default", async () => {
+    expect(await suffixLength()).toBe(8);
+  });
+
+  it("uses OBJECT_KEY_RANDOM_BYTES within 4-16", async () => {
+    expect(await suffixLength("16")).toBe(32);
+  });
+
+  it("falls back to 4 bytes for invalid or out-of-range values", async () => {
+    for (const invalid of ["3", "17", "six", ""]) {
+      expect(await suffixLength(invalid)).toBe(8);
+    }
+  });
+});
+
+describe("upload metadata", () => {
+  const upload = (metadata: unknown) =>
+    directUpload(uploadEnv(), {
+      eoaAddress: UPLOADER.address.toLowerCase(),
+      fileName: "avatar.png",
+      contentType: "image/png",
+      metadata,
+    });
+
+  it("signs every entry into the Pinata keyvalues next to the relay's own", async () => {
+    const { imageID } = await upload({ appVersion: "2.4.1", platform: "ios", build_id: "a-17" });
+    expect(pinata.signedURLs[0].keyvalues).toEqual({
+      appVersion: "2.4.1",
+      platform: "ios",
+      build_id: "a-17",
+      owner: UPLOADER.address.toLowerCase(),
+      imageID: String(imageID),
+      source: "knot-relay",
+    });
+  });
+
+  it("rejects reserved keys so a client cannot claim another owner", async () => {
+    await expect(upload({ owner: "0x0000000000000000000000000000000000000000" })).rejects.toMatchObject({
+      code: "invalid_metadata",
+    });
+  });
+
+  it("rejects malformed keys, values and maps", async () => {
+    const tooMany = Object.fromEntries(Array.from({ length: 9 }, (_, index) => [`k${index}`, "v"]));
+    for (const metadata of [{ "a.b": "v" }, { "a b": "v" }, { note: "é" }, { note: 1 }, ["v"], tooMany]) {
+      await expect(upload(metadata)).rejects.toMatchObject({ code: "invalid_metadata" });
+    }
+    expect(pinata.signedURLs.length).toBe(0);
+  });
+});
+
+describe("requested expiry", () => {
+  const env = uploadEnv({ PINATA_SIGN_MIN_EXPIRES_SECONDS: "120", PINATA_SIGN_MAX_EXPIRES_SECONDS: "1800" });
+  const upload = (expirySeconds?: unknown) =>
+    directUpload(env, {
+      eoaAddress: UPLOADER.address.toLowerCase(),
+      fileName: "avatar.heic",
+      contentType: "image/heic",
+      expirySeconds,
+    });
+
+  it("signs the requested window when it is within bounds", async () => {
+    const response = await upload(1200);
+    expect(response.expirySeconds).toBe(1200);
+    expect(pinata.signedURLs[0].expires).toBe(1200);
+  });
+
+  it("raises a window below the minimum", async () => {
+    expect((await upload(10)).expirySeconds).toBe(120);
+  });
+
+  it("caps a window above the maximum", async () => {
+    expect((await upload(86_400)).expirySeconds).toBe(1800);
+    expect(pinata.signedURLs[0].expires).toBe(1800);
+  });
+
+  it("uses the default when none is requested and rejects non-numbers", async () => {
+    expect((await upload()).expirySeconds).toBe(180);
+    await expect(upload("600")).rejects.toMatchObject({ code: "invalid_expiry" });
+  });
+});
+
+describe("batch direct upload", () => {
+  const eoaAddress = UPLOADER.address.toLowerCase();
+
+  async function batchUpload(env: Env, uploads: unknown) {
+    const span = new Tracer(env, null).startSpan("test");
+    const response = await handleBatchDirectImageUpload(JSON.stringify({ uploads }), env, SHARED_TOKEN, span);
+    return (await response.json()) as { uploads: Record<string, unknown>[] };
+  }
+
+  it("answers each item in request order and fails only the invalid ones", async () => {
+    const { uploads } = await batchUpload(uploadEnv(), [
+      { eoaAddress, fileName: "avatar.png", contentType: "image/png" },
+      { eoaAddress, fileName: "banner.exe", contentType: "application/x-msdownload" },
+      { eoaAddress, fileName: "banner.jpg", contentType: "image/jpeg", surprise: true },
+      { eoaAddress, fileName: "banner.jpg", contentType: "image/jpeg" },
+    ]);
+
+    expect(uploads.map((upload) => upload.ok)).toEqual([true, false, false, true]);
+    expect(String(uploads[0].imageID)).toEndWith("-avatar.png");
+    expect(String(uploads[3].imageID)).toEndWith("-banner.jpg");
+    expect(pinata.signedURLs.length).toBe(2);
+  });
+
+  it("rejects an empty or oversized batch as a whole", async () => {
+    const item = { eoaAddress, fileName: "avatar.png", contentType: "image/png" };
+    await expect(batchUpload(uploadEnv(), [])).rejects.toMatchObject({ code: "invalid_payload" });
+    await expect(batchUpload(uploadEnv({ UPLOAD_BATCH_MAX_ITEMS: "2" }), [item, item, item])).rejects.toMatchObject({
+      code: "batch_too_large",
+    });
+    expect(pinata.signedURLs.length).toBe(0);
+  });
+});
+
+describe("imageID collision check", () => {
+  const upload = (env: Env) =>
+    directUpload(env, { eoaAddress: UPLOADER.address.toLowerCase(), fileName: "avatar.png", contentType: "image/png" });
+
+  // Pins a file under every imageID the upload looks up, for the first `collisions` lookups.
+  function collideOnFirst(collisions: number): string[] {
+    const lookedUp: string[] = [];
+    pinata.beforeList = ({ imageID }) => {
+      lookedUp.push(imageID);
+      if (lookedUp.length <= collisions) {
+        seedPinnedFile({ group_id: "group-avatars", keyvalues: { imageID } });
+      }
+    };
+    return lookedUp;
+  }
+
+  it("draws a fresh suffix when the first imageID is taken", async () => {
+    const lookedUp = collideOnFirst(1);
+    const { imageID } = await upload(uploadEnv({ IMAGE_ID_COLLISION_CHECK: "true" }));
+
+    expect(lookedUp.length).toBe(2);
+    expect(lookedUp[1]).not.toBe(lookedUp[0]);
+    expect(imageID).toBe(lookedUp[1]);
+    expect(pinata.signedURLs[0].keyvalues.imageID).toBe(lookedUp[1]);
+  });
+
+  it("gives up after three taken imageIDs", async () => {
+    collideOnFirst(3);
+    await expect(upload(uploadEnv({ IMAGE_ID_COLLISION_CHECK: "true" }))).rejects.toMatchObject({
+      code: "image_id_collision",
+    });
+    expect(pinata.signedURLs.length).toBe(0);
+  });
+
+  it("makes no lookup when disabled", async () => {
+    const lookedUp = collideOnFirst(1);
+    await upload(uploadEnv());
+    expect(lookedUp).toEqual([]);
+  });
+});
+
+describe("upload scopes", () => {
+  const env = uploadEnv({
+    ALLOWED_CONTENT_TYPES: "image/jpeg",
+    UPLOAD_SCOPES: JSON.stringify({ avatar: "image/*", post: "image/jpeg,image/png,image/webp" }),
+  });
+  const upload = (contentType: string, scope?: string) =>
+    directUpload(env, { eoaAddress: UPLOADER.address.toLowerCase(), fileName: "photo.heic", contentType, scope });
+
+  it("accepts HEIC for the avatar scope and tags the file with it", async () => {
+    expect(typeof (await upload("image/heic", "avatar")).uploadURL).toBe("string");
+    expect(pinata.signedURLs[0].keyvalues.scope).toBe("avatar");
+  });
+
+  it("rejects HEIC for the post scope", async () => {
+    await expect(upload("image/heic", "post")).rejects.toMatchObject({ code: "invalid_content_type" });
+  });
+
+  it("falls back to ALLOWED_CONTENT_TYPES without a scope", async () => {
+    await expect(upload("image/png")).rejects.toMatchObject({ code: "invalid_content_type" });
+    await upload("image/jpeg");
+    expect(Object.hasOwn(pinata.signedURLs[0].keyvalues, "scope")).toBe(false);
+  });
+
+  it("rejects scopes UPLOAD_SCOPES does not define", async () => {
+    await expect(upload("image/jpeg", "banner")).rejects.toMatchObject({ code: "invalid_scope" });
+  });
+});
+
+describe("upload group routes", () => {
+  const routed = (routes: Record<string, string>) => uploadEnv({ UPLOAD_GROUP_ROUTES: JSON.stringify(routes) });
+  const upload = (env: Env, fileName: string, contentType: string) =>
+    directUpload(env, { eoaAddress: UPLOADER.address.toLowerCase(), fileName, contentType });
+  const signedGroups = () => pinata.signedURLs.map((signed) => signed.groupId);
+
+  it("signs PNG and JPEG uploads into their own groups", async () => {
+    const env = routed({ "image/png": "group-png", "image/jpeg": "group-jpeg" });
+    await upload(env, "avatar.png", "image/png");
+    await upload(env, "avatar.jpg", "image/jpeg");
+    await upload(env, "avatar.webp", "image/webp");
+    expect(signedGroups()).toEqual(["group-png", "group-jpeg", "group-avatars"]);
+  });
+
+  it("lets an exact type win over image/*", async () => {
+    const env = routed({ "image/*": "group-any", "image/png": "group-png" });
+    await upload(env, "avatar.png", "image/png");
+    await upload(env, "avatar.gif", "image/gif");
+    expect(signedGroups()).toEqual(["group-png", "group-any"]);
+  });
+});
@@ -1,57 +1,468 @@
 import { PinataSDK } from "pinata";
-import { BadRequestError } from "./errors";
-import type { DirectUploadRequestModel, Env, NormalizedDirectUploadRequestModel } from "./relay/models";
+import { recordPresignAudit, toAuditIdentity } from "./audit";
+import { CircuitOpenError, withCircuitBreaker } from "./breaker";
+import { IMAGE_FILE_EXTENSIONS, RESERVED_METADATA_KEYS, UPLOAD_METADATA_MAX_ENTRIES } from "./constants";
+import { BadRequestError, ForbiddenError, ServiceUnavailableError } from "./errors";
 import {
+  CID_PLACEHOLDER,
+  buildDeliveryVariantURLs,
+  describeBrowserRendition,
+  parseDeliveryVariantNames,
+} from "./images/delivery";
+import {
+  listImageFiles,
+  resolveDeliveryMode,
+  resolveDeliveryURL,
+  resolvePinataGatewayBaseURL,
+  resolveUploadGroupID,
+} from "./images/gateway";
+import {
+  SNIFF_LENGTH_BYTES,
+  isSameImageFamily,
+  normalizeImageContentType,
+  sniffImageContentType,
+} from "./images/sniff";
+import { scheduleUploadWebhook } from "./images/webhook";
+import { recordMetric } from "./metrics";
+import { assertUploadOwnership, consumeOwnershipProof, parseOwnershipProof } from "./ownership";
+import type {
+  BatchDirectUploadItemModel,
+  BatchDirectUploadRequestModel,
+  DirectUploadRequestModel,
+  DirectUploadResponseModel,
+  Env,
+  NormalizedDirectUploadRequestModel,
+  ProxiedUploadResponseModel,
+} from "./relay/models";
+import { buildTenantKeyPrefix } from "./tenant";
+import type { Span } from "./tracing";
+import type { UploadAuthContext } from "./upload-token";
+import {
+  assertJsonObject,
+  clampInteger,
   jsonResponse,
   normalizeAddress,
+  parseBooleanFlag,
   parseBoundedInteger,
+  parseJsonObject,
   randomHex,
+  readRequestBytes,
   resolveRequiredEnvValue,
   sanitizeFileName,
 } from "./utils";
 
-export async function handleDirectImageUpload(rawBody: string, env: Env): Promise<Response> {
-  const body = parseDirectUploadRequest(rawBody);
-  const uploadURL = await createPinataSignedUploadURL(body, env);
-  const gatewayBaseURL = resolvePinataGatewayBaseURL(env);
+const IMAGE_ID_MAX_ATTEMPTS = 3;
+const UPLOAD_SCOPE_PATTERN = /^[a-z0-9_-]{1,32}$/;
+
+export async function handleDirectImageUpload(
+  rawBody: string,
+  env: Env,
+  auth: UploadAuthContext,
+  span: Span
+): Promise<Response> {
+  span.setAttribute("upload.auth_mode", auth.mode);
+  const upload = await createDirectUpload(
+    () => parseJsonObject(rawBody, DIRECT_UPLOAD_FIELDS, "direct upload"),
+    env,
+    auth,
+    span
+  );
+  return jsonResponse({ ok: true, ...upload });
+}
+
+// Signs every item independently under one auth check. Invalid items become per-item error
+// entries in request order instead of failing the whole batch.
+export async function handleBatchDirectImageUpload(
+  rawBody: string,
+  env: Env,
+  auth: UploadAuthContext,
+  span: Span
+): Promise<Response> {
+  span.setAttribute("upload.auth_mode", auth.mode);
+  const items = parseBatchDirectUploadRequest(rawBody, env);
+  span.setAttribute("upload.batch_size", items.length);
 
-  return jsonResponse({
-    ok: true,
-    uploadURL,
-    imageID: body.imageID,
-    gatewayBaseURL,
-  });
+  const uploads = await Promise.all(
+    items.map((item, index) =>
+      span.run("upload.batch_item", { "upload.batch_index": index }, async (itemSpan) => {
+        try {
+          const upload = await createDirectUpload(
+            () => assertJsonObject(item, DIRECT_UPLOAD_FIELDS, `direct upload item ${index}`),
+            env,
+            auth,
+            itemSpan
+          );
+          return { ok: true, ...upload } satisfies BatchDirectUploadItemModel;
+        } catch (error) {
+          if (error instanceof BadRequestError || error instanceof ForbiddenError) {
+            const failure = { ok: false, error: { code: error.code, message: error.message } };
+            return failure satisfies BatchDirectUploadItemModel;
+          }
+          throw error;
+        }
+      })
+    )
+  );
+
+  return jsonResponse({ ok: true, uploads });
 }
 
-function parseDirectUploadRequest(rawBody: string): NormalizedDirectUploadRequestModel {
-  let payload: unknown;
+// Fallback for networks that block the browser's direct PUT to Pinata: the worker takes the raw
+// image body and pins it itself. `eoaAddress` and `fileName` come from the query string and the
+// declared type from Content-Type. The body is rejected on its magic bytes as soon as they
+// arrive, so a verified upload needs no separate verify call.
+export async function handleProxiedImageUpload(
+  request: Request,
+  url: URL,
+  env: Env,
+  ctx: ExecutionContext,
+  auth: UploadAuthContext,
+  span: Span
+): Promise<Response> {
+  span.setAttribute("upload.auth_mode", auth.mode);
+  if (!parseBooleanFlag(env.PROXY_UPLOAD_ENABLED, false)) {
+    throw new BadRequestError("Proxied uploads are not enabled.", "proxy_upload_disabled");
+  }
+
   try {
-    payload = JSON.parse(rawBody);
-  } catch {
-    throw new BadRequestError("Invalid JSON body.");
+    const normalized = normalizeDirectUploadRequest(
+      {
+        eoaAddress: url.searchParams.get("eoaAddress") ?? "",
+        fileName: url.searchParams.get("fileName") ?? "",
+        contentType: request.headers.get("Content-Type") ?? "",
+        scope: url.searchParams.get("scope") ?? undefined,
+      },
+      env,
+      auth.tenant
+    );
+    span.setAttribute("upload.key_prefix", buildImageKeyPrefix(normalized.eoaAddress, normalized.tenant));
+    const proof = await assertUploadOwnership(normalized, auth, env);
+
+    const bytes = await readRequestBytes(request, resolveUploadLimits(env).maxFileSize, {
+      headLength: SNIFF_LENGTH_BYTES,
+      onHead: (head) => assertDeclaredImageType(head, normalized.contentType),
+    });
+    if (bytes.byteLength === 0) {
+      throw new BadRequestError("Request body is empty.", "empty_body");
+    }
+
+    const body = { ...normalized, imageID: await resolveUniqueImageID(normalized, env) };
+    // Spent before pinning rather than after: a replay that raced this request would otherwise
+    // leave a second pinned file behind once its consume failed. A rejected body does not spend it.
+    if (proof) {
+      await consumeOwnershipProof(env, normalized.eoaAddress, proof);
+    }
+    const cid = await span.run(
+      "pinata.upload_file",
+      { "upload.content_type": body.contentType, "upload.size_bytes": bytes.byteLength },
+      () => uploadPinataFile(body, bytes, env)
+    );
+    const delivery = await resolveDeliveryURL(env, cid, { identity: toAuditIdentity(auth), imageID: body.imageID });
+    scheduleUploadWebhook(env, ctx, cid, body.contentType);
+
+    span.setAttribute("upload.result", "ok");
+    recordMetric(env, "direct_upload_requests_total", { result: "ok", route: "proxy" });
+    return jsonResponse({
+      ok: true,
+      imageID: body.imageID,
+      cid,
+      deliveryURL: delivery.url,
+      deliveryURLExpiresAt: delivery.expiresAt,
+      variants: buildDeliveryVariantURLs(env, cid, body.variants),
+      ...describeBrowserRendition(env, cid, body.contentType),
+      size: bytes.byteLength,
+      contentType: body.contentType,
+    } satisfies { ok: true } & ProxiedUploadResponseModel);
+  } catch (error) {
+    const result = error instanceof BadRequestError || error instanceof ForbiddenError ? "rejected" : "error";
+    span.setAttribute("upload.result", result);
+    recordMetric(env, "direct_upload_requests_total", { result, route: "proxy" });
+    throw error;
+  }
+}
+
+function assertDeclaredImageType(head: Uint8Array, declared: string): void {
+  const detected = sniffImageContentType(head);
+  if (!detected || !isSameImageFamily(declared, detected)) {
+    throw new BadRequestError(
+      `Body does not look like ${declared} (detected ${detected ?? "unknown"}).`,
+      "content_type_mismatch"
+    );
+  }
+}
+
+async function createDirectUpload(
+  readRequest: () => Record<string, unknown>,
+  env: Env,
+  auth: UploadAuthContext,
+  span: Span
+): Promise<DirectUploadResponseModel> {
+  try {
+    const request = normalizeDirectUploadRequest(readRequest(), env, auth.tenant);
+    span.setAttribute("upload.key_prefix", buildImageKeyPrefix(request.eoaAddress, request.tenant));
+    const proof = await assertUploadOwnership(request, auth, env);
+    const body = { ...request, imageID: await resolveUniqueImageID(request, env) };
+    const uploadURL = await span.run(
+      "pinata.create_signed_url",
+      { "upload.content_type": body.contentType, "upload.expiry_seconds": body.expirySeconds },
+      () => createPinataSignedUploadURL(body, env)
+    );
+    // A replay that raced this request also got a URL, but only one consume succeeds, so only
+    // one of the two URLs is ever returned.
+    if (proof) {
+      await consumeOwnershipProof(env, request.eoaAddress, proof);
+    }
+    const expiresAt = new Date(Date.now() + body.expirySeconds * 1000).toISOString();
+    recordPresignAudit(env, {
+      identity: toAuditIdentity(auth),
+      method: "POST",
+      imageID: body.imageID,
+      cid: null,
+      expiresAt,
+    });
+    const gatewayBaseURL = resolvePinataGatewayBaseURL(env);
+
+    span.setAttribute("upload.result", "ok");
+    recordMetric(env, "direct_upload_requests_total", { result: "ok" });
+    return {
+      uploadURL,
+      imageID: body.imageID,
+      gatewayBaseURL,
+      deliveryMode: resolveDeliveryMode(env),
+      variants: buildDeliveryVariantURLs(env, CID_PLACEHOLDER, body.variants),
+      ...describeBrowserRendition(env, CID_PLACEHOLDER, body.contentType),
+      expirySeconds: body.expirySeconds,
+      expiresAt,
+    };
+  } catch (error) {
+    const result = error instanceof BadRequestError || error instanceof ForbiddenError ? "rejected" : "error";
+    span.setAttribute("upload.result", result);
+    recordMetric(env, "direct_upload_requests_total", { result });
+    throw error;
+  }
+}
+
+const DIRECT_UPLOAD_FIELDS = [
+  "eoaAddress",
+  "fileName",
+  "contentType",
+  "expirySeconds",
+  "metadata",
+  "ownershipProof",
+  "variants",
+  "scope",
+] as const satisfies readonly (keyof DirectUploadRequestModel)[];
+
+function parseBatchDirectUploadRequest(rawBody: string, env: Env): unknown[] {
+  const request = parseJsonObject(
+    rawBody,
+    ["uploads"],
+    "batch direct upload"
+  ) as Partial<BatchDirectUploadRequestModel>;
+  if (!Array.isArray(request.uploads) || request.uploads.length === 0) {
+    throw new BadRequestError("uploads must be a non-empty array.", "invalid_payload");
+  }
+
+  const maxItems = resolveBatchUploadMaxItems(env);
+  if (request.uploads.length > maxItems) {
+    throw new BadRequestError(`A batch may contain at most ${maxItems} uploads.`, "batch_too_large");
   }
+  return request.uploads;
+}
 
-  if (!payload || typeof payload !== "object") {
-    throw new BadRequestError("Invalid direct upload payload.");
+// FILE_NAME_MAX_LENGTH stays at or above 32 so a truncated stem always has room next to its extension.
+function resolveFileNameLengths(env: Env): { minLength: number; maxLength: number } {
+  const maxLength = parseBoundedInteger(env.FILE_NAME_MAX_LENGTH ?? "120", 32, 255, 120);
+  const minLength = Math.min(maxLength, parseBoundedInteger(env.FILE_NAME_MIN_LENGTH ?? "1", 1, 255, 1));
+  return { minLength, maxLength };
+}
+
+// FILENAME_UNICODE_MODE is `ascii` (the default) or `unicode`; see sanitizeFileName.
+function resolveUnicodeFileNames(env: Env): boolean {
+  const mode = (env.FILENAME_UNICODE_MODE ?? "").trim().toLowerCase();
+  if (mode === "" || mode === "ascii") {
+    return false;
   }
+  if (mode === "unicode") {
+    return true;
+  }
+  throw new ServiceUnavailableError("FILENAME_UNICODE_MODE must be ascii or unicode.", "invalid_config");
+}
 
+export function resolveBatchUploadMaxItems(env: Env): number {
+  return parseBoundedInteger(env.UPLOAD_BATCH_MAX_ITEMS ?? "5", 1, 20, 5);
+}
+
+function normalizeDirectUploadRequest(
+  payload: Record<string, unknown>,
+  env: Env,
+  tenant: string | null
+): NormalizedDirectUploadRequestModel {
   const request = payload as Partial<DirectUploadRequestModel>;
   const eoaAddress = normalizeAddress(String(request.eoaAddress ?? ""));
-  const fileName = sanitizeFileName(String(request.fileName ?? ""));
-  if (!fileName) {
-    throw new BadRequestError("Invalid fileName.");
+  const { minLength, maxLength } = resolveFileNameLengths(env);
+  const fileName = sanitizeFileName(String(request.fileName ?? ""), maxLength, resolveUnicodeFileNames(env));
+  if (Array.from(fileName).length < minLength) {
+    throw new BadRequestError(
+      `fileName must be at least ${minLength} characters after sanitizing.`,
+      "invalid_file_name"
+    );
+  }
+  if (parseBooleanFlag(env.REJECT_DOUBLE_EXTENSION, false) && hasSuspiciousDoubleExtension(fileName)) {
+    throw new BadRequestError(
+      "Suspicious fileName: multiple extensions must end in an image extension.",
+      "suspicious_file_name"
+    );
   }
 
-  const contentType = String(request.contentType ?? "").trim().toLowerCase();
+  const contentType = normalizeImageContentType(String(request.contentType ?? ""));
   if (!contentType.startsWith("image/")) {
-    throw new BadRequestError("Only image uploads are allowed.");
+    throw new BadRequestError("Only image uploads are allowed.", "invalid_content_type");
+  }
+  const scope = parseUploadScope(request.scope, env);
+  const allowed = scope === null ? resolveAllowedContentTypes(env) : resolveUploadScopes(env)[scope];
+  if (!isContentTypeAllowed(contentType, allowed)) {
+    const target = scope === null ? "" : ` for scope ${scope}`;
+    throw new BadRequestError(`Content type ${contentType} is not allowed${target}.`, "invalid_content_type");
   }
 
   return {
     eoaAddress,
     fileName,
     contentType,
-    imageID: buildImageID(eoaAddress, fileName),
+    expirySeconds: resolveRequestedExpiry(request.expirySeconds, env),
+    metadata: parseUploadMetadata(request.metadata),
+    ownershipProof: parseOwnershipProof(request.ownershipProof, String(request.fileName ?? "")),
+    variants: parseDeliveryVariantNames(request.variants, env),
+    scope,
+    tenant,
+    imageID: buildImageID(eoaAddress, fileName, tenant, env),
+  };
+}
+
+// ALLOWED_CONTENT_TYPES is a comma-separated allowlist; `image/*` (the default) accepts any image type.
+export function resolveAllowedContentTypes(env: Env): string[] {
+  return parseContentTypeList(env.ALLOWED_CONTENT_TYPES ?? "", "ALLOWED_CONTENT_TYPES");
+}
+
+// UPLOAD_SCOPES gives each upload purpose its own allowlist, as a JSON object of scope name to
+// the same comma-separated format, e.g. {"avatar":"image/*","post":"image/jpeg,image/png"}.
+export function resolveUploadScopes(env: Env): Record<string, string[]> {
+  const raw = (env.UPLOAD_SCOPES ?? "").trim();
+  if (!raw) {
+    return {};
+  }
+
+  let parsed: unknown;
+  try {
+    parsed = JSON.parse(raw);
+  } catch {
+    throw new ServiceUnavailableError("Invalid UPLOAD_SCOPES: expected a JSON object.", "invalid_config");
+  }
+  if (!parsed || typeof parsed !== "object" || Array.isArray(parsed)) {
+    throw new ServiceUnavailableError("Invalid UPLOAD_SCOPES: expected a JSON object.", "invalid_config");
+  }
+
+  const scopes: Record<string, string[]> = {};
+  for (const [name, value] of Object.entries(parsed)) {
+    if (!UPLOAD_SCOPE_PATTERN.test(name) || typeof value !== "string") {
+      throw new ServiceUnavailableError(`Invalid UPLOAD_SCOPES entry: ${name}`, "invalid_config");
+    }
+    scopes[name] = parseContentTypeList(value, `UPLOAD_SCOPES.${name}`);
+  }
+  return scopes;
+}
+
+function parseContentTypeList(raw: string, label: string): string[] {
+  const types = new Set<string>();
+  for (const entry of raw.split(",")) {
+    const contentType = normalizeImageContentType(entry);
+    if (!contentType) {
+      continue;
+    }
+    if (!contentType.startsWith("image/")) {
+      throw new ServiceUnavailableError(`Invalid ${label} entry: ${contentType}`, "invalid_config");
+    }
+    types.add(contentType);
+  }
+  return types.size > 0 ? [...types] : ["image/*"];
+}
+
+// Requests without `scope` use ALLOWED_CONTENT_TYPES; a scope must be one UPLOAD_SCOPES defines.
+function parseUploadScope(value: unknown, env: Env): string | null {
+  if (value === undefined || value === null) {
+    return null;
+  }
+  const scope = typeof value === "string" ? value.trim() : "";
+  if (!Object.hasOwn(resolveUploadScopes(env), scope)) {
+    throw new BadRequestError(`Unknown upload scope: ${scope || String(value)}`, "invalid_scope");
+  }
+  return scope;
+}
+
+function isContentTypeAllowed(contentType: string, allowed: readonly string[]): boolean {
+  return allowed.includes("image/*") || allowed.includes(contentType);
+}
+
+// Clients may ask for a longer (or shorter) upload window, but never outside the server's bounds.
+function resolveRequestedExpiry(value: unknown, env: Env): number {
+  const limits = resolveUploadLimits(env);
+  if (value === undefined || value === null) {
+    return limits.expiresSeconds;
+  }
+  if (typeof value !== "number" || !Number.isFinite(value)) {
+    throw new BadRequestError("expirySeconds must be a number.", "invalid_expiry");
+  }
+  return clampInteger(value, limits.minExpiresSeconds, limits.maxExpiresSeconds);
+}
+
+function parseUploadMetadata(value: unknown): Record<string, string> {
+  if (value === undefined || value === null) {
+    return {};
+  }
+  if (typeof value !== "object" || Array.isArray(value)) {
+    throw new BadRequestError("metadata must be an object of string values.", "invalid_metadata");
+  }
+
+  const entries = Object.entries(value);
+  if (entries.length > UPLOAD_METADATA_MAX_ENTRIES) {
+    throw new BadRequestError(`metadata supports at most ${UPLOAD_METADATA_MAX_ENTRIES} entries.`, "invalid_metadata");
+  }
+
+  const metadata: Record<string, string> = {};
+  for (const [key, raw] of entries) {
+    if (!/^[A-Za-z0-9_-]{1,64}$/.test(key)) {
+      throw new BadRequestError(`Invalid metadata key: ${key}`, "invalid_metadata");
+    }
+    if (RESERVED_METADATA_KEYS.has(key)) {
+      throw new BadRequestError(`Reserved metadata key: ${key}`, "invalid_metadata");
+    }
+    if (typeof raw !== "string" || raw.length > 256 || !/^[\x20-\x7e]*$/.test(raw)) {
+      throw new BadRequestError(`Invalid metadata value for key: ${key}`, "invalid_metadata");
+    }
+    metadata[key] = raw;
+  }
+  return metadata;
+}
+
+export function resolveUploadLimits(env: Env): {
+  expiresSeconds: number;
+  minExpiresSeconds: number;
+  maxExpiresSeconds: number;
+  maxFileSize: number;
+} {
+  const minExpiresSeconds = parseBoundedInteger(env.PINATA_SIGN_MIN_EXPIRES_SECONDS ?? "60", 30, 3600, 60);
+  const maxExpiresSeconds = Math.max(
+    minExpiresSeconds,
+    parseBoundedInteger(env.PINATA_SIGN_MAX_EXPIRES_SECONDS ?? "900", 60, 86_400, 900)
+  );
+  const defaultExpiresSeconds = parseBoundedInteger(env.PINATA_SIGN_EXPIRES_SECONDS ?? "180", 60, 900, 180);
+
+  return {
+    expiresSeconds: clampInteger(defaultExpiresSeconds, minExpiresSeconds, maxExpiresSeconds),
+    minExpiresSeconds,
+    maxExpiresSeconds,
+    maxFileSize: parseBoundedInteger(env.PINATA_MAX_FILE_SIZE_BYTES ?? "10485760", 1024, 25_000_000, 10_485_760),
   };
 }
 
@@ -60,49 +471,149 @@ async function createPinataSignedUploadURL(
   env: Env
 ): Promise<string> {
   const jwt = resolveRequiredEnvValue(env.PINATA_JWT, "PINATA_JWT");
-  const expiresSeconds = parseBoundedInteger(env.PINATA_SIGN_EXPIRES_SECONDS ?? "180", 60, 900, 180);
-  const maxFileSize = parseBoundedInteger(env.PINATA_MAX_FILE_SIZE_BYTES ?? "10485760", 1024, 25_000_000, 10_485_760);
-  const groupID = resolveRequiredEnvValue(env.PINATA_GROUP_ID, "PINATA_GROUP_ID");
+  const { maxFileSize } = resolveUploadLimits(env);
+  const groupID = resolveUploadGroupID(env, payload.contentType);
 
   const pinata = new PinataSDK({ pinataJwt: jwt });
+  const uploads = resolveDeliveryMode(env) === "signed" ? pinata.upload.private : pinata.upload.public;
 
   try {
-    const signedUrl = await pinata.upload.public.createSignedURL({
-      expires: expiresSeconds,
-      name: payload.fileName,
-      groupId: groupID,
-      maxFileSize: maxFileSize,
-      keyvalues: {
-        owner: payload.eoaAddress,
-        imageID: payload.imageID,
-        source: "knot-relay",
-      },
-    });
+    const signedUrl = await withCircuitBreaker(env, "pinata_api", async () =>
+      uploads.createSignedURL({
+        expires: payload.expirySeconds,
+        name: payload.fileName,
+        groupId: groupID,
+        maxFileSize: maxFileSize,
+        keyvalues: buildPinataKeyvalues(payload),
+      })
+    );
 
     if (typeof signedUrl !== "string" || signedUrl.trim() === "") {
-      throw new BadRequestError("Pinata SDK returned missing or invalid signed URL.");
+      throw new BadRequestError("Pinata SDK returned missing or invalid signed URL.", "upstream_error");
     }
 
     return signedUrl.trim();
   } catch (err: unknown) {
-    throw new BadRequestError(`Pinata signed URL request failed: ${err instanceof Error ? err.message : String(err)}`);
+    if (err instanceof CircuitOpenError) {
+      throw err;
+    }
+    throw new BadRequestError(
+      `Pinata signed URL request failed: ${err instanceof Error ? err.message : String(err)}`,
+      "upstream_error"
+    );
   }
 }
 
-function resolvePinataGatewayBaseURL(env: Env): string {
-  const raw = resolveRequiredEnvValue(env.PINATA_GATEWAY_BASE_URL, "PINATA_GATEWAY_BASE_URL")
-    .trim()
-    .replace(/\/+$/, "");
+async function uploadPinataFile(
+  payload: NormalizedDirectUploadRequestModel,
+  bytes: Uint8Array,
+  env: Env
+): Promise<string> {
+  const jwt = resolveRequiredEnvValue(env.PINATA_JWT, "PINATA_JWT");
+  const groupID = resolveUploadGroupID(env, payload.contentType);
+  const pinata = new PinataSDK({ pinataJwt: jwt });
+  const uploads = resolveDeliveryMode(env) === "signed" ? pinata.upload.private : pinata.upload.public;
+  const file = new File([bytes], payload.fileName, { type: payload.contentType });
+
   try {
-    const parsed = new URL(raw);
-    return `${parsed.origin}/ipfs`;
-  } catch {
-    throw new BadRequestError("Invalid PINATA_GATEWAY_BASE_URL.");
+    const result = await withCircuitBreaker(env, "pinata_api", async () =>
+      uploads
+        .file(file)
+        .group(groupID)
+        .keyvalues(buildPinataKeyvalues(payload))
+    );
+    return result.cid;
+  } catch (err: unknown) {
+    if (err instanceof CircuitOpenError) {
+      throw err;
+    }
+    throw new BadRequestError(
+      `Pinata upload failed: ${err instanceof Error ? err.message : String(err)}`,
+      "upstream_error"
+    );
+  }
+}
+
+// `scope` and `tenant` are only attached when set, so other files keep their original keyvalues.
+function buildPinataKeyvalues(payload: NormalizedDirectUploadRequestModel): Record<string, string> {
+  return {
+    ...payload.metadata,
+    owner: payload.eoaAddress,
+    imageID: payload.imageID,
+    source: "knot-relay",
+    ...(payload.scope ? { scope: payload.scope } : {}),
+    ...(payload.tenant ? { tenant: payload.tenant } : {}),
+  };
+}
+
+// `avatar.png.exe` is rejected while `avatar.backup.png` is allowed: only the final extension decides.
+function hasSuspiciousDoubleExtension(fileName: string): boolean {
+  const segments = fileName.replace(/^\.+/, "").split(".");
+  if (segments.length <= 2) {
+    return false;
   }
+  const finalExtension = segments[segments.length - 1].toLowerCase();
+  return !IMAGE_FILE_EXTENSIONS.has(finalExtension);
 }
 
-function buildImageID(eoaAddress: string, fileName: string): string {
-  const timestamp = new Date().toISOString().replace(/[-:.TZ]/g, "");
-  const randomSuffix = randomHex(4);
-  return `avatars/${eoaAddress}/${timestamp}-${randomSuffix}-${fileName}`;
+// With IMAGE_ID_COLLISION_CHECK, confirm no pinned file already carries the imageID and draw a
+// fresh random suffix if one does. Pinata only lists completed uploads, so this guards stored
+// images, not other signed URLs that are still unused.
+async function resolveUniqueImageID(payload: NormalizedDirectUploadRequestModel, env: Env): Promise<string> {
+  if (!parseBooleanFlag(env.IMAGE_ID_COLLISION_CHECK, false)) {
+    return payload.imageID;
+  }
+
+  const jwt = resolveRequiredEnvValue(env.PINATA_JWT, "PINATA_JWT");
+  const pinata = new PinataSDK({ pinataJwt: jwt });
+
+  let imageID = payload.imageID;
+  for (let attempt = 1; attempt <= IMAGE_ID_MAX_ATTEMPTS; attempt += 1) {
+    let existing: number;
+    try {
+      const { query, inImageGroups } = listImageFiles(pinata, env);
+      const result = await withCircuitBreaker(env, "pinata_api", async () => query.keyvalues({ imageID }).limit(1));
+      existing = result.files.filter(inImageGroups).length;
+    } catch (err: unknown) {
+      if (err instanceof CircuitOpenError) {
+        throw err;
+      }
+      throw new BadRequestError(
+        `Pinata file lookup failed: ${err instanceof Error ? err.message : String(err)}`,
+        "upstream_error"
+      );
+    }
+    if (existing === 0) {
+      return imageID;
+    }
+    console.warn(`imageID collision on ${imageID} (attempt ${attempt}); regenerating`);
+    imageID = buildImageID(payload.eoaAddress, payload.fileName, payload.tenant, env);
+  }
+  throw new ServiceUnavailableError("Could not allocate a unique imageID.", "image_id_collision");
+}
+
+// OBJECT_KEY_RANDOM_BYTES widens the random suffix for high-volume deployments; the default
+// keeps existing imageIDs' shape.
+function buildImageID(eoaAddress: string, fileName: string, tenant: string | null, env: Env): string {
+  const timestamp = formatImageIDTimestamp(new Date(), env.OBJECT_KEY_TIME_FORMAT);
+  const randomSuffix = randomHex(parseBoundedInteger(env.OBJECT_KEY_RANDOM_BYTES ?? "4", 4, 16, 4));
+  return `${buildImageKeyPrefix(eoaAddress, tenant)}/${timestamp}-${randomSuffix}-${fileName}`;
+}
+
+function buildImageKeyPrefix(eoaAddress: string, tenant: string | null): string {
+  return `${buildTenantKeyPrefix(tenant)}avatars/${eoaAddress}`;
+}
+
+// Every format is fixed-width UTC and uses only [0-9A-Z-], so image IDs under one EOA
+// sort chronologically when listed. Unknown values fall back to `compact`.
+function formatImageIDTimestamp(date: Date, format: string | undefined): string {
+  const iso = date.toISOString();
+  switch ((format ?? "").trim().toLowerCase()) {
+    case "epoch":
+      return String(Math.floor(date.getTime() / 1000)).padStart(10, "0");
+    case "rfc3339":
+      return iso.replace(/\.\d{3}Z$/, "Z").replace(/:/g, "-");
+    default:
+      return iso.replace(/[-:.TZ]/g, "");
+  }
 }
@@ -0,0 +1,81 @@
+import { describe, expect, it } from "bun:test";
+
+import { ServiceUnavailableError } from "./errors";
+import type { Env } from "./relay/models";
+import { randomHex, readRequestBody, resolveCorsPolicy, sanitizeFileName } from "./utils";
+
+describe("sanitizeFileName", () => {
+  it("reduces names to a safe ASCII set", () => {
+    expect(sanitizeFileName("  my photo (1).PNG ")).toBe("my-photo-1-.PNG");
+    expect(sanitizeFileName("../../etc/passwd")).toBe("etc-passwd");
+  });
+
+  it("truncates the stem but keeps the extension", () => {
+    expect(sanitizeFileName(`${"a".repeat(30)}.jpeg`, 12)).toBe("aaaaaaa.jpeg");
+  });
+
+  it("falls back to a file stem when every stem character is replaced", () => {
+    expect(sanitizeFileName("アバター.png")).toBe("file.png");
+    expect(sanitizeFileName("😀.png", 120, true)).toBe("file.png");
+  });
+
+  it("keeps letters from any script in unicode mode", () => {
+    expect(sanitizeFileName("アバター.png", 120, true)).toBe("アバター.png");
+    expect(sanitizeFileName("avatar😀.png", 120, true)).toBe("avatar-.png");
+  });
+
+  it("counts code points when truncating in unicode mode", () => {
+    expect(sanitizeFileName("日本語のファイル名.png", 8, true)).toBe("日本語の.png");
+  });
+});
+
+describe("randomHex", () => {
+  it("hex-encodes the requested number of bytes", () => {
+    for (const bytes of [4, 6, 16]) {
+      expect(randomHex(bytes)).toMatch(new RegExp(`^[0-9a-f]{${bytes * 2}}$`));
+    }
+  });
+});
+
+describe("resolveCorsPolicy", () => {
+  const env = (vars: Partial<Env>) => vars as Env;
+
+  it("keeps the wildcard by default and for an explicit `*`", () => {
+    expect(resolveCorsPolicy(env({})).allowedOrigins).toBeNull();
+    expect(resolveCorsPolicy(env({ CORS_ALLOWED_ORIGINS: "*" })).allowedOrigins).toBeNull();
+  });
+
+  it("normalizes listed origins", () => {
+    const policy = resolveCorsPolicy(
+      env({ CORS_ALLOWED_ORIGINS: "https://App.knot.fi/, https://admin.knot.fi", CORS_ALLOW_CREDENTIALS: "true" })
+    );
+    expect(policy.allowedOrigins).toEqual(new Set(["https://app.knot.fi", "https://admin.knot.fi"]));
+    expect(policy.allowCredentials).toBe(true);
+  });
+
+  it("rejects credentials with the wildcard", () => {
+    expect(() => resolveCorsPolicy(env({ CORS_ALLOW_CREDENTIALS: "true" }))).toThrow(ServiceUnavailableError);
+    expect(() => resolveCorsPolicy(env({ CORS_ALLOWED_ORIGINS: "*", CORS_ALLOW_CREDENTIALS: "true" }))).toThrow(
+      ServiceUnavailableError
+    );
+  });
+
+  it("rejects entries that are not bare origins", () => {
+    expect(() => resolveCorsPolicy(env({ CORS_ALLOWED_ORIGINS: "https://app.knot.fi/login" }))).toThrow(
+      ServiceUnavailableError
+    );
+  });
+});
+
+describe("readRequestBody", () => {
+  const env = { MAX_REQUEST_BODY_BYTES: "2048" } as Env;
+  const post = (body: string) => new Request("https://relay.test/", { method: "POST", body });
+
+  it("returns a body within MAX_REQUEST_BODY_BYTES", async () => {
+    await expect(readRequestBody(post("x".repeat(2048)), env)).resolves.toBe("x".repeat(2048));
+  });
+
+  it("rejects a body one byte over the limit", async () => {
+    await expect(readRequestBody(post("x".repeat(2049)), env)).rejects.toMatchObject({ code: "payload_too_large" });
+  });
+});
@@ -1,7 +1,7 @@
 import { bytesToHex, getAddress, isAddress } from "viem";
 
 import { JSON_HEADERS } from "./constants";
-import { AuthError, BadRequestError } from "./errors";
+import { AuthError, BadRequestError, PayloadTooLargeError, ServiceUnavailableError } from "./errors";
 import type { Env } from "./relay/models";
 
 export function normalizeHostname(hostname: string): string {
@@ -12,17 +12,27 @@ export function isRouteAllowedForHostname(hostname: string, method: string, path
   const upperMethod = method.toUpperCase();
 
   if (hostname === "upload.knot.fi") {
-    if (path === "/health") {
+    if (path === "/health" || path === "/ready" || path === "/v1/capabilities" || path === "/v1/images") {
       return upperMethod === "GET" || upperMethod === "OPTIONS";
     }
-    if (path === "/v1/images/direct-upload") {
+    if (
+      path === "/v1/images/direct-upload" ||
+      path === "/v1/images/direct-upload/batch" ||
+      path === "/v1/images/upload" ||
+      path === "/v1/images/verify" ||
+      path === "/v1/images/validate-dimensions" ||
+      /^\/v1\/images\/.+\/(revoke|inspect)$/.test(path)
+    ) {
       return upperMethod === "POST" || upperMethod === "OPTIONS";
     }
+    if (/^\/v1\/images\/(?:[^/]*%2F)?avatars%2F[^/]+$/i.test(path)) {
+      return upperMethod === "GET" || upperMethod === "OPTIONS";
+    }
     return false;
   }
 
   if (hostname === "relay.knot.fi") {
-    if (path === "/v1/images/direct-upload") {
+    if (path === "/v1/images" || path.startsWith("/v1/images/")) {
       return false;
     }
     return true;
@@ -35,18 +45,91 @@ export function isRouteAllowedForHostname(hostname: string, method: string, path
 export function resolveRequiredEnvValue(value: string | undefined, name: string): string {
   const trimmed = (value ?? "").trim();
   if (!trimmed) {
-    throw new BadRequestError(`Missing required env var: ${name}`);
+    throw new ServiceUnavailableError(`Missing required env var: ${name}`, "missing_config");
   }
   return trimmed;
 }
 
-export function sanitizeFileName(value: string): string {
-  const normalized = value
+export function parseBooleanFlag(value: string | undefined, fallback: boolean): boolean {
+  const normalized = (value ?? "").trim().toLowerCase();
+  if (normalized === "true" || normalized === "1" || normalized === "yes") {
+    return true;
+  }
+  if (normalized === "false" || normalized === "0" || normalized === "no") {
+    return false;
+  }
+  return fallback;
+}
+
+// Parses a JSON request body that must be a single object with only `allowedFields`,
+// so typos such as `eoaAdress` fail loudly instead of surfacing as a missing field.
+export function parseJsonObject(
+  rawBody: string,
+  allowedFields: readonly string[],
+  label: string
+): Record<string, unknown> {
+  if (rawBody.trim() === "") {
+    throw new BadRequestError("Request body is empty.", "empty_body");
+  }
+
+  let payload: unknown;
+  try {
+    payload = JSON.parse(rawBody);
+  } catch (error) {
+    const reason = error instanceof Error ? error.message : "syntax error";
+    throw new BadRequestError(`Invalid JSON body: ${reason}`, "invalid_json");
+  }
+
+  return assertJsonObject(payload, allowedFields, label);
+}
+
+// The object half of `parseJsonObject`, for payloads nested inside an already-parsed body.
+export function assertJsonObject(
+  payload: unknown,
+  allowedFields: readonly string[],
+  label: string
+): Record<string, unknown> {
+  if (!payload || typeof payload !== "object" || Array.isArray(payload)) {
+    throw new BadRequestError(`Invalid ${label} payload: expected a JSON object.`, "invalid_payload");
+  }
+
+  const unknownField = Object.keys(payload).find((field) => !allowedFields.includes(field));
+  if (unknownField !== undefined) {
+    throw new BadRequestError(`Unknown field in ${label} payload: ${unknownField}`, "unknown_field");
+  }
+  return payload as Record<string, unknown>;
+}
+
+const MAX_FILE_EXTENSION_LENGTH = 16;
+
+// Reduces a client file name to [A-Za-z0-9._-] with single dashes and no leading or trailing
+// dots/dashes. Over-long names lose the end of the stem, never the extension.
+// With `unicode`, letters, digits and combining marks from any script survive (NFC-normalized), so
+// a Japanese or Arabic name is kept instead of collapsing to dashes. Control characters, path
+// separators, whitespace and symbols such as emoji are still replaced in both modes. Lengths are
+// counted in code points so truncation never splits a character.
+export function sanitizeFileName(value: string, maxLength = 120, unicode = false): string {
+  const disallowed = unicode ? /[^\p{L}\p{N}\p{M}._-]/gu : /[^a-zA-Z0-9._-]/g;
+  const collapsed = (unicode ? value.normalize("NFC") : value)
     .trim()
-    .replace(/[^a-zA-Z0-9._-]/g, "-")
-    .replace(/-+/g, "-")
-    .replace(/^-+|-+$/g, "");
-  return normalized.slice(0, 120);
+    .replace(disallowed, "-")
+    .replace(/-+/g, "-");
+  // A stem made only of replaced characters (e.g. "アバター" in ASCII mode) becomes "file", so the
+  // extension stays an extension instead of turning into the whole name.
+  const bareExtension = /^[-.]*-[-.]*\.([\p{L}\p{N}]+)$/u.exec(collapsed);
+  const normalized = bareExtension ? `file.${bareExtension[1]}` : collapsed.replace(/^[-.]+|[-.]+$/g, "");
+  const chars = Array.from(normalized);
+  if (chars.length <= maxLength) {
+    return normalized;
+  }
+
+  const dot = normalized.lastIndexOf(".");
+  const extension = dot > 0 && normalized.length - dot <= MAX_FILE_EXTENSION_LENGTH ? normalized.slice(dot) : "";
+  const stem = chars
+    .slice(0, maxLength - Array.from(extension).length)
+    .join("")
+    .replace(/[-.]+$/, "");
+  return `${stem}${extension}`;
 }
 
 export function randomHex(bytes: number): string {
@@ -74,10 +157,14 @@ export function parseBoundedInteger(
   return rounded;
 }
 
+export function clampInteger(value: number, min: number, max: number): number {
+  return Math.min(max, Math.max(min, Math.floor(value)));
+}
+
 export function normalizeAddress(value: string): string {
   const normalized = value.trim().toLowerCase();
   if (!isAddress(normalized)) {
-    throw new BadRequestError("Invalid account address.");
+    throw new BadRequestError("Invalid account address.", "invalid_address");
   }
   return getAddress(normalized).toLowerCase();
 }
@@ -111,17 +198,100 @@ export function parseUsdToWei(value: string): bigint {
   }
 }
 
-export async function authorizeRequest(request: Request, env: Env, rawBody: string): Promise<void> {
+// Streams the body and stops as soon as it exceeds MAX_REQUEST_BODY_BYTES, so an oversized
+// payload is never buffered in full.
+export async function readRequestBody(request: Request, env: Env): Promise<string> {
+  const maxBytes = parseBoundedInteger(env.MAX_REQUEST_BODY_BYTES ?? "65536", 1024, 10_485_760, 65_536);
+  return new TextDecoder().decode(await readRequestBytes(request, maxBytes));
+}
+
+// `onHead` sees the first `headLength` bytes (or the whole body, if shorter) once they have
+// arrived, so a caller can reject a stream by its magic bytes before the rest is read.
+export async function readRequestBytes(
+  request: Request,
+  maxBytes: number,
+  inspect?: { headLength: number; onHead(head: Uint8Array): void }
+): Promise<Uint8Array> {
+  const tooLarge = () => new PayloadTooLargeError(`Request body exceeds ${maxBytes} bytes.`);
+
+  const declaredLength = Number(request.headers.get("Content-Length") ?? "");
+  if (Number.isFinite(declaredLength) && declaredLength > maxBytes) {
+    throw tooLarge();
+  }
+  if (!request.body) {
+    return new Uint8Array(0);
+  }
+
+  const reader = request.body.getReader();
+  const chunks: Uint8Array[] = [];
+  let received = 0;
+  let inspected = !inspect;
+  for (;;) {
+    const { done, value } = await reader.read();
+    if (done) {
+      break;
+    }
+    received += value.byteLength;
+    if (received > maxBytes) {
+      await reader.cancel();
+      throw tooLarge();
+    }
+    chunks.push(value);
+    if (!inspected && inspect && received >= inspect.headLength) {
+      inspected = true;
+      try {
+        inspect.onHead(concatBytes(chunks, received).subarray(0, inspect.headLength));
+      } catch (error) {
+        await reader.cancel();
+        throw error;
+      }
+    }
+  }
+
+  const body = concatBytes(chunks, received);
+  if (!inspected && inspect) {
+    inspect.onHead(body);
+  }
+  return body;
+}
+
+function concatBytes(chunks: readonly Uint8Array[], length: number): Uint8Array {
+  const body = new Uint8Array(length);
+  let offset = 0;
+  for (const chunk of chunks) {
+    body.set(chunk, offset);
+    offset += chunk.byteLength;
+  }
+  return body;
+}
+
+// Returns "" when the header is missing or not a bearer token; callers decide how to reject
+// it only after the token comparison has run, so both failures cost the same.
+export function readBearerToken(request: Request): string {
   const authHeader = (request.headers.get("Authorization") ?? "").trim();
   if (!authHeader.startsWith("Bearer ")) {
-    throw new AuthError("Missing bearer token.");
+    return "";
   }
+  return authHeader.slice("Bearer ".length).trim();
+}
 
-  const token = authHeader.slice("Bearer ".length).trim();
-  if (!token || !timingSafeEqual(token, env.RELAY_AUTH_TOKEN.trim())) {
-    throw new AuthError("Invalid bearer token.");
+export async function authorizeRequest(request: Request, env: Env, rawBody: string): Promise<void> {
+  const token = readBearerToken(request);
+  // RELAY_AUTH_TOKEN_NEXT is accepted alongside the current token during a rotation window.
+  const matches = await matchesAnyToken(token, [env.RELAY_AUTH_TOKEN, env.RELAY_AUTH_TOKEN_NEXT]);
+  if (!token) {
+    throw new AuthError("Missing bearer token.", "missing_token");
+  }
+  if (!matches) {
+    throw new AuthError("Invalid bearer token.", "invalid_token");
   }
 
+  await verifyRequestSignature(request, env, rawBody);
+}
+
+// With RELAY_AUTH_HMAC_SECRET set, every bearer-authenticated request must also carry a fresh
+// HMAC over its body.
+export async function verifyRequestSignature(request: Request, env: Env, rawBody: string): Promise<void> {
   const secret = (env.RELAY_AUTH_HMAC_SECRET ?? "").trim();
   if (!secret) {
     return;
@@ -130,22 +300,22 @@ export async function authorizeRequest(request: Request, env: Env, rawBody: stri
   const timestamp = (request.headers.get("X-Relay-Timestamp") ?? "").trim();
   const signature = (request.headers.get("X-Relay-Signature") ?? "").trim().toLowerCase();
   if (!timestamp || !signature) {
-    throw new AuthError("Missing relay signature headers.");
+    throw new AuthError("Missing relay signature headers.", "missing_signature");
   }
 
   const parsedTimestamp = Number(timestamp);
   if (!Number.isFinite(parsedTimestamp)) {
-    throw new AuthError("Invalid relay timestamp.");
+    throw new AuthError("Invalid relay timestamp.", "invalid_timestamp");
   }
 
   const now = Math.floor(Date.now() / 1000);
   if (Math.abs(now - Math.floor(parsedTimestamp)) > 300) {
-    throw new AuthError("Relay timestamp is outside allowed window.");
+    throw new AuthError("Relay timestamp is outside allowed window.", "timestamp_out_of_window");
   }
 
   const expected = await hmacHex(secret, `${timestamp}.${rawBody}`);
   if (!timingSafeEqual(signature, expected)) {
-    throw new AuthError("Invalid relay signature.");
+    throw new AuthError("Invalid relay signature.", "invalid_signature");
   }
 }
 
@@ -158,14 +328,112 @@ export function jsonResponse(payload: unknown, status = 200): Response {
   );
 }
 
+export function errorResponse(
+  status: number,
+  code: string,
+  message: string,
+  requestId: string,
+  extra: Record<string, unknown> = {}
+): Response {
+  return jsonResponse({ ok: false, error: { code, message, requestId }, ...extra }, status);
+}
+
+const CORS_ALLOWED_HEADERS = ["authorization", "content-type", "x-relay-timestamp", "x-relay-signature"];
+
 export function corsResponse(response: Response): Response {
   response.headers.set("Access-Control-Allow-Origin", "*");
-  response.headers.set("Access-Control-Allow-Methods", "GET,POST,OPTIONS");
-  response.headers.set("Access-Control-Allow-Headers", "authorization,content-type,x-relay-timestamp,x-relay-signature");
   return response;
 }
 
-async function hmacHex(secret: string, payload: string): Promise<string> {
+export interface CorsPolicy {
+  // Null keeps the wildcard origin.
+  allowedOrigins: Set<string> | null;
+  allowCredentials: boolean;
+  maxAgeSeconds: number;
+}
+
+// CORS_ALLOWED_ORIGINS (comma-separated, e.g. `https://app.knot.fi`) switches from the wildcard to
+// echoing a matched Origin; a `*` entry keeps the wildcard. Browsers reject credentialed responses
+// with `*`, so CORS_ALLOW_CREDENTIALS is refused unless specific origins are configured. A bad
+// config is the operator's mistake, not the client's, so it is reported as a 503.
+export function resolveCorsPolicy(env: Env): CorsPolicy {
+  const origins = (env.CORS_ALLOWED_ORIGINS ?? "")
+    .split(",")
+    .map((origin) => origin.trim())
+    .filter((origin) => origin !== "");
+  const allowCredentials = parseBooleanFlag(env.CORS_ALLOW_CREDENTIALS, false);
+  const maxAgeSeconds = parseBoundedInteger(env.CORS_MAX_AGE_SECONDS ?? "0", 0, 86_400, 0);
+
+  const wildcard = origins.length === 0 || origins.includes("*");
+  if (allowCredentials && wildcard) {
+    throw new ServiceUnavailableError(
+      "CORS_ALLOW_CREDENTIALS requires CORS_ALLOWED_ORIGINS; credentials cannot be combined with `*`.",
+      "invalid_cors_config"
+    );
+  }
+  if (wildcard) {
+    return { allowedOrigins: null, allowCredentials, maxAgeSeconds };
+  }
+
+  const allowedOrigins = new Set<string>();
+  for (const origin of origins) {
+    let parsed: URL;
+    try {
+      parsed = new URL(origin);
+    } catch {
+      throw new ServiceUnavailableError(`Invalid CORS_ALLOWED_ORIGINS entry: ${origin}`, "invalid_cors_config");
+    }
+    if (parsed.origin !== origin.replace(/\/+$/, "").toLowerCase()) {
+      throw new ServiceUnavailableError(`Invalid CORS_ALLOWED_ORIGINS entry: ${origin}`, "invalid_cors_config");
+    }
+    allowedOrigins.add(parsed.origin);
+  }
+
+  return { allowedOrigins, allowCredentials, maxAgeSeconds };
+}
+
+// Runs on every response after routing. With configured origins, only a matching Origin is echoed
+// (and may carry credentials); any other origin gets no Allow-Origin header, so the browser blocks it.
+export function applyCorsPolicy(request: Request, policy: CorsPolicy, response: Response): void {
+  if (policy.allowedOrigins) {
+    const origin = request.headers.get("Origin");
+    response.headers.append("Vary", "Origin");
+    if (origin && policy.allowedOrigins.has(origin.toLowerCase())) {
+      response.headers.set("Access-Control-Allow-Origin", origin);
+      if (policy.allowCredentials) {
+        response.headers.set("Access-Control-Allow-Credentials", "true");
+      }
+    } else {
+      response.headers.delete("Access-Control-Allow-Origin");
+    }
+  }
+
+  const isPreflight = request.method === "OPTIONS" && response.headers.has("Access-Control-Allow-Methods");
+  if (isPreflight && policy.maxAgeSeconds > 0) {
+    response.headers.set("Access-Control-Max-Age", String(policy.maxAgeSeconds));
+  }
+}
+
+// Advertises only the methods registered for the path, and echoes the requested headers that
+// are on the allowlist (all of them when the browser did not ask for any).
+export function preflightResponse(request: Request, methods: readonly string[]): Response {
+  const requestedHeaders = (request.headers.get("Access-Control-Request-Headers") ?? "")
+    .split(",")
+    .map((header) => header.trim().toLowerCase())
+    .filter(Boolean);
+  const allowedHeaders =
+    requestedHeaders.length > 0
+      ? requestedHeaders.filter((header) => CORS_ALLOWED_HEADERS.includes(header))
+      : CORS_ALLOWED_HEADERS;
+
+  const response = corsResponse(new Response(null, { status: 204 }));
+  response.headers.set("Access-Control-Allow-Methods", [...new Set([...methods, "OPTIONS"])].join(","));
+  response.headers.set("Access-Control-Allow-Headers", allowedHeaders.join(","));
+  response.headers.set("Vary", "Access-Control-Request-Method, Access-Control-Request-Headers");
+  return response;
+}
+
+export async function hmacHex(secret: string, payload: string): Promise<string> {
   const encoder = new TextEncoder();
   const key = await crypto.subtle.importKey(
     "raw",
@@ -179,7 +447,40 @@ async function hmacHex(secret: string, payload: string): Promise<string> {
   return bytesToHex(new Uint8Array(mac)).slice(2);
 }
 
-function timingSafeEqual(a: string, b: string): boolean {
+// Admin routes take their own token so a leaked client token cannot change faucet state.
+export async function authorizeAdminRequest(request: Request, env: Env): Promise<void> {
+  const adminToken = resolveRequiredEnvValue(env.ADMIN_AUTH_TOKEN, "ADMIN_AUTH_TOKEN");
+  const token = readBearerToken(request);
+  const matches = await matchesAnyToken(token, [adminToken]);
+  if (!token) {
+    throw new AuthError("Missing bearer token.", "missing_token");
+  }
+  if (!matches) {
+    throw new AuthError("Invalid admin token.", "invalid_token");
+  }
+}
+
+// Compares SHA-256 digests so the work is independent of the presented token's length and
+// prefix, and checks every configured token without short-circuiting.
+export async function matchesAnyToken(presented: string, accepted: readonly (string | undefined)[]): Promise<boolean> {
+  const presentedDigest = await sha256Hex(presented);
+  let matched = false;
+  for (const candidate of accepted) {
+    const expected = (candidate ?? "").trim();
+    const equal = timingSafeEqual(presentedDigest, await sha256Hex(expected));
+    matched = (equal && expected !== "") || matched;
+  }
+  return matched && presented !== "";
+}
+
+async function sha256Hex(value: string): Promise<string> {
+  const digest = await crypto.subtle.digest("SHA-256", new TextEncoder().encode(value));
+  return Array.from(new Uint8Array(digest))
+    .map((byte) => byte.toString(16).padStart(2, "0"))
+    .join("");
+}
+
+export function timingSafeEqual(a: string, b: string): boolean {
   const aBytes = new TextEncoder().encode(a);
   const bBytes = new TextEncoder().encode(b);
 
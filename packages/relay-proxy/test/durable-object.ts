@@ -0,0 +1,69 @@
+import { Database } from "bun:sqlite";
+
+// Enough of DurableObjectState for the objects under test: SQLite storage backed by an in-memory
+// bun:sqlite database, key-value storage, a single alarm slot and waitUntil. Promises handed to
+// waitUntil are collected so a test can await them.
+export interface TestDurableObjectState extends DurableObjectState {
+  readonly pending: Promise<unknown>[];
+  readonly alarmAt: () => number | null;
+}
+
+export function createDurableObjectState(): TestDurableObjectState {
+  const db = new Database(":memory:");
+  const values = new Map<string, unknown>();
+  const pending: Promise<unknown>[] = [];
+  let alarm: number | null = null;
+
+  const sql = {
+    exec(query: string, ...bindings: unknown[]) {
+      const statement = db.query(query);
+      const rows = statement.columnNames.length > 0 ? (statement.all(...(bindings as never[])) as unknown[]) : [];
+      const rowsWritten = statement.columnNames.length > 0 ? 0 : statement.run(...(bindings as never[])).changes;
+      return {
+        rowsWritten,
+        toArray: () => rows,
+        one: () => {
+          if (rows.length !== 1) {
+            throw new Error(`Expected exactly one row, got ${rows.length}.`);
+          }
+          return rows[0];
+        },
+        [Symbol.iterator]: () => rows[Symbol.iterator](),
+      };
+    },
+  };
+
+  const storage = {
+    sql,
+    get: async (key: string) => values.get(key),
+    put: async (key: string, value: unknown) => {
+      values.set(key, value);
+    },
+    delete: async (key: string) => values.delete(key),
+    getAlarm: async () => alarm,
+    setAlarm: async (scheduledTime: number | Date) => {
+      alarm = Number(scheduledTime);
+    },
+    deleteAlarm: async () => {
+      alarm = null;
+    },
+    transactionSync: <T>(closure: () => T): T => db.transaction(closure)(),
+  };
+
+  return {
+    storage,
+    pending,
+    alarmAt: () => alarm,
+    waitUntil: (promise: Promise<unknown>) => {
+      pending.push(promise);
+    },
+  } as unknown as TestDurableObjectState;
+}
+
+// A namespace whose every ID resolves to `object`, for bindings a test backs with one instance.
+export function bindDurableObject(object: { fetch(request: Request): Promise<Response> }): DurableObjectNamespace {
+  return {
+    idFromName: (name: string) => name,
+    get: () => ({ fetch: (input: RequestInfo, init?: RequestInit) => object.fetch(new Request(input, init)) }),
+  } as unknown as DurableObjectNamespace;
+}
@@ -0,0 +1,82 @@
+import type { Chain, Hex } from "viem";
+
+import { FaucetTracker } from "../src/faucet/do";
+
+// What the fake RPC sees. It answers as if the faucet wallet were well funded and the recipient
+// held nothing and had never sent a transaction. Calls on a chain listed in `stalled` never
+// answer; they reject only when the caller's signal aborts. Broadcasts on a chain in `rejections`
+// fail with its queued node errors, one per broadcast, until the queue is empty. Every block
+// number read mines a block, and receipts land in the chain's current block.
+export interface ScriptedRpc {
+  readonly sent: { chainId: number; to: string; value?: bigint; data?: Hex; nonce?: number }[];
+  readonly signed: { chainId: number; to: string }[];
+  readonly stalled: Set<number>;
+  readonly rejections: Map<number, string[]>;
+  // Chain ID -> head block number.
+  readonly heads: Map<number, bigint>;
+  // Chain ID of every call made, in order.
+  readonly calls: number[];
+}
+
+export class ScriptedFaucetTracker extends FaucetTracker {
+  readonly rpc: ScriptedRpc = {
+    sent: [],
+    signed: [],
+    stalled: new Set(),
+    rejections: new Map(),
+    heads: new Map(),
+    calls: [],
+  };
+
+  protected override async createClient(
+    chain: Chain,
+    account: { address: string },
+    signal?: AbortSignal
+  ): Promise<never> {
+    return scriptedClient(this.rpc, chain, account, signal) as never;
+  }
+}
+
+function scriptedClient(rpc: ScriptedRpc, chain: Chain, account: { address: string }, signal?: AbortSignal) {
+  const answer = <T>(value: T): Promise<T> => {
+    rpc.calls.push(chain.id);
+    if (!rpc.stalled.has(chain.id)) {
+      return Promise.resolve(value);
+    }
+    return new Promise((_, reject) => {
+      signal?.addEventListener("abort", () => reject(signal.reason), { once: true });
+    });
+  };
+  const isFaucet = (address: string) => address.toLowerCase() === account.address.toLowerCase();
+
+  return {
+    account,
+    pollingInterval: 10,
+    getChainId: () => answer(chain.id),
+    getBalance: ({ address }: { address: string }) => answer(isFaucet(address) ? 10n ** 20n : 0n),
+    readContract: ({ args }: { args: [string] }) => answer(isFaucet(args[0]) ? 10n ** 12n : 0n),
+    getTransactionCount: () => answer(0),
+    estimateFeesPerGas: () => answer({ maxFeePerGas: 2_000_000_000n, maxPriorityFeePerGas: 1_000_000_000n }),
+    estimateGas: () => answer(21_000n),
+    sendTransaction: (tx: { to: string; value?: bigint; data?: Hex; nonce?: number }) => {
+      const rejection = rpc.rejections.get(chain.id)?.shift();
+      if (rejection) {
+        rpc.calls.push(chain.id);
+        return Promise.reject(new Error(rejection));
+      }
+      rpc.sent.push({ chainId: chain.id, to: tx.to, value: tx.value, data: tx.data, nonce: tx.nonce });
+      return answer(`0x${String(rpc.sent.length).padStart(64, "0")}` as Hex);
+    },
+    prepareTransactionRequest: (tx: object) => answer({ ...tx, nonce: rpc.signed.length }),
+    signTransaction: (tx: { to: string }) => {
+      rpc.signed.push({ chainId: chain.id, to: tx.to });
+      return answer("0x02f8" as Hex);
+    },
+    waitForTransactionReceipt: () =>
+      answer({ blockNumber: rpc.heads.get(chain.id) ?? 1n, gasUsed: 21_000n, effectiveGasPrice: 1n }),
+    getBlockNumber: () => {
+      rpc.heads.set(chain.id, (rpc.heads.get(chain.id) ?? 1n) + 1n);
+      return answer(rpc.heads.get(chain.id)!);
+    },
+  };
+}
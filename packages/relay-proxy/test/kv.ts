@@ -0,0 +1,23 @@
+// Map-backed KVNamespace covering get/put/delete. TTLs are recorded but never enforced.
+export interface TestKVNamespace extends KVNamespace {
+  readonly entries: Map<string, string>;
+  readonly ttls: Map<string, number | undefined>;
+}
+
+export function createKVNamespace(): TestKVNamespace {
+  const entries = new Map<string, string>();
+  const ttls = new Map<string, number | undefined>();
+  return {
+    entries,
+    ttls,
+    get: async (key: string) => entries.get(key) ?? null,
+    put: async (key: string, value: string, options?: KVNamespacePutOptions) => {
+      entries.set(key, value);
+      ttls.set(key, options?.expirationTtl);
+    },
+    delete: async (key: string) => {
+      entries.delete(key);
+      ttls.delete(key);
+    },
+  } as unknown as TestKVNamespace;
+}
@@ -0,0 +1,185 @@
+// In-memory stand-in for the Pinata SDK, installed for every test by workers-runtime.ts. Only the
+// calls the worker makes are implemented. Tests seed `pinata.files`, inspect what was signed or
+// pinned, and set `pinata.failNext` to make the next upstream call throw.
+export interface FakePinataFile {
+  id: string;
+  name: string;
+  cid: string;
+  size: number;
+  mime_type: string;
+  group_id: string | null;
+  keyvalues: Record<string, string>;
+  created_at: string;
+}
+
+export interface SignedURLOptions {
+  expires: number;
+  name: string;
+  groupId: string;
+  maxFileSize: number;
+  keyvalues: Record<string, string>;
+}
+
+export const pinata = {
+  files: [] as FakePinataFile[],
+  signedURLs: [] as SignedURLOptions[],
+  accessLinks: [] as { cid: string; expires: number }[],
+  failNext: null as Error | null,
+  // Runs before a file listing is answered, so a test can pin the file a lookup is looking for.
+  beforeList: null as ((keyvalues: Record<string, string>) => void) | null,
+  reset(): void {
+    this.files = [];
+    this.signedURLs = [];
+    this.accessLinks = [];
+    this.failNext = null;
+    this.beforeList = null;
+  },
+};
+
+// Adds a file as if it had been pinned through a signed upload URL.
+export function seedPinnedFile(file: Partial<FakePinataFile> & Pick<FakePinataFile, "keyvalues">): FakePinataFile {
+  const index = pinata.files.length;
+  const seeded: FakePinataFile = {
+    id: `file-${index}`,
+    name: file.keyvalues.imageID ?? `file-${index}`,
+    cid: `bafkreiseeded${index}`,
+    size: 1024,
+    mime_type: "image/png",
+    group_id: null,
+    created_at: new Date(Date.UTC(2026, 0, 1 + index)).toISOString(),
+    ...file,
+  };
+  pinata.files.push(seeded);
+  return seeded;
+}
+
+function takeFailure(): void {
+  const failure = pinata.failNext;
+  if (failure) {
+    pinata.failNext = null;
+    throw failure;
+  }
+}
+
+class FileQuery implements PromiseLike<{ files: FakePinataFile[]; next_page_token: string }> {
+  private groupID: string | null = null;
+  private cidFilter: string | null = null;
+  private keyvalueFilter: Record<string, string> = {};
+  private maxFiles = 10;
+  private descending = false;
+
+  group(groupID: string): this {
+    this.groupID = groupID;
+    return this;
+  }
+
+  cid(cid: string): this {
+    this.cidFilter = cid;
+    return this;
+  }
+
+  keyvalues(keyvalues: Record<string, string>): this {
+    this.keyvalueFilter = keyvalues;
+    return this;
+  }
+
+  order(direction: "ASC" | "DESC"): this {
+    this.descending = direction === "DESC";
+    return this;
+  }
+
+  limit(limit: number): this {
+    this.maxFiles = limit;
+    return this;
+  }
+
+  pageToken(_token: string): this {
+    return this;
+  }
+
+  then<R1, R2>(
+    onFulfilled?: ((value: { files: FakePinataFile[]; next_page_token: string }) => R1 | PromiseLike<R1>) | null,
+    onRejected?: ((reason: unknown) => R2 | PromiseLike<R2>) | null
+  ): PromiseLike<R1 | R2> {
+    return Promise.resolve()
+      .then(() => {
+        takeFailure();
+        pinata.beforeList?.(this.keyvalueFilter);
+        const matched = pinata.files.filter(
+          (file) =>
+            (this.groupID === null || file.group_id === this.groupID) &&
+            (this.cidFilter === null || file.cid === this.cidFilter) &&
+            Object.entries(this.keyvalueFilter).every(([key, value]) => file.keyvalues[key] === value)
+        );
+        const ordered = this.descending ? [...matched].reverse() : matched;
+        return { files: ordered.slice(0, this.maxFiles), next_page_token: "" };
+      })
+      .then(onFulfilled, onRejected);
+  }
+}
+
+class FileUpload implements PromiseLike<{ cid: string }> {
+  private groupID: string | null = null;
+  private metadata: Record<string, string> = {};
+
+  constructor(private readonly file: File) {}
+
+  group(groupID: string): this {
+    this.groupID = groupID;
+    return this;
+  }
+
+  keyvalues(keyvalues: Record<string, string>): this {
+    this.metadata = keyvalues;
+    return this;
+  }
+
+  then<R1, R2>(
+    onFulfilled?: ((value: { cid: string }) => R1 | PromiseLike<R1>) | null,
+    onRejected?: ((reason: unknown) => R2 | PromiseLike<R2>) | null
+  ): PromiseLike<R1 | R2> {
+    return Promise.resolve()
+      .then(() => {
+        takeFailure();
+        const cid = `bafkreipinned${pinata.files.length}`;
+        pinata.files.push({
+          id: `file-${pinata.files.length}`,
+          name: this.file.name,
+          cid,
+          size: this.file.size,
+          mime_type: this.file.type,
+          group_id: this.groupID,
+          keyvalues: this.metadata,
+          created_at: new Date().toISOString(),
+        });
+        return { cid };
+      })
+      .then(onFulfilled, onRejected);
+  }
+}
+
+const uploads = {
+  createSignedURL: async (options: SignedURLOptions) => {
+    takeFailure();
+    pinata.signedURLs.push(options);
+    return `https://uploads.pinata.test/v3/files/signed-${pinata.signedURLs.length}`;
+  },
+  file: (file: File) => new FileUpload(file),
+};
+
+const files = { list: () => new FileQuery() };
+
+export class FakePinataSDK {
+  readonly upload = { public: uploads, private: uploads };
+  readonly files = { public: files, private: files };
+  readonly gateways = {
+    private: {
+      createAccessLink: async ({ cid, expires }: { cid: string; expires: number }) => {
+        takeFailure();
+        pinata.accessLinks.push({ cid, expires });
+        const signature = `sig${pinata.accessLinks.length}`;
+        return `https://gateway.pinata.test/files/${cid}?X-Expires=${expires}&X-Signature=${signature}`;
+      },
+    },
+  };
+}
@@ -0,0 +1,27 @@
+import { plugin } from "bun";
+import { mock } from "bun:test";
+
+import { FakePinataSDK } from "./pinata";
+
+// `cloudflare:workers` only exists inside workerd. Durable Object classes extend its
+// `DurableObject`, which just keeps `ctx` and `env`, so tests get a stand-in that does the same
+// and construct objects with createDurableObjectState().
+plugin({
+  name: "cloudflare-workers",
+  setup(build) {
+    build.module("cloudflare:workers", () => ({
+      loader: "object",
+      exports: {
+        DurableObject: class DurableObject<Env> {
+          constructor(
+            readonly ctx: DurableObjectState,
+            readonly env: Env
+          ) {}
+        },
+      },
+    }));
+  },
+});
+
+// No test talks to Pinata; see test/pinata.ts.
+mock.module("pinata", () => ({ PinataSDK: FakePinataSDK }));
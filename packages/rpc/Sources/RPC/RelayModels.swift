@@ -252,10 +252,24 @@ public struct RelayPaymentOptionModel: Sendable, Codable, Equatable {
     }
 }
 
+public struct RelayErrorModel: Sendable, Decodable, Equatable {
+    public let code: String
+
+    public let message: String
+
+    public let requestId: String?
+
+    public init(code: String, message: String, requestId: String?) {
+        self.code = code
+        self.message = message
+        self.requestId = requestId
+    }
+}
+
 public struct RelayPaymentRequiredModel: Sendable, Decodable, Equatable {
     public let ok: Bool
 
-    public let error: String
+    public let error: RelayErrorModel
 
     public let account: String
 
@@ -277,7 +291,7 @@ public struct RelayPaymentRequiredModel: Sendable, Decodable, Equatable {
 
     public init(
         ok: Bool,
-        error: String,
+        error: RelayErrorModel,
         account: String,
         supportMode: String,
         estimatedDebitNative: String,